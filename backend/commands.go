@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reschedule-program/services"
+	"strings"
+)
+
+// commandActor 命令行操作的操作人
+var commandActor = services.Actor{Username: "Command line"}
+
+// runCommand 执行命令行命令：
+//
+//	export <文件>  备份整个数据库，文件名以 .json 结尾时为 JSON，否则为 zip
+//	import <文件>  将备份恢复到空数据库
+func runCommand(args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: reschedule-program export|import <file>")
+	}
+	switch args[0] {
+	case "export":
+		return exportCommand(args[1])
+	case "import":
+		return importCommand(args[1])
+	}
+	return fmt.Errorf("unknown command %q, expected export or import", args[0])
+}
+
+// exportCommand 备份到文件，先写入临时文件，完成后改名
+func exportCommand(path string) error {
+	format := services.BackupFormatZip
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		format = services.BackupFormatJSON
+	}
+
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	manifest, err := services.WriteBackup(file, format)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	for _, table := range manifest.Tables {
+		fmt.Printf("%-24s %d\n", table.Name, table.Count)
+	}
+	fmt.Printf("Backup written to %s\n", path)
+	return nil
+}
+
+// importCommand 从文件恢复
+func importCommand(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	result, err := services.RestoreBackup(commandActor, file)
+	if err != nil {
+		return err
+	}
+	for _, table := range result.Tables {
+		fmt.Printf("%-24s %d/%d\n", table.Name, table.Restored, table.Expected)
+	}
+	if result.Unresolved > 0 {
+		fmt.Printf("%d references to records missing from the backup were cleared\n", result.Unresolved)
+	}
+	fmt.Printf("Restored backup taken at %s\n", result.CreatedAt.Format("2006-01-02 15:04:05 MST"))
+	return nil
+}
@@ -1,27 +1,69 @@
 package database
 
 import (
+	"fmt"
 	"log"
+	"os"
 	"reschedule-program/models"
+	"strings"
 
+	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
 var DB *gorm.DB
 
+// Open 按连接串打开数据库：以 postgres:// 或 postgresql:// 开头时连接 PostgreSQL，否则为 SQLite 数据库文件
+func Open(dsn string, config *gorm.Config) (*gorm.DB, error) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		return gorm.Open(postgres.Open(dsn), config)
+	}
+	return gorm.Open(sqlite.Open(dsn), config)
+}
+
+// InitDB 连接环境变量 DATABASE_URL 指定的数据库，未设置时使用运行目录的 reschedule.db
 func InitDB() {
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		dsn = "reschedule.db"
+	}
+
 	var err error
-	DB, err = gorm.Open(sqlite.Open("reschedule.db"), &gorm.Config{})
+	DB, err = Open(dsn, &gorm.Config{})
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
+	if err := Migrate(DB); err != nil {
+		log.Fatal("Failed to migrate database:", err)
+	}
+
+	log.Println("Database connected and migrated successfully")
+}
+
+// Migrate 迁移表结构，首次启用发布功能时将现有课程表视为已发布
+func Migrate(db *gorm.DB) error {
+	publishedExists := db.Migrator().HasTable(&models.PublishedSchedule{})
 
 	// Auto migrate the schema
-	err = DB.AutoMigrate(&models.User{}, &models.Class{}, &models.Course{}, &models.WeeklySchedule{}, &models.ActivityLog{})
+	err := db.AutoMigrate(&models.User{}, &models.Class{}, &models.Course{}, &models.WeeklySchedule{}, &models.ActivityLog{},
+		&models.Term{}, &models.CalendarDay{}, &models.Session{},
+		&models.Teacher{}, &models.Room{}, &models.TimetableJob{}, &models.TimetableLesson{},
+		&models.RescheduleRequest{}, &models.PublishedSchedule{},
+		&models.ScheduleChange{}, &models.UndoEntry{}, &models.LogRetentionPolicy{}, &models.CalendarFeed{},
+		&models.WebhookSubscription{}, &models.WebhookDelivery{})
 	if err != nil {
-		log.Fatal("Failed to migrate database:", err)
+		return err
 	}
 
-	log.Println("Database connected and migrated successfully")
+	if !publishedExists {
+		err = db.Exec(`INSERT INTO published_schedules
+			(term_id, class_id, course_id, week_number, time_slot_row, time_slot_col, teacher_id, room_id, published_at)
+			SELECT term_id, class_id, course_id, week_number, time_slot_row, time_slot_col, teacher_id, room_id, CURRENT_TIMESTAMP
+			FROM weekly_schedules WHERE deleted_at IS NULL`).Error
+		if err != nil {
+			return fmt.Errorf("publish existing schedules: %w", err)
+		}
+	}
+	return nil
 }
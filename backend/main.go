@@ -1,9 +1,12 @@
 package main
 
 import (
+	"log"
+	"os"
 	"reschedule-program/database"
 	"reschedule-program/middleware"
 	"reschedule-program/routes"
+	"reschedule-program/services"
 
 	"github.com/gin-gonic/gin"
 )
@@ -12,12 +15,37 @@ func main() {
 	// Initialize database
 	database.InitDB()
 
+	// 命令行命令（export / import），执行后退出
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if err := services.FailInterruptedTimetableJobs(); err != nil {
+		log.Println("Failed to reset interrupted timetable jobs:", err)
+	}
+	services.StartLogRetention()
+	services.StartScheduleEvents()
+	services.StartWebhookDelivery()
+
 	r := gin.Default()
 	r.Use(middleware.CORS())
+	r.Use(middleware.RequestID())
 
 	routes.AuthRoutes(r)
 	routes.SetupScheduleRoutes(r)
 	routes.AdminRoutes(r)
+	routes.TermRoutes(r)
+	routes.ClassRoutes(r)
+	routes.CourseRoutes(r)
+	routes.TeacherRoutes(r)
+	routes.RoomRoutes(r)
+	routes.TimetableRoutes(r)
+	routes.RescheduleRoutes(r)
+	routes.LogRoutes(r)
+	routes.CalendarRoutes(r)
 
 	r.Run(":8080")
 }
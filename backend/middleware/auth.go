@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"net/http"
+	"reschedule-program/models"
+	"reschedule-program/services"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sessionKey 会话在 gin.Context 中的键名
+const sessionKey = "session"
+
+// bearerToken 从 Authorization 请求头中取出令牌
+func bearerToken(c *gin.Context) string {
+	header := c.GetHeader("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+}
+
+// loadSession 校验令牌并将会话保存到上下文
+func loadSession(c *gin.Context) bool {
+	token := bearerToken(c)
+	if token == "" {
+		return false
+	}
+	session, err := services.NewSessionService().GetSession(token)
+	if err != nil {
+		return false
+	}
+	c.Set(sessionKey, session)
+	return true
+}
+
+// CurrentSession 获取当前请求的登录会话，未登录时返回 nil
+func CurrentSession(c *gin.Context) *models.Session {
+	value, ok := c.Get(sessionKey)
+	if !ok {
+		return nil
+	}
+	session, _ := value.(*models.Session)
+	return session
+}
+
+// OptionalSession 获取当前请求携带的登录会话，不要求登录，未携带有效令牌时返回 nil
+func OptionalSession(c *gin.Context) *models.Session {
+	if CurrentSession(c) == nil {
+		loadSession(c)
+	}
+	return CurrentSession(c)
+}
+
+// CurrentActor 获取当前请求的操作人及其客户端IP和请求ID，用于记录变更历史和活动日志；
+// 不要求登录的接口携带有效令牌时记录登录用户，否则为匿名
+func CurrentActor(c *gin.Context) services.Actor {
+	actor := services.SessionActor(OptionalSession(c))
+	actor.ClientIP = c.ClientIP()
+	actor.RequestID = CurrentRequestID(c)
+	return actor
+}
+
+// AuthRequired 要求请求携带有效的登录令牌
+func AuthRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !loadSession(c) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Login required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// AdminRequired 要求请求来自管理员
+func AdminRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !loadSession(c) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Login required"})
+			return
+		}
+		if CurrentSession(c).UserType != "admin" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Admin permission required"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestIDKey 请求ID在 gin.Context 中的键名
+const requestIDKey = "requestId"
+
+// requestIDHeader 传递请求ID的请求头和响应头
+const requestIDHeader = "X-Request-ID"
+
+// RequestID 为每个请求分配请求ID：沿用客户端传来的 X-Request-ID，否则随机生成，并在响应头中返回
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if id == "" || len(id) > 64 {
+			buf := make([]byte, 8)
+			if _, err := rand.Read(buf); err == nil {
+				id = hex.EncodeToString(buf)
+			}
+		}
+		c.Set(requestIDKey, id)
+		c.Writer.Header().Set(requestIDHeader, id)
+		c.Next()
+	}
+}
+
+// CurrentRequestID 获取当前请求的请求ID
+func CurrentRequestID(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
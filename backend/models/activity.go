@@ -0,0 +1,124 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 活动日志的操作类型，格式为 对象类型.操作；课程表变更为 schedule. 加变更类型（如 schedule.move）
+const (
+	ActivityUserCreate   = "user.create"
+	ActivityUserUpdate   = "user.update"
+	ActivityUserPassword = "user.password"
+	ActivityUserDelete   = "user.delete"
+
+	ActivityClassCreate    = "class.create"
+	ActivityClassUpdate    = "class.update"
+	ActivityClassArchive   = "class.archive"
+	ActivityClassUnarchive = "class.unarchive"
+	ActivityClassDelete    = "class.delete"
+
+	ActivityCourseCreate = "course.create"
+	ActivityCourseUpdate = "course.update"
+	ActivityCourseDelete = "course.delete"
+	ActivityCourseMerge  = "course.merge"
+
+	ActivityTeacherCreate = "teacher.create"
+	ActivityTeacherUpdate = "teacher.update"
+	ActivityTeacherDelete = "teacher.delete"
+
+	ActivityRoomCreate = "room.create"
+	ActivityRoomUpdate = "room.update"
+	ActivityRoomDelete = "room.delete"
+
+	ActivityRescheduleCreate   = "reschedule.create"
+	ActivityRescheduleApprove  = "reschedule.approve"
+	ActivityRescheduleReject   = "reschedule.reject"
+	ActivityRescheduleWithdraw = "reschedule.withdraw"
+
+	ActivityTimetableStart  = "timetable.start"
+	ActivityTimetableApply  = "timetable.apply"
+	ActivityTimetableDelete = "timetable.delete"
+	ActivitySchedulePublish = "schedule.publish"
+
+	ActivityTermCreate   = "term.create"
+	ActivityTermUpdate   = "term.update"
+	ActivityTermActivate = "term.activate"
+	ActivityTermDelete   = "term.delete"
+
+	ActivityCalendarDayAdd    = "calendar_day.add"
+	ActivityCalendarDayDelete = "calendar_day.delete"
+
+	ActivityFeedCreate     = "feed.create"
+	ActivityFeedRegenerate = "feed.regenerate"
+	ActivityFeedRevoke     = "feed.revoke"
+
+	ActivityLogRetention = "log.retention"
+	ActivityLogPrune     = "log.prune"
+
+	ActivityBackupRestore = "backup.restore"
+
+	ActivityWebhookCreate = "webhook.create"
+	ActivityWebhookUpdate = "webhook.update"
+	ActivityWebhookDelete = "webhook.delete"
+)
+
+// 活动日志的对象类型
+const (
+	EntityUser              = "user"
+	EntityClass             = "class"
+	EntityCourse            = "course"
+	EntityTeacher           = "teacher"
+	EntityRoom              = "room"
+	EntityRescheduleRequest = "reschedule_request"
+	EntityTimetableJob      = "timetable_job"
+	EntityActivityLog       = "activity_log"
+	EntityWebhook           = "webhook"
+	EntityTerm              = "term"
+	EntityCalendarDay       = "calendar_day"
+	EntityCalendarFeed      = "calendar_feed"
+)
+
+// JSONText 以文本保存的JSON，序列化时原样输出
+type JSONText string
+
+// MarshalJSON 输出保存的JSON，空值输出 null
+func (j JSONText) MarshalJSON() ([]byte, error) {
+	if j == "" {
+		return []byte("null"), nil
+	}
+	return []byte(j), nil
+}
+
+// ActivityLog 活动日志（审计事件），只追加不修改。
+// Before/After 为操作对象变更前后的数据，Message 由结构化数据生成；早期的日志只有 Message
+type ActivityLog struct {
+	gorm.Model
+	ActorID    string   `json:"actorId" gorm:"size:10;index"` // 操作人用户ID，内置管理员和未登录时为空
+	ActorName  string   `json:"actorName" gorm:"index"`
+	Action     string   `json:"action" gorm:"index"`
+	EntityType string   `json:"entityType" gorm:"index:idx_activity_entity"`
+	EntityID   string   `json:"entityId" gorm:"index:idx_activity_entity"`
+	EntityName string   `json:"entityName"`           // 操作对象的名称，调课申请为所属班级名
+	ClassID    *uint    `json:"classId" gorm:"index"` // 涉及的班级，与班级无关时为空
+	Before     JSONText `json:"before" gorm:"type:text"`
+	After      JSONText `json:"after" gorm:"type:text"`
+	ClientIP   string   `json:"clientIp"`
+	RequestID  string   `json:"requestId" gorm:"index"`
+	Message    string   `json:"message" gorm:"not null"`
+}
+
+// LogRetentionPolicy 活动日志保留策略，只有一行。超过最长保留天数或最多条数的旧日志由后台任务清理，
+// Archive 为 true 时清理前先归档为 gzip 压缩的 JSONL 文件
+type LogRetentionPolicy struct {
+	ID          uint       `json:"-" gorm:"primaryKey"`
+	MaxAgeDays  int        `json:"maxAgeDays" gorm:"not null;default:0"` // 最长保留天数，0 表示不限
+	MaxRows     int        `json:"maxRows" gorm:"not null;default:0"`    // 最多保留条数，0 表示不限
+	Archive     bool       `json:"archive" gorm:"not null;default:false"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+	LastRunAt   *time.Time `json:"lastRunAt"`   // 最近一次清理的时间
+	LastPruned  int64      `json:"lastPruned"`  // 最近一次清理的条数
+	LastArchive string     `json:"lastArchive"` // 最近一次清理写入的归档文件
+	LastError   string     `json:"lastError"`   // 最近一次清理失败的原因
+}
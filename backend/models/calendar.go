@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 日历订阅的范围
+const (
+	CalendarScopeClass   = "class"
+	CalendarScopeTeacher = "teacher"
+	CalendarScopeRoom    = "room"
+)
+
+// CalendarFeed 日历订阅：订阅链接中的 Token 是密钥，持有链接即可读取日历，撤销后链接失效。
+// 订阅始终读取当前学期已发布的课程表，草稿订阅读取草稿
+type CalendarFeed struct {
+	gorm.Model
+	OwnerID   string `json:"ownerId" gorm:"size:10;index:idx_feed_owner"` // 创建订阅的用户ID，内置管理员为空
+	OwnerName string `json:"ownerName" gorm:"index:idx_feed_owner"`
+	Scope     string `json:"scope" gorm:"not null"`      // class / teacher / room
+	TargetID  uint   `json:"targetId" gorm:"not null"`   // 班级、教师或教室的ID
+	Draft     bool   `json:"draft" gorm:"default:false"` // 读取草稿而不是已发布的课程表
+	Token     string `json:"token" gorm:"uniqueIndex;size:64;not null"`
+
+	// 以下字段在读取订阅时更新，用于 ETag 和 Last-Modified
+	ContentHash   string `json:"-" gorm:"size:64"`
+	SourceVersion string `json:"-" gorm:"size:64"` // 生成 ContentHash 时的数据版本，版本不变时不重新生成
+
+	ChangedAt     *time.Time `json:"changedAt"` // 订阅内容最近一次变化的时间
+	LastFetchedAt *time.Time `json:"lastFetchedAt"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// 课程表变更类型
+const (
+	ScheduleChangeInsert  = "insert"  // 新增课程
+	ScheduleChangeDelete  = "delete"  // 删除课程
+	ScheduleChangeMove    = "move"    // 移动课程
+	ScheduleChangeSwap    = "swap"    // 交换两节课
+	ScheduleChangeUpdate  = "update"  // 修改教师、教室或课程
+	ScheduleChangeDiscard = "discard" // 放弃草稿，恢复为已发布版本
+	ScheduleChangeRevert  = "revert"  // 恢复到历史版本
+	ScheduleChangeUndo    = "undo"    // 撤销操作人的上一次操作
+	ScheduleChangeRedo    = "redo"    // 重做被撤销的操作
+)
+
+// 撤销日志状态
+const (
+	UndoEntryDone   = "done"   // 已执行，可撤销
+	UndoEntryUndone = "undone" // 已撤销，可重做
+)
+
+// ScheduleChange 课程表（草稿）变更历史，只追加不修改。
+// Before/After 为变更涉及的各位置变更前后的课程（JSON），位置只出现在 After 中表示新增，只出现在 Before 中表示删除
+type ScheduleChange struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"createdAt" gorm:"index"`
+	TermID    uint      `json:"termId" gorm:"index:idx_change_class"`
+	ClassID   uint      `json:"classId" gorm:"index:idx_change_class"`
+	Action    string    `json:"action" gorm:"not null"`
+	ActorID   string    `json:"actorId" gorm:"size:10"` // 操作人用户ID，内置管理员和未登录时为空
+	ActorName string    `json:"actorName"`
+	Before    string    `json:"-" gorm:"type:text"`
+	After     string    `json:"-" gorm:"type:text"`
+}
+
+// UndoEntry 用户的撤销日志，记录其删除、移动和交换课程的操作，按ID先后排列
+type UndoEntry struct {
+	ID        uint           `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time      `json:"createdAt"`
+	UpdatedAt time.Time      `json:"updatedAt"`
+	ActorID   string         `json:"actorId" gorm:"size:10;index:idx_undo_actor"`
+	ActorName string         `json:"actorName" gorm:"index:idx_undo_actor"`
+	ChangeID  uint           `json:"changeId" gorm:"not null"`
+	State     string         `json:"state" gorm:"not null"` // done / undone
+	Change    ScheduleChange `json:"-"`
+}
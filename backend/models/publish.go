@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// PublishedSchedule 已发布的课程表，查看者读取。编辑始终修改 WeeklySchedule（草稿），
+// 发布时将班级在当前学期的草稿整体复制到此表
+type PublishedSchedule struct {
+	ID          uint      `json:"id" gorm:"primarykey"`
+	TermID      uint      `json:"termId" gorm:"index:idx_published_class"`
+	ClassID     uint      `json:"classId" gorm:"not null;index:idx_published_class"`
+	CourseID    uint      `json:"courseId" gorm:"not null"`
+	WeekNumber  int       `json:"weekNumber" gorm:"not null"`
+	TimeSlotRow int       `json:"timeSlotRow" gorm:"not null"`
+	TimeSlotCol int       `json:"timeSlotCol" gorm:"not null"`
+	TeacherID   *uint     `json:"teacherId" gorm:"index"`
+	RoomID      *uint     `json:"roomId" gorm:"index"`
+	PublishedAt time.Time `json:"publishedAt"`
+	Class       Class     `json:"class" gorm:"foreignKey:ClassID"`
+	Course      Course    `json:"course" gorm:"foreignKey:CourseID"`
+	Teacher     *Teacher  `json:"teacher,omitempty" gorm:"foreignKey:TeacherID"`
+	Room        *Room     `json:"room,omitempty" gorm:"foreignKey:RoomID"`
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 调课申请类型
+const (
+	RescheduleMove   = "move"   // 移动到目标位置
+	RescheduleSwap   = "swap"   // 与目标位置的课程交换
+	RescheduleCancel = "cancel" // 取消该节课
+)
+
+// 调课申请状态
+const (
+	RescheduleRequestPending   = "pending"   // 等待审批
+	RescheduleRequestApproved  = "approved"  // 已批准并写入课程表
+	RescheduleRequestRejected  = "rejected"  // 已驳回
+	RescheduleRequestFailed    = "failed"    // 已批准但写入失败（如目标位置已有课程或存在冲突）
+	RescheduleRequestWithdrawn = "withdrawn" // 申请人已撤回
+)
+
+// RescheduleRequest 调课申请，由管理员或班级负责人审批
+type RescheduleRequest struct {
+	gorm.Model
+	TermID      uint   `json:"termId" gorm:"index"`
+	ClassID     uint   `json:"classId" gorm:"not null;index"`
+	Action      string `json:"action" gorm:"not null"` // move / swap / cancel
+	WeekNumber  int    `json:"weekNumber"`             // 原位置
+	TimeSlotRow int    `json:"timeSlotRow"`
+	TimeSlotCol int    `json:"timeSlotCol"`
+	TargetWeek  int    `json:"targetWeek"` // 移动或交换的目标位置，取消时为 0
+	TargetRow   int    `json:"targetRow"`
+	TargetCol   int    `json:"targetCol"`
+	Reason      string `json:"reason" gorm:"not null"`
+	Status      string `json:"status" gorm:"not null;default:pending;index"`
+
+	RequesterID   string     `json:"requesterId" gorm:"size:10;index"`
+	RequesterName string     `json:"requesterName"`
+	ReviewerID    string     `json:"reviewerId" gorm:"size:10"`
+	ReviewerName  string     `json:"reviewerName"`
+	ReviewComment string     `json:"reviewComment"`
+	ReviewedAt    *time.Time `json:"reviewedAt"`
+	Outcome       string     `json:"outcome"` // 审批结果说明，写入失败时为失败原因
+
+	Class Class `json:"class" gorm:"foreignKey:ClassID"`
+}
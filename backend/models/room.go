@@ -0,0 +1,12 @@
+package models
+
+import "gorm.io/gorm"
+
+// Room 教室表
+type Room struct {
+	gorm.Model
+	Name     string `json:"name" gorm:"uniqueIndex;not null"`
+	Building string `json:"building"`
+	Capacity int    `json:"capacity"` // 座位数，0 表示不限
+	Features string `json:"features"` // 设施，逗号分隔，如 "projector,lab"
+}
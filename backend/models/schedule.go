@@ -5,29 +5,54 @@ import "gorm.io/gorm"
 // Class 班级表
 type Class struct {
 	gorm.Model
-	Name string `json:"name" gorm:"uniqueIndex;not null"`
+	Name     string `json:"name" gorm:"uniqueIndex;not null"`
+	Archived bool   `json:"archived" gorm:"default:false"` // 归档后不在班级列表中显示
+	Size     int    `json:"size"`                          // 班级人数，用于检查教室容量
+	OwnerID  string `json:"ownerId" gorm:"size:10;index"`  // 班级负责人的用户ID，可审批本班的调课申请
 }
 
-// Course 课程表
+// Course 课程表（课程目录）
 type Course struct {
 	gorm.Model
-	Name string `json:"name" gorm:"not null"`
+	Code        *string `json:"code" gorm:"uniqueIndex;size:32"` // 课程代码，唯一，自动创建的课程为空
+	Name        string  `json:"name" gorm:"not null"`            // 显示名称
+	Credits     float64 `json:"credits"`                         // 学分
+	WeeklyHours int     `json:"weeklyHours"`                     // 计划周学时
+	Color       string  `json:"color" gorm:"size:7"`             // 显示颜色 #RRGGBB
+	Description string  `json:"description"`
+
+	DefaultTeacherID *uint    `json:"defaultTeacherId"` // 默认任课教师，课程记录未单独指定教师时使用
+	DefaultTeacher   *Teacher `json:"defaultTeacher,omitempty" gorm:"foreignKey:DefaultTeacherID"`
 }
 
 // WeeklySchedule 按周存储的课程表
 type WeeklySchedule struct {
 	gorm.Model
-	ClassID     uint   `json:"classId" gorm:"not null"`
-	CourseID    uint   `json:"courseId" gorm:"not null"`
-	WeekNumber  int    `json:"weekNumber" gorm:"not null"`  // 周数 1-20
-	TimeSlotRow int    `json:"timeSlotRow" gorm:"not null"` // 时间段行号 0-4
-	TimeSlotCol int    `json:"timeSlotCol" gorm:"not null"` // 时间段列号 0-6
-	Class       Class  `json:"class" gorm:"foreignKey:ClassID"`
-	Course      Course `json:"course" gorm:"foreignKey:CourseID"`
+	TermID      uint     `json:"termId" gorm:"index"` // 所属学期，0 表示尚未设置学期
+	ClassID     uint     `json:"classId" gorm:"not null"`
+	CourseID    uint     `json:"courseId" gorm:"not null"`
+	WeekNumber  int      `json:"weekNumber" gorm:"not null"`  // 周数 1-20
+	TimeSlotRow int      `json:"timeSlotRow" gorm:"not null"` // 时间段行号 0-4
+	TimeSlotCol int      `json:"timeSlotCol" gorm:"not null"` // 时间段列号 0-6
+	TeacherID   *uint    `json:"teacherId" gorm:"index"`      // 单独指定的任课教师，为空时使用课程默认教师
+	RoomID      *uint    `json:"roomId" gorm:"index"`         // 上课教室
+	Class       Class    `json:"class" gorm:"foreignKey:ClassID"`
+	Course      Course   `json:"course" gorm:"foreignKey:CourseID"`
+	Teacher     *Teacher `json:"teacher,omitempty" gorm:"foreignKey:TeacherID"`
+	Room        *Room    `json:"room,omitempty" gorm:"foreignKey:RoomID"`
+
+	// 以下字段不入库，由当前学期校历推算
+	Date        string `json:"date,omitempty" gorm:"-"`        // 上课日期 YYYY-MM-DD
+	NonTeaching bool   `json:"nonTeaching,omitempty" gorm:"-"` // 当天为节假日，课程被占用
+	Holiday     string `json:"holiday,omitempty" gorm:"-"`     // 节假日名称
+	MakeUpFor   *int   `json:"makeUpFor,omitempty" gorm:"-"`   // 调休补课日按该列的课表上课时复制的课程，为原课程的列号
 }
 
-// ActivityLog 活动日志
-type ActivityLog struct {
-	gorm.Model
-	Message string `json:"message" gorm:"not null"`
+// EffectiveTeacherID 返回实际任课教师ID：优先使用单独指定的教师，否则使用课程默认教师。
+// 调用前需要加载 Course
+func (s *WeeklySchedule) EffectiveTeacherID() *uint {
+	if s.TeacherID != nil {
+		return s.TeacherID
+	}
+	return s.Course.DefaultTeacherID
 }
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// Session 登录会话，令牌通过 Authorization: Bearer <token> 请求头传递
+type Session struct {
+	Token     string    `json:"token" gorm:"primaryKey;size:64"`
+	UserID    string    `json:"userID" gorm:"index"` // 内置管理员账号为空
+	Username  string    `json:"username" gorm:"not null"`
+	UserType  string    `json:"userType" gorm:"not null"`
+	ExpiresAt time.Time `json:"expiresAt" gorm:"index"`
+	CreatedAt time.Time `json:"createdAt"`
+}
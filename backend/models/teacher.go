@@ -0,0 +1,12 @@
+package models
+
+import "gorm.io/gorm"
+
+// Teacher 教师表
+type Teacher struct {
+	gorm.Model
+	Name   string `json:"name" gorm:"not null"`
+	Email  string `json:"email"`
+	Phone  string `json:"phone"`
+	UserID string `json:"userID" gorm:"size:10;index"` // 关联的登录账号，可为空
+}
@@ -0,0 +1,32 @@
+package models
+
+import "gorm.io/gorm"
+
+// 校历日期类型
+const (
+	CalendarDayHoliday = "holiday" // 节假日，当天不上课
+	CalendarDayWorkday = "workday" // 调休补课日，当天按 FollowsCol 对应星期的课表上课
+)
+
+// Term 学期
+type Term struct {
+	gorm.Model
+	Name      string `json:"name" gorm:"uniqueIndex;not null"`
+	StartDate string `json:"startDate" gorm:"not null"`            // 第1周周一的日期 YYYY-MM-DD
+	WeekCount int    `json:"weekCount" gorm:"not null;default:20"` // 学期总周数
+	Active    bool   `json:"active" gorm:"default:false"`          // 当前学期，课程表查询默认使用
+
+	// 每天5个时间段的上课时间，按行号顺序以逗号分隔，如 08:00-09:40；日历导出使用
+	PeriodTimes string `json:"periodTimes" gorm:"not null;default:'08:00-09:40,10:00-11:40,14:00-15:40,16:00-17:40,19:00-20:40'"`
+	TimeZone    string `json:"timeZone" gorm:"not null;default:'Asia/Shanghai'"` // 上课时间所在时区（IANA 名称）
+}
+
+// CalendarDay 学期校历中的节假日或调休补课日
+type CalendarDay struct {
+	gorm.Model
+	TermID     uint   `json:"termId" gorm:"not null;uniqueIndex:idx_term_date"`
+	Date       string `json:"date" gorm:"not null;uniqueIndex:idx_term_date"` // YYYY-MM-DD
+	Kind       string `json:"kind" gorm:"not null"`                           // holiday / workday
+	Name       string `json:"name"`                                           // 节日名称，如"国庆节"
+	FollowsCol *int   `json:"followsCol"`                                     // 补课日按星期几的课表上课 0-6，仅 workday 有效
+}
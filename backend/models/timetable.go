@@ -0,0 +1,44 @@
+package models
+
+import "gorm.io/gorm"
+
+// 排课任务状态
+const (
+	TimetableJobPending   = "pending"   // 等待运行
+	TimetableJobRunning   = "running"   // 正在求解
+	TimetableJobSucceeded = "succeeded" // 已生成草案
+	TimetableJobFailed    = "failed"    // 求解出错或服务重启中断
+	TimetableJobApplied   = "applied"   // 草案已写入课程表
+)
+
+// TimetableJob 自动排课任务，在后台运行并生成课程表草案
+type TimetableJob struct {
+	gorm.Model
+	TermID    uint   `json:"termId" gorm:"index"`
+	Status    string `json:"status" gorm:"not null;default:pending"`
+	Progress  int    `json:"progress"` // 0-100
+	Seed      int64  `json:"seed"`     // 随机种子，相同输入和种子得到相同草案
+	StartWeek int    `json:"startWeek"`
+	EndWeek   int    `json:"endWeek"`
+	Input     string `json:"-"`       // 排课输入 JSON
+	Placed    int    `json:"placed"`  // 已安排的课时数
+	Unplaced  string `json:"-"`       // 无法安排的课时 JSON
+	Penalty   int    `json:"penalty"` // 软约束罚分，越小越好
+	Message   string `json:"message"` // 失败原因
+}
+
+// TimetableLesson 排课草案中的一节课，按周重复写入 StartWeek 到 EndWeek
+type TimetableLesson struct {
+	gorm.Model
+	JobID       uint     `json:"jobId" gorm:"not null;index"`
+	ClassID     uint     `json:"classId"`
+	CourseID    uint     `json:"courseId"`
+	TeacherID   *uint    `json:"teacherId"`
+	RoomID      *uint    `json:"roomId"`
+	TimeSlotRow int      `json:"timeSlotRow"` // 0-4
+	TimeSlotCol int      `json:"timeSlotCol"` // 0-6
+	Class       Class    `json:"class" gorm:"foreignKey:ClassID"`
+	Course      Course   `json:"course" gorm:"foreignKey:CourseID"`
+	Teacher     *Teacher `json:"teacher,omitempty" gorm:"foreignKey:TeacherID"`
+	Room        *Room    `json:"room,omitempty" gorm:"foreignKey:RoomID"`
+}
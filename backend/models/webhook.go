@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// Webhook 投递状态
+const (
+	WebhookDeliveryPending   = "pending"   // 等待投递或重试
+	WebhookDeliveryDelivered = "delivered" // 接收方返回 2xx
+	WebhookDeliveryFailed    = "failed"    // 重试次数用完或订阅已停用
+)
+
+// WebhookSubscription Webhook 订阅，课程表和用户变更时向 URL 发送签名的 JSON
+type WebhookSubscription struct {
+	ID          uint      `json:"id" gorm:"primarykey"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+	URL         string    `json:"url" gorm:"not null"`
+	Secret      string    `json:"-" gorm:"not null"`      // HMAC-SHA256 签名密钥
+	Events      string    `json:"-" gorm:"not null"`      // 订阅的事件类型，逗号分隔，以 .* 结尾时按前缀匹配
+	Active      bool      `json:"active" gorm:"not null"` // 停用后不再产生新的投递
+	Description string    `json:"description"`
+}
+
+// WebhookDelivery 一次 Webhook 投递及其最近一次尝试的结果，同时作为持久化的投递队列
+type WebhookDelivery struct {
+	ID             uint       `json:"id" gorm:"primarykey"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+	SubscriptionID uint       `json:"subscriptionId" gorm:"not null;index"`
+	EventID        uint       `json:"eventId"` // 事件ID（产生事件的活动日志ID），与载荷中的 id 相同，接收方可据此去重
+	Event          string     `json:"event" gorm:"not null"`
+	Payload        string     `json:"-" gorm:"type:text;not null"`
+	Status         string     `json:"status" gorm:"not null;index:idx_webhook_due"`
+	Attempts       int        `json:"attempts" gorm:"not null;default:0"`
+	NextAttemptAt  time.Time  `json:"nextAttemptAt" gorm:"index:idx_webhook_due"`
+	LastAttemptAt  *time.Time `json:"lastAttemptAt"`
+	ResponseStatus int        `json:"responseStatus"` // 最近一次响应的状态码，没有收到响应时为 0
+	ResponseBody   string     `json:"responseBody"`   // 最近一次响应内容的开头
+	LastError      string     `json:"lastError"`
+	DeliveredAt    *time.Time `json:"deliveredAt"`
+	RedeliveryOf   *uint      `json:"redeliveryOf"` // 手动重新投递时为原投递的ID
+}
@@ -1,26 +1,42 @@
 package routes
 
 import (
-	"fmt"
 	"net/http"
 	"reschedule-program/database"
+	"reschedule-program/middleware"
 	"reschedule-program/models"
+	"reschedule-program/services"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 func AdminRoutes(r *gin.Engine) {
 	adminGroup := r.Group("/admin")
 	{
 		adminGroup.GET("/users", adminGetAllUsers)
-		adminGroup.PUT("/users/:id/password", adminUpdateUserPassword)
-		adminGroup.PUT("/users/:id", adminUpdateUser)
-		adminGroup.POST("/users", adminAddUser)
-		adminGroup.DELETE("/users/:id", adminDeleteUser)
+		adminGroup.PUT("/users/:id/password", middleware.AdminRequired(), adminUpdateUserPassword)
+		adminGroup.PUT("/users/:id", middleware.AdminRequired(), adminUpdateUser)
+		adminGroup.POST("/users", middleware.AdminRequired(), adminAddUser)
+		adminGroup.DELETE("/users/:id", middleware.AdminRequired(), adminDeleteUser)
 		adminGroup.GET("/classes", adminGetAllClasses)
 		adminGroup.GET("/courses", adminGetAllCourses)
 		adminGroup.GET("/schedules", adminGetAllSchedules)
-		adminGroup.GET("/logs", adminGetAllLogs)
+		adminGroup.GET("/logs", middleware.AdminRequired(), listLogs)
+		adminGroup.GET("/logs/retention", middleware.AdminRequired(), getLogRetention)
+		adminGroup.PUT("/logs/retention", middleware.AdminRequired(), updateLogRetention)
+		adminGroup.POST("/logs/prune", middleware.AdminRequired(), pruneLogs)
+		adminGroup.GET("/logs/archives/:name", middleware.AdminRequired(), downloadLogArchive)
+		adminGroup.GET("/backup", middleware.AdminRequired(), downloadBackup)
+		adminGroup.POST("/restore", middleware.AdminRequired(), restoreBackup)
+		adminGroup.GET("/webhooks", middleware.AdminRequired(), listWebhooks)
+		adminGroup.POST("/webhooks", middleware.AdminRequired(), createWebhook)
+		adminGroup.PUT("/webhooks/:id", middleware.AdminRequired(), updateWebhook)
+		adminGroup.DELETE("/webhooks/:id", middleware.AdminRequired(), deleteWebhook)
+		adminGroup.POST("/webhooks/:id/ping", middleware.AdminRequired(), pingWebhook)
+		adminGroup.GET("/webhooks/:id/deliveries", middleware.AdminRequired(), listWebhookDeliveries)
+		adminGroup.GET("/webhook-deliveries/:id", middleware.AdminRequired(), getWebhookDelivery)
+		adminGroup.POST("/webhook-deliveries/:id/redeliver", middleware.AdminRequired(), redeliverWebhook)
 	}
 }
 
@@ -48,12 +64,6 @@ func adminGetAllSchedules(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"schedules": schedules})
 }
 
-func adminGetAllLogs(c *gin.Context) {
-	var logs []models.ActivityLog
-	database.DB.Find(&logs)
-	c.JSON(http.StatusOK, gin.H{"logs": logs})
-}
-
 // adminUpdateUserPassword 管理员修改用户密码
 func adminUpdateUserPassword(c *gin.Context) {
 	userID := c.Param("id")
@@ -73,19 +83,21 @@ func adminUpdateUserPassword(c *gin.Context) {
 		return
 	}
 
-	// 更新密码
+	// 更新密码并记录日志
 	user.Password = request.NewPassword
-	if err := database.DB.Save(&user).Error; err != nil {
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+		return services.RecordActivity(tx, middleware.CurrentActor(c), services.ActivityEvent{
+			Action: models.ActivityUserPassword, EntityType: models.EntityUser, EntityID: user.UserID, EntityName: user.Username,
+		})
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
 		return
 	}
 
-	// 记录日志
-	logEntry := &models.ActivityLog{
-		Message: "Admin updated user password: " + user.Username,
-	}
-	database.DB.Create(logEntry)
-
 	c.JSON(http.StatusOK, gin.H{"message": "Password updated successfully"})
 }
 
@@ -133,24 +145,27 @@ func adminUpdateUser(c *gin.Context) {
 		return
 	}
 
-	// 更新用户信息
-	oldUsername := user.Username
+	// 更新用户信息并记录日志
+	before := services.UserActivityData(user)
 	user.UserID = request.NewUserID
 	user.Username = request.NewUsername
 	user.Password = request.NewPassword
 	user.UserType = request.NewUserType
 
-	if err := database.DB.Save(&user).Error; err != nil {
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+		return services.RecordActivity(tx, middleware.CurrentActor(c), services.ActivityEvent{
+			Action: models.ActivityUserUpdate, EntityType: models.EntityUser, EntityID: user.UserID, EntityName: user.Username,
+			Before: before, After: services.UserActivityData(user),
+		})
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
 		return
 	}
 
-	// 记录日志
-	logEntry := &models.ActivityLog{
-		Message: fmt.Sprintf("Admin updated user information: %s -> %s", oldUsername, user.Username),
-	}
-	database.DB.Create(logEntry)
-
 	c.JSON(http.StatusOK, gin.H{"message": "User information updated successfully"})
 }
 
@@ -189,15 +204,20 @@ func adminAddUser(c *gin.Context) {
 	if user.UserType == "" {
 		user.UserType = "viewer"
 	}
-	if err := database.DB.Create(&user).Error; err != nil {
+	// 添加用户并记录日志
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return services.RecordActivity(tx, middleware.CurrentActor(c), services.ActivityEvent{
+			Action: models.ActivityUserCreate, EntityType: models.EntityUser, EntityID: user.UserID, EntityName: user.Username,
+			After: services.UserActivityData(user),
+		})
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add user, username may already exist"})
 		return
 	}
-	// 记录日志
-	logEntry := &models.ActivityLog{
-		Message: "Admin added user: " + user.Username,
-	}
-	database.DB.Create(logEntry)
 	c.JSON(http.StatusOK, gin.H{"message": "User added successfully", "user": user})
 }
 
@@ -210,14 +230,18 @@ func adminDeleteUser(c *gin.Context) {
 		return
 	}
 	// 使用Unscoped().Delete()进行硬删除，真正删除记录
-	if err := database.DB.Unscoped().Delete(&user).Error; err != nil {
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Delete(&user).Error; err != nil {
+			return err
+		}
+		return services.RecordActivity(tx, middleware.CurrentActor(c), services.ActivityEvent{
+			Action: models.ActivityUserDelete, EntityType: models.EntityUser, EntityID: user.UserID, EntityName: user.Username,
+			Before: services.UserActivityData(user),
+		})
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
 		return
 	}
-	// 记录日志
-	logEntry := &models.ActivityLog{
-		Message: "Admin deleted user: " + user.Username,
-	}
-	database.DB.Create(logEntry)
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
 }
@@ -0,0 +1,41 @@
+package routes
+
+import (
+	"net/http"
+	"reschedule-program/database"
+	"reschedule-program/models"
+	"testing"
+)
+
+func TestAdminUserWritesRequireAdmin(t *testing.T) {
+	setupTestDB(t)
+	router := newTestRouter()
+	AdminRoutes(router)
+	editorToken := loginAs(t, router, "user")
+
+	password := map[string]string{"newPassword": "changed1"}
+	path := "/admin/users/1234567890/password"
+	if recorder := serveJSON(router, http.MethodPut, path, "", password); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous password change: status %d, want 401", recorder.Code)
+	}
+	if recorder := serveJSON(router, http.MethodPut, path, editorToken, password); recorder.Code != http.StatusForbidden {
+		t.Errorf("editor password change: status %d, want 403", recorder.Code)
+	}
+	if recorder := serveJSON(router, http.MethodDelete, "/admin/users/1234567890", "", nil); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous delete: status %d, want 401", recorder.Code)
+	}
+
+	adminToken := login(t, router, "Admin", "88888888")
+	if recorder := serveJSON(router, http.MethodPut, path, adminToken, password); recorder.Code != http.StatusOK {
+		t.Fatalf("admin password change: status %d %s", recorder.Code, recorder.Body)
+	}
+
+	// 活动日志记录操作的管理员
+	var entry models.ActivityLog
+	if err := database.DB.Where("action = ?", models.ActivityUserPassword).First(&entry).Error; err != nil {
+		t.Fatalf("load activity: %v", err)
+	}
+	if entry.ActorName != "Admin" {
+		t.Errorf("password change logged by %q, want Admin", entry.ActorName)
+	}
+}
@@ -2,14 +2,17 @@ package routes
 
 import (
 	"regexp"
+	"reschedule-program/middleware"
 	"reschedule-program/models"
 	"reschedule-program/services"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
 func AuthRoutes(r *gin.Engine) {
 	userService := services.NewUserService()
+	sessionService := services.NewSessionService()
 
 	r.POST("/register", func(c *gin.Context) {
 		var user struct {
@@ -48,7 +51,10 @@ func AuthRoutes(r *gin.Engine) {
 			UserType: "viewer", // 默认为观察者用户
 		}
 
-		if err := userService.CreateUser(newUser); err != nil {
+		// 自助注册的操作人为新用户本人
+		actor := middleware.CurrentActor(c)
+		actor.UserID, actor.Username = newUser.UserID, newUser.Username
+		if err := userService.CreateUser(actor, newUser); err != nil {
 			c.JSON(500, gin.H{"msg": "Failed to create user"})
 			return
 		}
@@ -69,10 +75,16 @@ func AuthRoutes(r *gin.Engine) {
 
 		// 优先检查admin用户
 		if user.Username == "Admin" && user.Password == "88888888" {
+			session, err := sessionService.CreateSession("", "Admin", "admin")
+			if err != nil {
+				c.JSON(500, gin.H{"msg": "Failed to create session"})
+				return
+			}
 			c.JSON(200, gin.H{
 				"msg":      "Login success",
 				"userType": "admin",
 				"username": "Admin",
+				"token":    session.Token,
 			})
 			return
 		}
@@ -84,10 +96,26 @@ func AuthRoutes(r *gin.Engine) {
 			return
 		}
 
+		session, err := sessionService.CreateSession(dbUser.UserID, dbUser.Username, dbUser.UserType)
+		if err != nil {
+			c.JSON(500, gin.H{"msg": "Failed to create session"})
+			return
+		}
+
 		c.JSON(200, gin.H{
 			"msg":      "Login success",
 			"userType": dbUser.UserType,
 			"username": dbUser.Username,
+			"userID":   dbUser.UserID,
+			"token":    session.Token,
 		})
 	})
+
+	r.POST("/logout", func(c *gin.Context) {
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if token != "" {
+			sessionService.DeleteSession(token)
+		}
+		c.JSON(200, gin.H{"msg": "Logout success"})
+	})
 }
@@ -0,0 +1,86 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"reschedule-program/middleware"
+	"reschedule-program/services"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// backupErrorStatus 将备份和恢复错误映射为HTTP状态码
+func backupErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidBackup), errors.Is(err, services.ErrBackupVersion):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrDatabaseNotEmpty):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrBackupCountsWrong):
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
+
+// downloadBackup 下载整个数据库的备份，?format=zip（默认）或 json
+func downloadBackup(c *gin.Context) {
+	format := c.DefaultQuery("format", services.BackupFormatZip)
+	contentType := "application/zip"
+	switch format {
+	case services.BackupFormatZip:
+	case services.BackupFormatJSON:
+		contentType = "application/json"
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be zip or json"})
+		return
+	}
+
+	filename := fmt.Sprintf("reschedule-backup-%s.%s", time.Now().UTC().Format("20060102-150405"), format)
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Status(http.StatusOK)
+	if _, err := services.WriteBackup(c.Writer, format); err != nil {
+		// 响应已经开始，只能中断
+		log.Println("Failed to write backup:", err)
+		c.Abort()
+	}
+}
+
+// restoreBackup 从上传的备份（multipart 的 file 字段或请求体）恢复到空数据库
+func restoreBackup(c *gin.Context) {
+	upload, err := importFile(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Backup file is required: " + err.Error()})
+		return
+	}
+	defer upload.Close()
+
+	// zip 归档需要随机读取，先保存到临时文件
+	file, err := os.CreateTemp("", "reschedule-restore-*")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore backup: " + err.Error()})
+		return
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	if _, err := io.Copy(file, upload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read backup: " + err.Error()})
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore backup: " + err.Error()})
+		return
+	}
+
+	result, err := services.RestoreBackup(middleware.CurrentActor(c), file)
+	if err != nil {
+		c.JSON(backupErrorStatus(err), gin.H{"error": "Failed to restore backup: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Backup restored successfully", "result": result})
+}
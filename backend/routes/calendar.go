@@ -0,0 +1,185 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reschedule-program/middleware"
+	"reschedule-program/services"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func CalendarRoutes(r *gin.Engine) {
+	feedGroup := r.Group("/api/calendar-feeds", middleware.AuthRequired())
+	{
+		feedGroup.GET("", getCalendarFeeds)
+		feedGroup.POST("", createCalendarFeed)
+		feedGroup.POST("/:id/regenerate", regenerateCalendarFeed)
+		feedGroup.DELETE("/:id", revokeCalendarFeed)
+	}
+
+	// 订阅链接不需要登录，密钥即凭证
+	r.GET("/api/calendar/feeds/:file", getFeedCalendar)
+}
+
+// calendarErrorStatus 将日历导出错误映射为HTTP状态码
+func calendarErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrTermNotFound), errors.Is(err, services.ErrNoActiveTerm),
+		errors.Is(err, services.ErrFeedNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidFeedScope):
+		return http.StatusBadRequest
+	}
+	return scheduleErrorStatus(err)
+}
+
+// parseTermQuery 解析可选的 ?termId= 参数，未指定时为 0（当前学期）
+func parseTermQuery(c *gin.Context) (uint, bool) {
+	value := c.Query("termId")
+	if value == "" {
+		return 0, true
+	}
+	id, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || id == 0 {
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// notModified 按 If-None-Match 或 If-Modified-Since 判断客户端缓存的日历是否仍然有效，
+// 同时提供两者时以 If-None-Match 为准
+func notModified(c *gin.Context, etag string, modified time.Time) bool {
+	if match := c.GetHeader("If-None-Match"); match != "" {
+		for _, tag := range strings.Split(match, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" || tag == etag {
+				return true
+			}
+		}
+		return false
+	}
+	since, err := http.ParseTime(c.GetHeader("If-Modified-Since"))
+	return err == nil && !modified.Truncate(time.Second).After(since)
+}
+
+// calendarCacheHeaders 设置日历的缓存校验响应头
+func calendarCacheHeaders(c *gin.Context, etag string, modified time.Time) {
+	c.Header("ETag", etag)
+	c.Header("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	c.Header("Cache-Control", "no-cache")
+}
+
+// respondCalendar 返回 iCalendar 文件，带 ETag 和 Last-Modified，客户端缓存有效时返回 304
+func respondCalendar(c *gin.Context, calendar *services.Calendar, modified time.Time, filename string) {
+	etag := `"` + calendar.ETag() + `"`
+	calendarCacheHeaders(c, etag, modified)
+	if notModified(c, etag, modified) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="%s"`, filename))
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(calendar.Content))
+}
+
+// getClassCalendar 导出班级课程表为 iCalendar 文件，默认为当前学期已发布的课程表；
+// 可用 ?termId= 指定学期，?draft=true 导出草稿
+func getClassCalendar(c *gin.Context) {
+	termID, ok := parseTermQuery(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid term ID"})
+		return
+	}
+
+	draft, ok := parseDraftQuery(c)
+	if !ok {
+		return
+	}
+
+	calendar, err := services.ClassCalendar(c.Param("className"), termID, draft)
+	if err != nil {
+		c.JSON(calendarErrorStatus(err), gin.H{"error": "Failed to export calendar: " + err.Error()})
+		return
+	}
+	respondCalendar(c, calendar, calendar.LastModified, "timetable.ics")
+}
+
+// getCalendarFeeds 获取当前用户的日历订阅
+func getCalendarFeeds(c *gin.Context) {
+	feeds, err := services.GetCalendarFeeds(middleware.CurrentSession(c))
+	if err != nil {
+		c.JSON(calendarErrorStatus(err), gin.H{"error": "Failed to get calendar feeds: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"feeds": feeds})
+}
+
+// createCalendarFeed 创建班级、教师或教室的日历订阅，返回订阅链接
+func createCalendarFeed(c *gin.Context) {
+	var data services.FeedData
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	feed, err := services.CreateCalendarFeed(middleware.CurrentActor(c), middleware.CurrentSession(c), data)
+	if err != nil {
+		c.JSON(calendarErrorStatus(err), gin.H{"error": "Failed to create calendar feed: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"message": "Calendar feed created successfully", "feed": feed})
+}
+
+// regenerateCalendarFeed 为日历订阅生成新的链接，原链接失效
+func regenerateCalendarFeed(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid feed ID"})
+		return
+	}
+
+	feed, err := services.RegenerateCalendarFeed(middleware.CurrentActor(c), middleware.CurrentSession(c), id)
+	if err != nil {
+		c.JSON(calendarErrorStatus(err), gin.H{"error": "Failed to regenerate calendar feed: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Calendar feed regenerated successfully", "feed": feed})
+}
+
+// revokeCalendarFeed 撤销日历订阅
+func revokeCalendarFeed(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid feed ID"})
+		return
+	}
+
+	if err := services.RevokeCalendarFeed(middleware.CurrentActor(c), middleware.CurrentSession(c), id); err != nil {
+		c.JSON(calendarErrorStatus(err), gin.H{"error": "Failed to revoke calendar feed: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Calendar feed revoked successfully"})
+}
+
+// getFeedCalendar 按订阅链接返回日历，路径为 /api/calendar/feeds/<token>.ics
+func getFeedCalendar(c *gin.Context) {
+	token := strings.TrimSuffix(c.Param("file"), ".ics")
+	result, err := services.FeedCalendar(token, func(etag string, changedAt time.Time) bool {
+		return notModified(c, `"`+etag+`"`, changedAt)
+	})
+	if err != nil {
+		c.JSON(calendarErrorStatus(err), gin.H{"error": "Failed to get calendar feed: " + err.Error()})
+		return
+	}
+	// 数据未变化且客户端缓存有效，未生成日历
+	if result.Calendar == nil {
+		calendarCacheHeaders(c, `"`+result.ETag+`"`, result.ChangedAt)
+		c.Status(http.StatusNotModified)
+		return
+	}
+	respondCalendar(c, result.Calendar, result.ChangedAt, "timetable.ics")
+}
@@ -0,0 +1,131 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"reschedule-program/middleware"
+	"reschedule-program/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func ClassRoutes(r *gin.Engine) {
+	classGroup := r.Group("/api/classes", middleware.AdminRequired())
+	{
+		classGroup.GET("", listClasses)
+		classGroup.POST("", createClass)
+		classGroup.PUT("/:id", updateClass)
+		classGroup.POST("/:id/archive", archiveClass)
+		classGroup.POST("/:id/unarchive", unarchiveClass)
+		classGroup.DELETE("/:id", deleteClass)
+	}
+}
+
+// classErrorStatus 将班级相关错误映射为HTTP状态码
+func classErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrClassNotFound), errors.Is(err, services.ErrOwnerNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidClassName), errors.Is(err, services.ErrInvalidClassSize):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrClassExists), errors.Is(err, services.ErrClassHasSchedules),
+		errors.Is(err, services.ErrClassArchived):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// listClasses 获取班级列表，?includeArchived=true 时包含已归档班级
+func listClasses(c *gin.Context) {
+	classes, err := services.ListClasses(c.Query("includeArchived") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get classes: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"classes": classes})
+}
+
+// createClass 创建班级
+func createClass(c *gin.Context) {
+	var request services.ClassData
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	class, err := services.CreateClass(middleware.CurrentActor(c), request)
+	if err != nil {
+		c.JSON(classErrorStatus(err), gin.H{"error": "Failed to create class: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Class created successfully", "class": class})
+}
+
+// updateClass 重命名班级或修改班级人数
+func updateClass(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid class ID"})
+		return
+	}
+
+	var request services.ClassData
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	class, err := services.UpdateClass(middleware.CurrentActor(c), id, request)
+	if err != nil {
+		c.JSON(classErrorStatus(err), gin.H{"error": "Failed to update class: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Class updated successfully", "class": class})
+}
+
+// archiveClass 归档班级
+func archiveClass(c *gin.Context) {
+	setClassArchived(c, true)
+}
+
+// unarchiveClass 取消归档班级
+func unarchiveClass(c *gin.Context) {
+	setClassArchived(c, false)
+}
+
+func setClassArchived(c *gin.Context, archived bool) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid class ID"})
+		return
+	}
+
+	class, err := services.SetClassArchived(middleware.CurrentActor(c), id, archived)
+	if err != nil {
+		c.JSON(classErrorStatus(err), gin.H{"error": "Failed to update class: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Class updated successfully", "class": class})
+}
+
+// deleteClass 删除班级，?cascade=true 时同时删除该班级的所有课程
+func deleteClass(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid class ID"})
+		return
+	}
+
+	_, deleted, err := services.DeleteClass(middleware.CurrentActor(c), id, c.Query("cascade") == "true")
+	if err != nil {
+		c.JSON(classErrorStatus(err), gin.H{"error": "Failed to delete class: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Class deleted successfully", "deletedSchedules": deleted})
+}
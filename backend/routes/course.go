@@ -0,0 +1,165 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"reschedule-program/middleware"
+	"reschedule-program/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func CourseRoutes(r *gin.Engine) {
+	courseGroup := r.Group("/api/courses")
+	{
+		courseGroup.GET("", getAllCourses)
+		courseGroup.GET("/:id", getCourse)
+	}
+
+	adminCourseGroup := r.Group("/api/courses", middleware.AdminRequired())
+	{
+		adminCourseGroup.POST("", createCourse)
+		adminCourseGroup.PUT("/:id", updateCourse)
+		adminCourseGroup.DELETE("/:id", deleteCourse)
+		adminCourseGroup.POST("/merge", mergeCourses)
+	}
+}
+
+// courseErrorStatus 将课程相关错误映射为HTTP状态码
+func courseErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrCourseNotFound), errors.Is(err, services.ErrTeacherNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidCourse), errors.Is(err, services.ErrInvalidMergeList):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrCourseExists), errors.Is(err, services.ErrCourseInUse),
+		errors.Is(err, services.ErrScheduleConflict):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// respondCourseWrite 返回会改变任课教师的课程修改的错误或预览结果，与课程表写操作相同：
+// 存在教师冲突时返回 409 和冲突列表，?dryRun=true 时返回冲突和容量警告。需要继续返回结果时为 true
+func respondCourseWrite(c *gin.Context, result *services.WriteResult, err error, dryRun bool, failure string) bool {
+	if err != nil {
+		body := gin.H{"error": failure + err.Error()}
+		if errors.Is(err, services.ErrScheduleConflict) {
+			body["conflicts"] = result.Conflicts
+			body["warnings"] = result.Warnings
+		}
+		c.JSON(courseErrorStatus(err), body)
+		return false
+	}
+	if dryRun {
+		c.JSON(http.StatusOK, gin.H{"dryRun": true, "conflicts": result.Conflicts, "warnings": result.Warnings})
+		return false
+	}
+	return true
+}
+
+// getAllCourses 获取课程目录
+func getAllCourses(c *gin.Context) {
+	courses, err := services.GetAllCourses()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get courses: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"courses": courses})
+}
+
+// getCourse 获取单个课程
+func getCourse(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid course ID"})
+		return
+	}
+
+	course, err := services.GetCourse(id)
+	if err != nil {
+		c.JSON(courseErrorStatus(err), gin.H{"error": "Failed to get course: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"course": course})
+}
+
+// createCourse 添加课程
+func createCourse(c *gin.Context) {
+	var data services.CourseData
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	course, err := services.CreateCourse(middleware.CurrentActor(c), data)
+	if err != nil {
+		c.JSON(courseErrorStatus(err), gin.H{"error": "Failed to create course: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Course created successfully", "course": course})
+}
+
+// updateCourse 更新课程
+func updateCourse(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid course ID"})
+		return
+	}
+
+	var data services.CourseData
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	dryRun := c.Query("dryRun") == "true"
+	course, result, err := services.UpdateCourse(middleware.CurrentActor(c), id, data, dryRun)
+	if !respondCourseWrite(c, result, err, dryRun, "Failed to update course: ") {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Course updated successfully", "course": course})
+}
+
+// deleteCourse 删除课程
+func deleteCourse(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid course ID"})
+		return
+	}
+
+	_, err := services.DeleteCourse(middleware.CurrentActor(c), id)
+	if err != nil {
+		c.JSON(courseErrorStatus(err), gin.H{"error": "Failed to delete course: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Course deleted successfully"})
+}
+
+// mergeCourses 合并重复课程
+func mergeCourses(c *gin.Context) {
+	var request struct {
+		TargetID  uint   `json:"targetId" binding:"required"`
+		SourceIDs []uint `json:"sourceIds" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Target ID and source IDs are required"})
+		return
+	}
+
+	dryRun := c.Query("dryRun") == "true"
+	result, check, err := services.MergeCourses(middleware.CurrentActor(c), request.TargetID, request.SourceIDs, dryRun)
+	if !respondCourseWrite(c, check, err, dryRun, "Failed to merge courses: ") {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Courses merged successfully", "result": result})
+}
@@ -0,0 +1,86 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reschedule-program/services"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// scheduleEventHeartbeat 没有事件时发送注释行的间隔，避免代理断开空闲连接
+const scheduleEventHeartbeat = 25 * time.Second
+
+// writeScheduleEvent 以 Server-Sent Events 格式写出一个事件
+func writeScheduleEvent(c *gin.Context, event services.ScheduleEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
+
+// streamScheduleEvents 以 Server-Sent Events 推送班级课程表（草稿）的变更，只限管理员。
+// 重连时按 Last-Event-ID 请求头或 ?lastEventId= 补发断开期间的变更
+func streamScheduleEvents(c *gin.Context) {
+	var lastEventID uint
+	value := c.GetHeader("Last-Event-ID")
+	if value == "" {
+		value = c.Query("lastEventId")
+	}
+	if value != "" {
+		id, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid last event ID"})
+			return
+		}
+		lastEventID = uint(id)
+	}
+
+	subscription, replay, err := services.SubscribeScheduleEvents(c.Param("className"), lastEventID)
+	if err != nil {
+		c.JSON(scheduleErrorStatus(err), gin.H{"error": "Failed to subscribe to schedule events: " + err.Error()})
+		return
+	}
+	defer subscription.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	// 1. 补发断开期间的变更（或 ready / reset）
+	for _, event := range replay {
+		if err := writeScheduleEvent(c, event); err != nil {
+			return
+		}
+	}
+	c.Writer.Flush()
+
+	// 2. 推送新的变更，订阅被断开时结束，客户端重连后补齐
+	heartbeat := time.NewTicker(scheduleEventHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event, ok := <-subscription.Events:
+			if !ok {
+				return
+			}
+			if err := writeScheduleEvent(c, event); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(c.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+		c.Writer.Flush()
+	}
+}
@@ -0,0 +1,127 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"reschedule-program/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportErrorStatus 将导出错误映射为HTTP状态码
+func exportErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidExportScope), errors.Is(err, services.ErrInvalidPDFWeek):
+		return http.StatusBadRequest
+	}
+	return calendarErrorStatus(err)
+}
+
+// parseExportOptions 解析导出参数：?scope=class|teacher|room|term，班级用 className 或 targetId，
+// 教师和教室用 targetId；可选 termId 和 draft
+func parseExportOptions(c *gin.Context) (services.ExportOptions, bool) {
+	termID, ok := parseTermQuery(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid term ID"})
+		return services.ExportOptions{}, false
+	}
+	draft, ok := parseDraftQuery(c)
+	if !ok {
+		return services.ExportOptions{}, false
+	}
+	options := services.ExportOptions{
+		Scope:     c.DefaultQuery("scope", "class"),
+		ClassName: c.Query("className"),
+		TermID:    termID,
+		Draft:     draft,
+	}
+	if value := c.Query("targetId"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 32)
+		if err != nil || id == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid target ID"})
+			return services.ExportOptions{}, false
+		}
+		options.TargetID = uint(id)
+	}
+	return options, true
+}
+
+// prepareExport 解析导出参数并确定导出范围
+func prepareExport(c *gin.Context) (*services.Export, bool) {
+	options, ok := parseExportOptions(c)
+	if !ok {
+		return nil, false
+	}
+	export, err := services.PrepareExport(options)
+	if err != nil {
+		c.JSON(exportErrorStatus(err), gin.H{"error": "Failed to export schedule: " + err.Error()})
+		return nil, false
+	}
+	return export, true
+}
+
+// startDownload 写出下载的响应头，此后内容直接流式写入响应
+func startDownload(c *gin.Context, export *services.Export, contentType string, ext string) {
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="timetable.%s"; filename*=UTF-8''%s.%s`,
+		ext, url.PathEscape(export.Name), ext))
+	c.Status(http.StatusOK)
+}
+
+// exportScheduleCSV 以长格式 CSV 导出课程表，每周每节课一行
+func exportScheduleCSV(c *gin.Context) {
+	export, ok := prepareExport(c)
+	if !ok {
+		return
+	}
+	startDownload(c, export, "text/csv; charset=utf-8", "csv")
+	if err := export.WriteCSV(c.Writer); err != nil {
+		// 响应已经开始，只能中断
+		log.Println("Failed to export schedule CSV:", err)
+		c.Abort()
+	}
+}
+
+// exportScheduleXLSX 导出 XLSX 工作簿，每周一个工作表
+func exportScheduleXLSX(c *gin.Context) {
+	export, ok := prepareExport(c)
+	if !ok {
+		return
+	}
+	startDownload(c, export, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "xlsx")
+	if err := export.WriteXLSX(c.Writer); err != nil {
+		log.Println("Failed to export schedule XLSX:", err)
+		c.Abort()
+	}
+}
+
+// exportSchedulePDF 生成打印用的课程表 PDF：?week=N 为该周的课程表，不指定时为整个学期的汇总；
+// scope 为 class、teacher 或 room
+func exportSchedulePDF(c *gin.Context) {
+	options, ok := parseExportOptions(c)
+	if !ok {
+		return
+	}
+	week := 0
+	if value := c.Query("week"); value != "" {
+		var err error
+		if week, err = strconv.Atoi(value); err != nil || week < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid week number"})
+			return
+		}
+	}
+
+	document, err := services.RenderTimetablePDF(options, week)
+	if err != nil {
+		c.JSON(exportErrorStatus(err), gin.H{"error": "Failed to render PDF: " + err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="timetable.pdf"; filename*=UTF-8''%s.pdf`,
+		url.PathEscape(document.Name)))
+	c.Header("Last-Modified", document.LastModified.Format(http.TimeFormat))
+	c.Data(http.StatusOK, "application/pdf", document.Content)
+}
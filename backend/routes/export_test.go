@@ -0,0 +1,37 @@
+package routes
+
+import (
+	"bytes"
+	"net/http"
+	"reschedule-program/database"
+	"reschedule-program/models"
+	"testing"
+)
+
+func TestExportSchedulePDF(t *testing.T) {
+	setupTestDB(t)
+	router := newTestRouter()
+	for _, value := range []interface{}{
+		&models.Term{Name: "2026 秋季学期", StartDate: "2026-09-07", WeekCount: 18, Active: true},
+		&models.Class{Name: "计算机一班"},
+		&models.Course{Name: "高等数学"},
+		&models.PublishedSchedule{TermID: 1, ClassID: 1, CourseID: 1, WeekNumber: 1},
+	} {
+		if err := database.DB.Create(value).Error; err != nil {
+			t.Fatalf("create %T: %v", value, err)
+		}
+	}
+
+	// 字体编译在程序中，运行目录下不需要字体文件
+	t.Chdir(t.TempDir())
+	recorder := serveJSON(router, http.MethodGet, "/api/schedule/export.pdf?className=计算机一班&week=1", "", nil)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d %s", recorder.Code, recorder.Body)
+	}
+	if got := recorder.Header().Get("Content-Type"); got != "application/pdf" {
+		t.Errorf("Content-Type = %q, want application/pdf", got)
+	}
+	if !bytes.HasPrefix(recorder.Body.Bytes(), []byte("%PDF-")) {
+		t.Errorf("body is not a PDF: %.40q", recorder.Body)
+	}
+}
@@ -0,0 +1,128 @@
+package routes
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"reschedule-program/middleware"
+	"reschedule-program/services"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// importErrorStatus 将导入错误映射为HTTP状态码
+func importErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidImport):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrImportRejected):
+		return http.StatusUnprocessableEntity
+	}
+	return calendarErrorStatus(err)
+}
+
+// importFile 读取上传的文件：multipart 表单的 file 字段，或直接以请求体上传
+func importFile(c *gin.Context) (io.ReadCloser, error) {
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		header, err := c.FormFile("file")
+		if err != nil {
+			return nil, err
+		}
+		return header.Open()
+	}
+	return c.Request.Body, nil
+}
+
+// importScheduleCSV 从CSV导入课程表，?dryRun=true 只检查；存在错误时不写入并返回 422 和各行的错误
+func importScheduleCSV(c *gin.Context) {
+	termID, ok := parseTermQuery(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid term ID"})
+		return
+	}
+	file, err := importFile(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "CSV file is required: " + err.Error()})
+		return
+	}
+	defer file.Close()
+
+	result, err := services.ImportScheduleCSV(middleware.CurrentActor(c), file, services.ImportOptions{
+		TermID:               termID,
+		DryRun:               c.Query("dryRun") == "true",
+		Replace:              c.Query("replace") == "true",
+		RejectUnknownCourses: c.Query("rejectUnknownCourses") == "true",
+	})
+	if errors.Is(err, services.ErrImportRejected) {
+		c.JSON(importErrorStatus(err), gin.H{"error": err.Error(), "result": result})
+		return
+	}
+	if err != nil {
+		c.JSON(importErrorStatus(err), gin.H{"error": "Failed to import schedule: " + err.Error()})
+		return
+	}
+	if result.DryRun {
+		c.JSON(http.StatusOK, gin.H{"message": "Import file is valid", "result": result})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Schedule imported successfully", "result": result})
+}
+
+// importScheduleFET 从 FET 导入课程表：multipart 的 fet 字段为 .fet 文件，可选的 solution 字段为
+// FET 生成的活动结果文件（*_activities.xml），也可直接以请求体上传已保存结果的 .fet 文件。
+// ?weeks= 为写入的周次，?dryRun=true 只检查；无法对应的数据在 unmapped 中列出
+func importScheduleFET(c *gin.Context) {
+	termID, ok := parseTermQuery(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid term ID"})
+		return
+	}
+
+	var fet, solution io.ReadCloser
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		header, err := c.FormFile("fet")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "FET file is required: " + err.Error()})
+			return
+		}
+		if fet, err = header.Open(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "FET file is required: " + err.Error()})
+			return
+		}
+		defer fet.Close()
+		if header, err := c.FormFile("solution"); err == nil {
+			if solution, err = header.Open(); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read solution file: " + err.Error()})
+				return
+			}
+			defer solution.Close()
+		}
+	} else {
+		fet = c.Request.Body
+	}
+
+	options := services.FETImportOptions{
+		ImportOptions: services.ImportOptions{
+			TermID:               termID,
+			DryRun:               c.Query("dryRun") == "true",
+			Replace:              c.Query("replace") == "true",
+			RejectUnknownCourses: c.Query("rejectUnknownCourses") == "true",
+		},
+		Weeks: c.Query("weeks"),
+	}
+	result, err := services.ImportFET(middleware.CurrentActor(c), fet, solution, options)
+	if errors.Is(err, services.ErrImportRejected) {
+		c.JSON(importErrorStatus(err), gin.H{"error": err.Error(), "result": result})
+		return
+	}
+	if err != nil {
+		c.JSON(importErrorStatus(err), gin.H{"error": "Failed to import FET timetable: " + err.Error()})
+		return
+	}
+	if result.DryRun {
+		c.JSON(http.StatusOK, gin.H{"message": "FET timetable is valid", "result": result})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "FET timetable imported successfully", "result": result})
+}
@@ -0,0 +1,233 @@
+package routes
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reschedule-program/middleware"
+	"reschedule-program/models"
+	"reschedule-program/services"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func LogRoutes(r *gin.Engine) {
+	logGroup := r.Group("/api/logs", middleware.AuthRequired())
+	{
+		logGroup.GET("", listLogs)
+	}
+}
+
+// logErrorStatus 将日志查询错误映射为HTTP状态码
+func logErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidLogQuery), errors.Is(err, services.ErrInvalidRetentionPolicy):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrClassNotFound), errors.Is(err, services.ErrLogArchiveNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// parseLogQuery 解析日志查询参数
+func parseLogQuery(c *gin.Context) (services.LogQuery, error) {
+	query := services.LogQuery{
+		Actor:     c.Query("actor"),
+		ClassName: c.Query("class"),
+		Text:      c.Query("q"),
+	}
+	for _, action := range strings.Split(c.Query("action"), ",") {
+		if action = strings.TrimSpace(action); action != "" {
+			query.Actions = append(query.Actions, action)
+		}
+	}
+
+	for name, target := range map[string]**time.Time{"from": &query.From, "to": &query.To} {
+		if value := c.Query(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return query, fmt.Errorf("%w: %s must be an RFC 3339 time", services.ErrInvalidLogQuery, name)
+			}
+			*target = &parsed
+		}
+	}
+	if value := c.Query("cursor"); value != "" {
+		cursor, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return query, fmt.Errorf("%w: invalid cursor", services.ErrInvalidLogQuery)
+		}
+		query.Before = uint(cursor)
+	}
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return query, fmt.Errorf("%w: invalid limit", services.ErrInvalidLogQuery)
+		}
+		query.Limit = limit
+	}
+	return query, nil
+}
+
+// listLogs 查询活动日志，最新的在前；?format=csv 或 ?format=json 导出全部符合条件的日志
+func listLogs(c *gin.Context) {
+	query, err := parseLogQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	session := middleware.CurrentSession(c)
+	switch c.Query("format") {
+	case "":
+		page, err := services.QueryLogs(session, query)
+		if err != nil {
+			c.JSON(logErrorStatus(err), gin.H{"error": "Failed to get logs: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, page)
+	case "csv":
+		exportLogsCSV(c, session, query)
+	case "json":
+		exportLogsJSON(c, session, query)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Format must be csv or json"})
+	}
+}
+
+// logCSVHeader 导出CSV的表头
+var logCSVHeader = []string{"id", "createdAt", "actorId", "actorName", "action", "entityType", "entityId", "entityName",
+	"classId", "clientIp", "requestId", "message", "before", "after"}
+
+// exportLogsCSV 以CSV流式导出日志
+func exportLogsCSV(c *gin.Context, session *models.Session, query services.LogQuery) {
+	writer := csv.NewWriter(c.Writer)
+	// 读到第一批日志后才开始输出，此前的查询错误仍可返回错误状态码
+	started := false
+	start := func() {
+		if !started {
+			started = true
+			startExport(c, "text/csv; charset=utf-8", "activity_logs.csv")
+			writer.Write(logCSVHeader)
+		}
+	}
+
+	err := services.ExportLogs(session, query, func(entry models.ActivityLog) error {
+		start()
+		classID := ""
+		if entry.ClassID != nil {
+			classID = strconv.FormatUint(uint64(*entry.ClassID), 10)
+		}
+		return writer.Write([]string{
+			strconv.FormatUint(uint64(entry.ID), 10), entry.CreatedAt.Format(time.RFC3339), entry.ActorID, entry.ActorName,
+			entry.Action, entry.EntityType, entry.EntityID, entry.EntityName, classID, entry.ClientIP, entry.RequestID,
+			entry.Message, string(entry.Before), string(entry.After),
+		})
+	})
+	if err != nil && !started {
+		c.JSON(logErrorStatus(err), gin.H{"error": "Failed to export logs: " + err.Error()})
+		return
+	}
+	start()
+	writer.Flush()
+	if err == nil {
+		err = writer.Error()
+	}
+	if err != nil {
+		c.Error(err)
+	}
+}
+
+// exportLogsJSON 以JSON数组流式导出日志
+func exportLogsJSON(c *gin.Context, session *models.Session, query services.LogQuery) {
+	started := false
+	start := func() {
+		if !started {
+			started = true
+			startExport(c, "application/json; charset=utf-8", "activity_logs.json")
+			c.Writer.WriteString("[")
+		}
+	}
+
+	count := 0
+	err := services.ExportLogs(session, query, func(entry models.ActivityLog) error {
+		start()
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			c.Writer.WriteString(",")
+		}
+		count++
+		c.Writer.WriteString("\n")
+		_, err = c.Writer.Write(data)
+		return err
+	})
+	if err != nil && !started {
+		c.JSON(logErrorStatus(err), gin.H{"error": "Failed to export logs: " + err.Error()})
+		return
+	}
+	start()
+	c.Writer.WriteString("\n]\n")
+	if err != nil {
+		c.Error(err)
+	}
+}
+
+// startExport 写入导出文件的响应头
+func startExport(c *gin.Context, contentType string, filename string) {
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Status(http.StatusOK)
+}
+
+// getLogRetention 获取日志保留策略、日志总数、待清理条数和归档文件
+func getLogRetention(c *gin.Context) {
+	status, err := services.GetLogRetentionStatus()
+	if err != nil {
+		c.JSON(logErrorStatus(err), gin.H{"error": "Failed to get log retention status: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// updateLogRetention 修改日志保留策略，返回修改后的状态
+func updateLogRetention(c *gin.Context) {
+	var data services.RetentionPolicyData
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := services.UpdateLogRetentionPolicy(middleware.CurrentActor(c), data); err != nil {
+		c.JSON(logErrorStatus(err), gin.H{"error": "Failed to update log retention policy: " + err.Error()})
+		return
+	}
+	getLogRetention(c)
+}
+
+// pruneLogs 立即按保留策略清理日志，?dryRun=true 时只返回将删除的条数
+func pruneLogs(c *gin.Context) {
+	result, err := services.PruneLogs(middleware.CurrentActor(c), c.Query("dryRun") == "true")
+	if err != nil {
+		c.JSON(logErrorStatus(err), gin.H{"error": "Failed to prune logs: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// downloadLogArchive 下载日志归档文件
+func downloadLogArchive(c *gin.Context) {
+	path, err := services.LogArchivePath(c.Param("name"))
+	if err != nil {
+		c.JSON(logErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.FileAttachment(path, c.Param("name"))
+}
@@ -0,0 +1,47 @@
+package routes
+
+import (
+	"net/http"
+	"reschedule-program/middleware"
+	"reschedule-program/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseIDParam 解析路径中的数字ID参数
+func parseIDParam(c *gin.Context, name string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 32)
+	if err != nil || id == 0 {
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// checkWeekNumbers 检查周数在当前学期的周数范围内，超出范围时返回 400 和 message
+func checkWeekNumbers(c *gin.Context, message string, weeks ...int) bool {
+	weekCount, err := services.ActiveWeekCount()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get term: " + err.Error()})
+		return false
+	}
+	for _, week := range weeks {
+		if week < 1 || week > weekCount {
+			c.JSON(http.StatusBadRequest, gin.H{"error": message})
+			return false
+		}
+	}
+	return true
+}
+
+// parseDraftQuery 解析 ?draft=true，读取草稿需要登录；未登录时返回 401
+func parseDraftQuery(c *gin.Context) (draft bool, ok bool) {
+	if c.Query("draft") != "true" {
+		return false, true
+	}
+	if middleware.OptionalSession(c) == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login required to read drafts"})
+		return false, false
+	}
+	return true, true
+}
@@ -0,0 +1,163 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"reschedule-program/middleware"
+	"reschedule-program/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RescheduleRoutes(r *gin.Engine) {
+	requestGroup := r.Group("/api/reschedule-requests", middleware.AuthRequired())
+	{
+		requestGroup.GET("", getRescheduleRequests)
+		requestGroup.POST("", createRescheduleRequest)
+		requestGroup.GET("/:id", getRescheduleRequest)
+		requestGroup.POST("/:id/approve", approveRescheduleRequest)
+		requestGroup.POST("/:id/reject", rejectRescheduleRequest)
+		requestGroup.POST("/:id/withdraw", withdrawRescheduleRequest)
+	}
+}
+
+// rescheduleErrorStatus 将调课申请相关错误映射为HTTP状态码
+func rescheduleErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrRequestNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidRequest):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrNotApprover), errors.Is(err, services.ErrNotRequester):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrRequestNotPending), errors.Is(err, services.ErrRequestApplyFailed):
+		return http.StatusConflict
+	}
+	return scheduleErrorStatus(err)
+}
+
+// reviewRequestBody 审批意见
+type reviewRequestBody struct {
+	Comment string `json:"comment"`
+}
+
+// getRescheduleRequests 获取调课申请列表，?status=pending 为待审批队列
+func getRescheduleRequests(c *gin.Context) {
+	requests, err := services.GetRescheduleRequests(middleware.CurrentSession(c), c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get requests: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"requests": requests})
+}
+
+// createRescheduleRequest 提交调课申请
+func createRescheduleRequest(c *gin.Context) {
+	var data services.RescheduleRequestData
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if data.ClassName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Class name is required"})
+		return
+	}
+
+	request, preview, err := services.CreateRescheduleRequest(middleware.CurrentActor(c), middleware.CurrentSession(c), data)
+	if err != nil {
+		c.JSON(rescheduleErrorStatus(err), gin.H{"error": "Failed to create request: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":   "Request submitted successfully",
+		"request":   request,
+		"conflicts": preview.Conflicts,
+		"warnings":  preview.Warnings,
+	})
+}
+
+// getRescheduleRequest 获取单个调课申请
+func getRescheduleRequest(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request ID"})
+		return
+	}
+
+	request, err := services.GetRescheduleRequest(middleware.CurrentSession(c), id)
+	if err != nil {
+		c.JSON(rescheduleErrorStatus(err), gin.H{"error": "Failed to get request: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"request": request})
+}
+
+// approveRescheduleRequest 批准调课申请并写入课程表，写入失败时申请记为 failed 并返回 409
+func approveRescheduleRequest(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request ID"})
+		return
+	}
+
+	var body reviewRequestBody
+	c.ShouldBindJSON(&body)
+
+	session := middleware.CurrentSession(c)
+	request, result, err := services.ApproveRescheduleRequest(middleware.CurrentActor(c), session, id, body.Comment)
+	if err != nil {
+		response := gin.H{"error": "Failed to approve request: " + err.Error()}
+		if request != nil {
+			response["request"] = request
+		}
+		if result != nil {
+			response["conflicts"] = result.Conflicts
+		}
+		c.JSON(rescheduleErrorStatus(err), response)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Request approved successfully", "request": request, "warnings": result.Warnings})
+}
+
+// rejectRescheduleRequest 驳回调课申请
+func rejectRescheduleRequest(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request ID"})
+		return
+	}
+
+	var body reviewRequestBody
+	c.ShouldBindJSON(&body)
+
+	session := middleware.CurrentSession(c)
+	request, err := services.RejectRescheduleRequest(middleware.CurrentActor(c), session, id, body.Comment)
+	if err != nil {
+		c.JSON(rescheduleErrorStatus(err), gin.H{"error": "Failed to reject request: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Request rejected successfully", "request": request})
+}
+
+// withdrawRescheduleRequest 申请人撤回调课申请
+func withdrawRescheduleRequest(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request ID"})
+		return
+	}
+
+	request, err := services.WithdrawRescheduleRequest(middleware.CurrentActor(c), middleware.CurrentSession(c), id)
+	if err != nil {
+		c.JSON(rescheduleErrorStatus(err), gin.H{"error": "Failed to withdraw request: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Request withdrawn successfully", "request": request})
+}
@@ -0,0 +1,124 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"reschedule-program/middleware"
+	"reschedule-program/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RoomRoutes(r *gin.Engine) {
+	roomGroup := r.Group("/api/rooms")
+	{
+		roomGroup.GET("", getAllRooms)
+		roomGroup.GET("/:id", getRoom)
+	}
+
+	adminRoomGroup := r.Group("/api/rooms", middleware.AdminRequired())
+	{
+		adminRoomGroup.POST("", createRoom)
+		adminRoomGroup.PUT("/:id", updateRoom)
+		adminRoomGroup.DELETE("/:id", deleteRoom)
+	}
+}
+
+// roomErrorStatus 将教室相关错误映射为HTTP状态码
+func roomErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrRoomNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidRoom):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrRoomExists), errors.Is(err, services.ErrRoomInUse):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// getAllRooms 获取所有教室
+func getAllRooms(c *gin.Context) {
+	rooms, err := services.GetAllRooms()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get rooms: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rooms": rooms})
+}
+
+// getRoom 获取单个教室
+func getRoom(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid room ID"})
+		return
+	}
+
+	room, err := services.GetRoom(id)
+	if err != nil {
+		c.JSON(roomErrorStatus(err), gin.H{"error": "Failed to get room: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"room": room})
+}
+
+// createRoom 添加教室
+func createRoom(c *gin.Context) {
+	var data services.RoomData
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	room, err := services.CreateRoom(middleware.CurrentActor(c), data)
+	if err != nil {
+		c.JSON(roomErrorStatus(err), gin.H{"error": "Failed to create room: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Room created successfully", "room": room})
+}
+
+// updateRoom 更新教室信息
+func updateRoom(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid room ID"})
+		return
+	}
+
+	var data services.RoomData
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	room, err := services.UpdateRoom(middleware.CurrentActor(c), id, data)
+	if err != nil {
+		c.JSON(roomErrorStatus(err), gin.H{"error": "Failed to update room: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Room updated successfully", "room": room})
+}
+
+// deleteRoom 删除教室
+func deleteRoom(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid room ID"})
+		return
+	}
+
+	_, err := services.DeleteRoom(middleware.CurrentActor(c), id)
+	if err != nil {
+		c.JSON(roomErrorStatus(err), gin.H{"error": "Failed to delete room: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Room deleted successfully"})
+}
@@ -1,9 +1,13 @@
 package routes
 
 import (
+	"errors"
 	"net/http"
+	"reschedule-program/middleware"
 	"reschedule-program/services"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -11,12 +15,89 @@ import (
 func SetupScheduleRoutes(router *gin.Engine) {
 	scheduleGroup := router.Group("/api/schedule")
 	{
-		scheduleGroup.POST("/save", saveSchedule)
 		scheduleGroup.GET("/class/:className/week/:weekNumber", getScheduleByClass)
+		scheduleGroup.GET("/class/:className/calendar.ics", getClassCalendar)
 		scheduleGroup.GET("/classes", getAllClasses)
-		scheduleGroup.DELETE("/delete", deleteSchedule)
-		scheduleGroup.POST("/move", moveSchedule)
+		scheduleGroup.GET("/export.csv", exportScheduleCSV)
+		scheduleGroup.GET("/export.xlsx", exportScheduleXLSX)
+		scheduleGroup.GET("/export.pdf", exportSchedulePDF)
+		scheduleGroup.GET("/teacher/:id/week/:weekNumber", getScheduleByTeacher)
+		scheduleGroup.GET("/room/:id/week/:weekNumber", getScheduleByRoom)
+		scheduleGroup.GET("/free-slots", findFreeSlots)
 	}
+
+	// 编辑草稿需要登录，发布、放弃草稿和恢复历史版本只限管理员
+	scheduleEditGroup := router.Group("/api/schedule", middleware.AuthRequired())
+	{
+		scheduleEditGroup.POST("/save", saveSchedule)
+		scheduleEditGroup.DELETE("/delete", deleteSchedule)
+		scheduleEditGroup.POST("/move", moveSchedule)
+		scheduleEditGroup.POST("/swap", swapSchedule)
+		scheduleEditGroup.PUT("/teacher", setScheduleTeacher)
+		scheduleEditGroup.PUT("/room", setScheduleRoom)
+		scheduleEditGroup.GET("/class/:className/diff", getScheduleDiff)
+		scheduleEditGroup.GET("/class/:className/history", getScheduleHistory)
+		scheduleEditGroup.GET("/class/:className/as-of", getScheduleAsOf)
+		scheduleEditGroup.GET("/class/:className/events", streamScheduleEvents)
+	}
+
+	router.POST("/api/schedule/clone", middleware.AdminRequired(), cloneSchedule)
+	router.POST("/api/schedule/import", middleware.AdminRequired(), importScheduleCSV)
+	router.POST("/api/schedule/import/fet", middleware.AdminRequired(), importScheduleFET)
+
+	classAdminGroup := router.Group("/api/schedule/class/:className", middleware.AdminRequired())
+	{
+		classAdminGroup.POST("/publish", publishSchedule)
+		classAdminGroup.POST("/discard", discardDraft)
+		classAdminGroup.POST("/revert", revertSchedule)
+	}
+
+	journalGroup := router.Group("/api/schedule", middleware.AuthRequired())
+	{
+		journalGroup.GET("/journal", getUndoJournal)
+		journalGroup.POST("/undo", undoSchedule)
+		journalGroup.POST("/redo", redoSchedule)
+	}
+}
+
+// scheduleErrorStatus 将课程表写入错误映射为HTTP状态码
+func scheduleErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrUnknownCourse):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrTeacherNotFound), errors.Is(err, services.ErrRoomNotFound),
+		errors.Is(err, services.ErrLessonNotFound), errors.Is(err, services.ErrChangeNotFound),
+		errors.Is(err, services.ErrCourseNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidHistoryPos), errors.Is(err, services.ErrNothingToUndo),
+		errors.Is(err, services.ErrNothingToRedo):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrSlotOccupied), errors.Is(err, services.ErrScheduleConflict),
+		errors.Is(err, services.ErrCellsChanged):
+		return http.StatusConflict
+	}
+	return classErrorStatus(err)
+}
+
+// respondScheduleWrite 返回课程表写操作的结果：
+// 预览模式（?dryRun=true）返回冲突和容量警告，存在冲突时返回 409 和冲突列表
+func respondScheduleWrite(c *gin.Context, result *services.WriteResult, err error, failure string, success string) {
+	if err != nil {
+		body := gin.H{"error": failure + err.Error()}
+		if errors.Is(err, services.ErrScheduleConflict) {
+			body["conflicts"] = result.Conflicts
+			body["warnings"] = result.Warnings
+		}
+		c.JSON(scheduleErrorStatus(err), body)
+		return
+	}
+
+	if c.Query("dryRun") == "true" {
+		c.JSON(http.StatusOK, gin.H{"dryRun": true, "conflicts": result.Conflicts, "warnings": result.Warnings})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": success, "warnings": result.Warnings})
 }
 
 // saveSchedule 保存课程表
@@ -33,16 +114,11 @@ func saveSchedule(c *gin.Context) {
 		return
 	}
 
-	err := services.SaveSchedule(scheduleData)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save schedule: " + err.Error()})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "Schedule saved successfully"})
+	result, err := services.SaveSchedule(middleware.CurrentActor(c), scheduleData, c.Query("dryRun") == "true")
+	respondScheduleWrite(c, result, err, "Failed to save schedule: ", "Schedule saved successfully")
 }
 
-// getScheduleByClass 根据班级名和周数获取课程表
+// getScheduleByClass 根据班级名和周数获取已发布的课程表，?draft=true 获取正在编辑的草稿
 func getScheduleByClass(c *gin.Context) {
 	className := c.Param("className")
 	weekNumberStr := c.Param("weekNumber")
@@ -54,18 +130,36 @@ func getScheduleByClass(c *gin.Context) {
 
 	// 解析周数参数
 	weekNumber, err := strconv.Atoi(weekNumberStr)
-	if err != nil || weekNumber < 1 || weekNumber > 20 {
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid week number"})
 		return
 	}
+	if !checkWeekNumbers(c, "Invalid week number", weekNumber) {
+		return
+	}
 
-	schedules, err := services.GetScheduleByClass(className, weekNumber)
+	draft, ok := parseDraftQuery(c)
+	if !ok {
+		return
+	}
+	getSchedule := services.GetPublishedScheduleByClass
+	if draft {
+		getSchedule = services.GetScheduleByClass
+	}
+	schedules, err := getSchedule(className, weekNumber)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get schedule: " + err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"schedules": schedules})
+	// 当前学期该周每天的校历信息，没有设置学期时为 null
+	days, err := services.GetActiveWeekCalendar(weekNumber)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get calendar: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"schedules": schedules, "days": days})
 }
 
 // getAllClasses 获取所有班级
@@ -98,8 +192,7 @@ func deleteSchedule(c *gin.Context) {
 		return
 	}
 
-	if request.WeekNumber < 1 || request.WeekNumber > 20 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid week number"})
+	if !checkWeekNumbers(c, "Invalid week number", request.WeekNumber) {
 		return
 	}
 
@@ -108,7 +201,7 @@ func deleteSchedule(c *gin.Context) {
 		return
 	}
 
-	err := services.DeleteSchedule(request.ClassName, request.WeekNumber, request.TimeSlotRow, request.TimeSlotCol)
+	err := services.DeleteSchedule(middleware.CurrentActor(c), request.ClassName, request.WeekNumber, request.TimeSlotRow, request.TimeSlotCol)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete schedule: " + err.Error()})
 		return
@@ -139,13 +232,8 @@ func moveSchedule(c *gin.Context) {
 		return
 	}
 
-	if request.SourceWeek < 1 || request.SourceWeek > 20 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid source week number"})
-		return
-	}
-
-	if request.TargetWeek < 1 || request.TargetWeek > 20 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid target week number"})
+	if !checkWeekNumbers(c, "Invalid source week number", request.SourceWeek) ||
+		!checkWeekNumbers(c, "Invalid target week number", request.TargetWeek) {
 		return
 	}
 
@@ -160,11 +248,469 @@ func moveSchedule(c *gin.Context) {
 		return
 	}
 
-	err := services.MoveSchedule(request.ClassName, request.SourceWeek, request.SourceRow, request.SourceCol, request.TargetWeek, request.TargetRow, request.TargetCol)
+	result, err := services.MoveSchedule(middleware.CurrentActor(c), request.ClassName, request.SourceWeek, request.SourceRow, request.SourceCol,
+		request.TargetWeek, request.TargetRow, request.TargetCol, c.Query("dryRun") == "true")
+	respondScheduleWrite(c, result, err, "Failed to move schedule: ", "Schedule moved successfully")
+}
+
+// swapSchedule 交换两个时间槽的课程
+func swapSchedule(c *gin.Context) {
+	var request struct {
+		ClassName  string `json:"className"`
+		FirstWeek  int    `json:"firstWeek"`
+		FirstRow   int    `json:"firstRow"`
+		FirstCol   int    `json:"firstCol"`
+		SecondWeek int    `json:"secondWeek"`
+		SecondRow  int    `json:"secondRow"`
+		SecondCol  int    `json:"secondCol"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if request.ClassName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Class name is required"})
+		return
+	}
+
+	if !checkWeekNumbers(c, "Invalid week number", request.FirstWeek, request.SecondWeek) {
+		return
+	}
+
+	if request.FirstRow < 0 || request.FirstRow > 4 || request.FirstCol < 0 || request.FirstCol > 6 ||
+		request.SecondRow < 0 || request.SecondRow > 4 || request.SecondCol < 0 || request.SecondCol > 6 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time slot"})
+		return
+	}
+
+	result, err := services.SwapSchedule(middleware.CurrentActor(c), request.ClassName, request.FirstWeek, request.FirstRow, request.FirstCol,
+		request.SecondWeek, request.SecondRow, request.SecondCol, c.Query("dryRun") == "true")
+	respondScheduleWrite(c, result, err, "Failed to swap schedule: ", "Schedule swapped successfully")
+}
+
+// cloneSchedule 复制班级或学期的课程表
+func cloneSchedule(c *gin.Context) {
+	var request services.CloneData
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	summary, err := services.CloneSchedule(middleware.CurrentActor(c), request)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrCloneSameTarget), errors.Is(err, services.ErrCloneTargetClass):
+			status = http.StatusBadRequest
+		case errors.Is(err, services.ErrClassNotFound), errors.Is(err, services.ErrTermNotFound):
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": "Failed to clone schedule: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Schedule cloned successfully", "summary": summary})
+}
+
+// getScheduleByTeacher 获取教师某一周在所有班级的课程
+func getScheduleByTeacher(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid teacher ID"})
+		return
+	}
+
+	weekNumber, err := strconv.Atoi(c.Param("weekNumber"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid week number"})
+		return
+	}
+	if !checkWeekNumbers(c, "Invalid week number", weekNumber) {
+		return
+	}
+
+	schedules, err := services.GetScheduleByTeacher(id, weekNumber)
+	if err != nil {
+		c.JSON(teacherErrorStatus(err), gin.H{"error": "Failed to get schedule: " + err.Error()})
+		return
+	}
+
+	days, err := services.GetActiveWeekCalendar(weekNumber)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get calendar: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"schedules": schedules, "days": days})
+}
+
+// setScheduleTeacher 为单节课程指定任课教师，teacherId 为 null 时恢复课程默认教师
+func setScheduleTeacher(c *gin.Context) {
+	var request struct {
+		ClassName   string `json:"className"`
+		WeekNumber  int    `json:"weekNumber"`
+		TimeSlotRow int    `json:"timeSlotRow"`
+		TimeSlotCol int    `json:"timeSlotCol"`
+		TeacherID   *uint  `json:"teacherId"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if request.ClassName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Class name is required"})
+		return
+	}
+
+	if !checkWeekNumbers(c, "Invalid week number", request.WeekNumber) {
+		return
+	}
+
+	if request.TimeSlotRow < 0 || request.TimeSlotRow > 4 || request.TimeSlotCol < 0 || request.TimeSlotCol > 6 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time slot"})
+		return
+	}
+
+	result, err := services.SetScheduleTeacher(middleware.CurrentActor(c), request.ClassName, request.WeekNumber, request.TimeSlotRow, request.TimeSlotCol,
+		request.TeacherID, c.Query("dryRun") == "true")
+	respondScheduleWrite(c, result, err, "Failed to set teacher: ", "Teacher assigned successfully")
+}
+
+// getScheduleByRoom 获取教室某一周的占用情况
+func getScheduleByRoom(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid room ID"})
+		return
+	}
+
+	weekNumber, err := strconv.Atoi(c.Param("weekNumber"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid week number"})
+		return
+	}
+	if !checkWeekNumbers(c, "Invalid week number", weekNumber) {
+		return
+	}
+
+	schedules, err := services.GetScheduleByRoom(id, weekNumber)
+	if err != nil {
+		c.JSON(roomErrorStatus(err), gin.H{"error": "Failed to get schedule: " + err.Error()})
+		return
+	}
+
+	days, err := services.GetActiveWeekCalendar(weekNumber)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get calendar: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"schedules": schedules, "days": days})
+}
+
+// setScheduleRoom 为单节课程安排教室，roomId 为 null 时取消教室安排
+func setScheduleRoom(c *gin.Context) {
+	var request struct {
+		ClassName   string `json:"className"`
+		WeekNumber  int    `json:"weekNumber"`
+		TimeSlotRow int    `json:"timeSlotRow"`
+		TimeSlotCol int    `json:"timeSlotCol"`
+		RoomID      *uint  `json:"roomId"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if request.ClassName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Class name is required"})
+		return
+	}
+
+	if !checkWeekNumbers(c, "Invalid week number", request.WeekNumber) {
+		return
+	}
+
+	if request.TimeSlotRow < 0 || request.TimeSlotRow > 4 || request.TimeSlotCol < 0 || request.TimeSlotCol > 6 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time slot"})
+		return
+	}
+
+	result, err := services.SetScheduleRoom(middleware.CurrentActor(c), request.ClassName, request.WeekNumber, request.TimeSlotRow, request.TimeSlotCol,
+		request.RoomID, c.Query("dryRun") == "true")
+	respondScheduleWrite(c, result, err, "Failed to set room: ", "Room assigned successfully")
+}
+
+// findFreeSlots 查找班级、教师和教室都空闲的位置
+// 查询参数：className（必填）、teacherId、roomId、fromWeek、toWeek、days（逗号分隔的星期 0-6）、
+// week/row/col（原位置，用于推断教师教室并按距离排序）、limit
+func findFreeSlots(c *gin.Context) {
+	query := services.FreeSlotQuery{ClassName: c.Query("className")}
+	if query.ClassName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Class name is required"})
+		return
+	}
+
+	// 1. 解析可选的整数参数
+	optionalInt := func(name string, min int, max int) (int, bool) {
+		value := c.Query(name)
+		if value == "" {
+			return 0, true
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < min || n > max {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name})
+			return 0, false
+		}
+		return n, true
+	}
+	optionalID := func(name string) (*uint, bool) {
+		value := c.Query(name)
+		if value == "" {
+			return nil, true
+		}
+		n, err := strconv.ParseUint(value, 10, 32)
+		if err != nil || n == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name})
+			return nil, false
+		}
+		id := uint(n)
+		return &id, true
+	}
+
+	var ok bool
+	if query.TeacherID, ok = optionalID("teacherId"); !ok {
+		return
+	}
+	if query.RoomID, ok = optionalID("roomId"); !ok {
+		return
+	}
+	if query.FromWeek, ok = optionalInt("fromWeek", 1, 1000); !ok {
+		return
+	}
+	if query.ToWeek, ok = optionalInt("toWeek", 1, 1000); !ok {
+		return
+	}
+	if query.FromWeek > 0 && query.ToWeek > 0 && query.FromWeek > query.ToWeek {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "fromWeek must not be after toWeek"})
+		return
+	}
+	if query.Limit, ok = optionalInt("limit", 0, 10000); !ok {
+		return
+	}
+
+	// 2. 解析允许的星期
+	if days := c.Query("days"); days != "" {
+		for _, part := range strings.Split(days, ",") {
+			day, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil || day < 0 || day > 6 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid days"})
+				return
+			}
+			query.Days = append(query.Days, day)
+		}
+	}
+
+	// 3. 原位置需要同时给出周数、时间段和星期
+	if c.Query("week") != "" || c.Query("row") != "" || c.Query("col") != "" {
+		var source services.SlotPosition
+		if source.WeekNumber, ok = optionalInt("week", 1, 1000); !ok {
+			return
+		}
+		if source.TimeSlotRow, ok = optionalInt("row", 0, 4); !ok {
+			return
+		}
+		if source.TimeSlotCol, ok = optionalInt("col", 0, 6); !ok {
+			return
+		}
+		if c.Query("week") == "" || c.Query("row") == "" || c.Query("col") == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "week, row and col must be given together"})
+			return
+		}
+		query.Source = &source
+	}
+
+	result, err := services.FindFreeSlots(query)
+	if err != nil {
+		c.JSON(scheduleErrorStatus(err), gin.H{"error": "Failed to find free slots: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// getScheduleDiff 获取班级草稿相对已发布版本变化的单元格
+func getScheduleDiff(c *gin.Context) {
+	changes, err := services.GetScheduleDiff(c.Param("className"))
+	if err != nil {
+		c.JSON(scheduleErrorStatus(err), gin.H{"error": "Failed to get diff: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"changes": changes})
+}
+
+// publishSchedule 发布班级草稿，返回发布的变化
+func publishSchedule(c *gin.Context) {
+	changes, err := services.PublishSchedule(middleware.CurrentActor(c), c.Param("className"))
+	if err != nil {
+		c.JSON(scheduleErrorStatus(err), gin.H{"error": "Failed to publish schedule: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Schedule published successfully", "changes": changes})
+}
+
+// discardDraft 放弃班级草稿中未发布的修改，返回被撤销的变化
+func discardDraft(c *gin.Context) {
+	result, changes, err := services.DiscardDraft(middleware.CurrentActor(c), c.Param("className"))
+	if err != nil {
+		body := gin.H{"error": "Failed to discard draft: " + err.Error()}
+		if errors.Is(err, services.ErrScheduleConflict) {
+			body["conflicts"] = result.Conflicts
+		}
+		c.JSON(scheduleErrorStatus(err), body)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Draft discarded successfully", "changes": changes, "warnings": result.Warnings})
+}
+
+// parseHistoryPoint 解析历史版本：at 为 RFC 3339 时间，changeId 为某条变更刚完成时
+func parseHistoryPoint(at string, changeID uint) (services.HistoryPoint, error) {
+	point := services.HistoryPoint{ChangeID: changeID}
+	if at != "" {
+		parsed, err := time.Parse(time.RFC3339, at)
+		if err != nil {
+			return point, err
+		}
+		point.At = &parsed
+	}
+	return point, nil
+}
+
+// getScheduleHistory 获取班级当前学期的变更历史，?before=<id> 翻页，?limit= 限定数量（默认 50）
+func getScheduleHistory(c *gin.Context) {
+	beforeID, _ := strconv.ParseUint(c.Query("before"), 10, 32)
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+
+	changes, err := services.GetScheduleHistory(c.Param("className"), uint(beforeID), limit)
+	if err != nil {
+		c.JSON(scheduleErrorStatus(err), gin.H{"error": "Failed to get history: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"changes": changes})
+}
+
+// getScheduleAsOf 获取班级在历史版本时的课程表，?at=<RFC 3339 时间> 或 ?changeId=<id>，可选 ?week=
+func getScheduleAsOf(c *gin.Context) {
+	changeID, _ := strconv.ParseUint(c.Query("changeId"), 10, 32)
+	point, err := parseHistoryPoint(c.Query("at"), uint(changeID))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time: " + err.Error()})
+		return
+	}
+	week, err := strconv.Atoi(c.DefaultQuery("week", "0"))
+	if err != nil || week < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid week number"})
+		return
+	}
+
+	lessons, err := services.GetScheduleAsOf(c.Param("className"), point, week)
+	if err != nil {
+		c.JSON(scheduleErrorStatus(err), gin.H{"error": "Failed to get schedule: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"lessons": lessons})
+}
+
+// revertSchedule 将班级课程表恢复到历史版本，支持 ?dryRun=true 预览
+func revertSchedule(c *gin.Context) {
+	var request struct {
+		At       string `json:"at"`
+		ChangeID uint   `json:"changeId"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	point, err := parseHistoryPoint(request.At, request.ChangeID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time: " + err.Error()})
+		return
+	}
+
+	dryRun := c.Query("dryRun") == "true"
+	result, err := services.RevertSchedule(middleware.CurrentActor(c), c.Param("className"), point, dryRun)
+	if err != nil {
+		body := gin.H{"error": "Failed to revert schedule: " + err.Error()}
+		if errors.Is(err, services.ErrScheduleConflict) {
+			body["conflicts"] = result.Conflicts
+		}
+		c.JSON(scheduleErrorStatus(err), body)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"dryRun":    dryRun,
+		"restored":  result.Restored,
+		"removed":   result.Removed,
+		"conflicts": result.Conflicts,
+		"warnings":  result.Warnings,
+	})
+}
+
+// getUndoJournal 获取当前用户的撤销日志
+func getUndoJournal(c *gin.Context) {
+	journal, err := services.GetUndoJournal(services.SessionActor(middleware.CurrentSession(c)))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get journal: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"journal": journal})
+}
+
+// undoSchedule 撤销当前用户最近一次删除、移动或交换课程的操作，支持 ?dryRun=true 预览
+func undoSchedule(c *gin.Context) {
+	respondUndo(c, services.UndoSchedule, "undo")
+}
+
+// redoSchedule 重做当前用户最近撤销的操作，支持 ?dryRun=true 预览
+func redoSchedule(c *gin.Context) {
+	respondUndo(c, services.RedoSchedule, "redo")
+}
+
+// respondUndo 执行撤销或重做并返回结果
+func respondUndo(c *gin.Context, replay func(services.Actor, bool) (*services.UndoResult, error), verb string) {
+	dryRun := c.Query("dryRun") == "true"
+	result, err := replay(middleware.CurrentActor(c), dryRun)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move schedule: " + err.Error()})
+		body := gin.H{"error": "Failed to " + verb + ": " + err.Error()}
+		if errors.Is(err, services.ErrScheduleConflict) {
+			body["conflicts"] = result.Conflicts
+			body["warnings"] = result.Warnings
+		}
+		c.JSON(scheduleErrorStatus(err), body)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Schedule moved successfully"})
+	c.JSON(http.StatusOK, gin.H{
+		"dryRun":    dryRun,
+		"className": result.ClassName,
+		"change":    result.Change,
+		"conflicts": result.Conflicts,
+		"warnings":  result.Warnings,
+	})
 }
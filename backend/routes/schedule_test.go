@@ -0,0 +1,100 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reschedule-program/models"
+	"reschedule-program/services"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newTestRouter 注册登录和课程表路由
+func newTestRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	AuthRoutes(router)
+	SetupScheduleRoutes(router)
+	return router
+}
+
+// serveJSON 发送 JSON 请求，token 不为空时携带登录令牌
+func serveJSON(router *gin.Engine, method string, path string, token string, body interface{}) *httptest.ResponseRecorder {
+	var payload bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&payload).Encode(body)
+	}
+	request := httptest.NewRequest(method, path, &payload)
+	request.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// login 登录并返回登录令牌
+func login(t *testing.T, router *gin.Engine, username string, password string) string {
+	t.Helper()
+	recorder := serveJSON(router, http.MethodPost, "/login", "", gin.H{"username": username, "password": password})
+	var response struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil || response.Token == "" {
+		t.Fatalf("login %s: %d %s", username, recorder.Code, recorder.Body)
+	}
+	return response.Token
+}
+
+// loginAs 创建用户并登录，返回登录令牌
+func loginAs(t *testing.T, router *gin.Engine, userType string) string {
+	t.Helper()
+	user := &models.User{UserID: "1234567890", Username: "editor", Password: "pw123456", UserType: userType}
+	if err := services.NewUserService().CreateUser(services.Actor{}, user); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return login(t, router, "editor", "pw123456")
+}
+
+func TestEditorSavesDraft(t *testing.T) {
+	setupTestDB(t)
+	router := newTestRouter()
+	token := loginAs(t, router, "user")
+
+	save := gin.H{"className": "C1", "schedule": [][]interface{}{{
+		gin.H{"name": "数学", "weekType": "continuous", "startWeek": 1, "endWeek": 2},
+	}}}
+	if recorder := serveJSON(router, http.MethodPost, "/api/schedule/save", "", save); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous save: status %d, want 401", recorder.Code)
+	}
+	if recorder := serveJSON(router, http.MethodPost, "/api/schedule/save", token, save); recorder.Code != http.StatusOK {
+		t.Fatalf("editor save: status %d %s", recorder.Code, recorder.Body)
+	}
+
+	// 编辑页面读取草稿
+	recorder := serveJSON(router, http.MethodGet, "/api/schedule/class/C1/week/1?draft=true", token, nil)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("editor draft read: status %d %s", recorder.Code, recorder.Body)
+	}
+	if !bytes.Contains(recorder.Body.Bytes(), []byte("数学")) {
+		t.Errorf("draft does not contain the saved lesson: %s", recorder.Body)
+	}
+	if recorder := serveJSON(router, http.MethodGet, "/api/schedule/class/C1/week/1?draft=true", "", nil); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous draft read: status %d, want 401", recorder.Code)
+	}
+
+	// 移动草稿中的课程
+	move := gin.H{"className": "C1", "sourceWeek": 1, "sourceRow": 0, "sourceCol": 0, "targetWeek": 1, "targetRow": 1, "targetCol": 0}
+	if recorder := serveJSON(router, http.MethodPost, "/api/schedule/move", token, move); recorder.Code != http.StatusOK {
+		t.Errorf("editor move: status %d %s", recorder.Code, recorder.Body)
+	}
+
+	// 发布只限管理员
+	if recorder := serveJSON(router, http.MethodPost, "/api/schedule/class/C1/publish", token, nil); recorder.Code != http.StatusForbidden {
+		t.Errorf("editor publish: status %d, want 403", recorder.Code)
+	}
+}
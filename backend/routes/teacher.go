@@ -0,0 +1,124 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"reschedule-program/middleware"
+	"reschedule-program/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TeacherRoutes(r *gin.Engine) {
+	teacherGroup := r.Group("/api/teachers")
+	{
+		teacherGroup.GET("", getAllTeachers)
+		teacherGroup.GET("/:id", getTeacher)
+	}
+
+	adminTeacherGroup := r.Group("/api/teachers", middleware.AdminRequired())
+	{
+		adminTeacherGroup.POST("", createTeacher)
+		adminTeacherGroup.PUT("/:id", updateTeacher)
+		adminTeacherGroup.DELETE("/:id", deleteTeacher)
+	}
+}
+
+// teacherErrorStatus 将教师相关错误映射为HTTP状态码
+func teacherErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrTeacherNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidTeacher):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrTeacherInUse):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// getAllTeachers 获取所有教师
+func getAllTeachers(c *gin.Context) {
+	teachers, err := services.GetAllTeachers()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get teachers: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"teachers": teachers})
+}
+
+// getTeacher 获取单个教师
+func getTeacher(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid teacher ID"})
+		return
+	}
+
+	teacher, err := services.GetTeacher(id)
+	if err != nil {
+		c.JSON(teacherErrorStatus(err), gin.H{"error": "Failed to get teacher: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"teacher": teacher})
+}
+
+// createTeacher 添加教师
+func createTeacher(c *gin.Context) {
+	var data services.TeacherData
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	teacher, err := services.CreateTeacher(middleware.CurrentActor(c), data)
+	if err != nil {
+		c.JSON(teacherErrorStatus(err), gin.H{"error": "Failed to create teacher: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Teacher created successfully", "teacher": teacher})
+}
+
+// updateTeacher 更新教师信息
+func updateTeacher(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid teacher ID"})
+		return
+	}
+
+	var data services.TeacherData
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	teacher, err := services.UpdateTeacher(middleware.CurrentActor(c), id, data)
+	if err != nil {
+		c.JSON(teacherErrorStatus(err), gin.H{"error": "Failed to update teacher: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Teacher updated successfully", "teacher": teacher})
+}
+
+// deleteTeacher 删除教师
+func deleteTeacher(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid teacher ID"})
+		return
+	}
+
+	_, err := services.DeleteTeacher(middleware.CurrentActor(c), id)
+	if err != nil {
+		c.JSON(teacherErrorStatus(err), gin.H{"error": "Failed to delete teacher: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Teacher deleted successfully"})
+}
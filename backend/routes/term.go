@@ -0,0 +1,219 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"reschedule-program/middleware"
+	"reschedule-program/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TermRoutes(router *gin.Engine) {
+	termGroup := router.Group("/api/terms")
+	{
+		termGroup.GET("", getAllTerms)
+		termGroup.POST("", middleware.AdminRequired(), createTerm)
+		termGroup.PUT("/:id", middleware.AdminRequired(), updateTerm)
+		termGroup.DELETE("/:id", middleware.AdminRequired(), deleteTerm)
+		termGroup.POST("/:id/activate", middleware.AdminRequired(), activateTerm)
+		termGroup.GET("/:id/calendar", getCalendarDays)
+		termGroup.POST("/:id/calendar", middleware.AdminRequired(), addCalendarDay)
+		termGroup.DELETE("/:id/calendar/:dayId", middleware.AdminRequired(), deleteCalendarDay)
+		termGroup.GET("/:id/displaced", getDisplacementReport)
+	}
+}
+
+// termErrorStatus 将学期相关错误映射为HTTP状态码
+func termErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrTermNotFound), errors.Is(err, services.ErrNoActiveTerm),
+		errors.Is(err, services.ErrCalendarDayNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidDate), errors.Is(err, services.ErrStartNotMonday),
+		errors.Is(err, services.ErrDateOutsideTerm), errors.Is(err, services.ErrInvalidCalendarDay),
+		errors.Is(err, services.ErrInvalidPeriodTimes), errors.Is(err, services.ErrInvalidTimeZone):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrTermInUse):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// getAllTerms 获取所有学期
+func getAllTerms(c *gin.Context) {
+	terms, err := services.GetAllTerms()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get terms: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"terms": terms})
+}
+
+// createTerm 创建学期
+func createTerm(c *gin.Context) {
+	var data services.TermData
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if data.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Term name is required"})
+		return
+	}
+
+	term, err := services.CreateTerm(middleware.CurrentActor(c), data)
+	if err != nil {
+		c.JSON(termErrorStatus(err), gin.H{"error": "Failed to create term: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Term created successfully", "term": term})
+}
+
+// updateTerm 更新学期
+func updateTerm(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid term ID"})
+		return
+	}
+
+	var data services.TermData
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if data.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Term name is required"})
+		return
+	}
+
+	term, err := services.UpdateTerm(middleware.CurrentActor(c), id, data)
+	if err != nil {
+		c.JSON(termErrorStatus(err), gin.H{"error": "Failed to update term: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Term updated successfully", "term": term})
+}
+
+// deleteTerm 删除学期
+func deleteTerm(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid term ID"})
+		return
+	}
+
+	if err := services.DeleteTerm(middleware.CurrentActor(c), id); err != nil {
+		c.JSON(termErrorStatus(err), gin.H{"error": "Failed to delete term: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Term deleted successfully"})
+}
+
+// activateTerm 设为当前学期
+func activateTerm(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid term ID"})
+		return
+	}
+
+	if err := services.ActivateTerm(middleware.CurrentActor(c), id); err != nil {
+		c.JSON(termErrorStatus(err), gin.H{"error": "Failed to activate term: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Term activated successfully"})
+}
+
+// getCalendarDays 获取学期校历
+func getCalendarDays(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid term ID"})
+		return
+	}
+
+	if _, err := services.GetTerm(id); err != nil {
+		c.JSON(termErrorStatus(err), gin.H{"error": "Failed to get calendar: " + err.Error()})
+		return
+	}
+
+	days, err := services.GetCalendarDays(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get calendar: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"days": days})
+}
+
+// addCalendarDay 添加节假日或调休补课日
+func addCalendarDay(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid term ID"})
+		return
+	}
+
+	var data services.CalendarDayData
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	day, err := services.AddCalendarDay(middleware.CurrentActor(c), id, data)
+	if err != nil {
+		c.JSON(termErrorStatus(err), gin.H{"error": "Failed to add calendar day: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Calendar day saved successfully", "day": day})
+}
+
+// deleteCalendarDay 删除校历中的特殊日期
+func deleteCalendarDay(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid term ID"})
+		return
+	}
+
+	dayID, ok := parseIDParam(c, "dayId")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid calendar day ID"})
+		return
+	}
+
+	if err := services.DeleteCalendarDay(middleware.CurrentActor(c), id, dayID); err != nil {
+		c.JSON(termErrorStatus(err), gin.H{"error": "Failed to delete calendar day: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Calendar day deleted successfully"})
+}
+
+// getDisplacementReport 列出被节假日占用、需要调课的课程
+func getDisplacementReport(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid term ID"})
+		return
+	}
+
+	report, err := services.GetDisplacementReport(id)
+	if err != nil {
+		c.JSON(termErrorStatus(err), gin.H{"error": "Failed to get displacement report: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"holidays": report})
+}
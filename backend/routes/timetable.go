@@ -0,0 +1,131 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"reschedule-program/middleware"
+	"reschedule-program/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TimetableRoutes(r *gin.Engine) {
+	timetableGroup := r.Group("/api/timetable/jobs", middleware.AdminRequired())
+	{
+		timetableGroup.GET("", getTimetableJobs)
+		timetableGroup.POST("", startTimetableJob)
+		timetableGroup.GET("/:id", getTimetableJob)
+		timetableGroup.GET("/:id/proposal", getTimetableProposal)
+		timetableGroup.POST("/:id/apply", applyTimetableJob)
+		timetableGroup.DELETE("/:id", deleteTimetableJob)
+	}
+}
+
+// timetableErrorStatus 将排课任务相关错误映射为HTTP状态码
+func timetableErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrTimetableJobNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidTimetable):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrTimetableJobNotReady), errors.Is(err, services.ErrTimetableJobRunning):
+		return http.StatusConflict
+	}
+	return scheduleErrorStatus(err)
+}
+
+// getTimetableJobs 获取所有排课任务
+func getTimetableJobs(c *gin.Context) {
+	jobs, err := services.GetTimetableJobs()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get timetable jobs: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"jobs": jobs})
+}
+
+// startTimetableJob 创建后台排课任务，通过 GET /api/timetable/jobs/:id 查询进度
+func startTimetableJob(c *gin.Context) {
+	var input services.TimetableInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	job, err := services.StartTimetableJob(middleware.CurrentActor(c), input)
+	if err != nil {
+		c.JSON(timetableErrorStatus(err), gin.H{"error": "Failed to start timetable job: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Timetable job started", "job": job})
+}
+
+// getTimetableJob 获取排课任务的状态、进度和无法安排的课时
+func getTimetableJob(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return
+	}
+
+	job, err := services.GetTimetableJob(id)
+	if err != nil {
+		c.JSON(timetableErrorStatus(err), gin.H{"error": "Failed to get timetable job: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"job": job})
+}
+
+// getTimetableProposal 获取排课任务生成的草案
+func getTimetableProposal(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return
+	}
+
+	lessons, err := services.GetTimetableProposal(id)
+	if err != nil {
+		c.JSON(timetableErrorStatus(err), gin.H{"error": "Failed to get proposal: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"lessons": lessons})
+}
+
+// applyTimetableJob 将草案写入课程表，支持 ?dryRun=true 预览冲突
+func applyTimetableJob(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return
+	}
+
+	dryRun := c.Query("dryRun") == "true"
+	result, err := services.ApplyTimetableJob(middleware.CurrentActor(c), id, dryRun)
+	if err != nil && !errors.Is(err, services.ErrScheduleConflict) {
+		c.JSON(timetableErrorStatus(err), gin.H{"error": "Failed to apply proposal: " + err.Error()})
+		return
+	}
+
+	respondScheduleWrite(c, result, err, "Failed to apply proposal: ", "Proposal applied successfully")
+}
+
+// deleteTimetableJob 删除排课任务及其草案
+func deleteTimetableJob(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return
+	}
+
+	if err := services.DeleteTimetableJob(middleware.CurrentActor(c), id); err != nil {
+		c.JSON(timetableErrorStatus(err), gin.H{"error": "Failed to delete timetable job: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Timetable job deleted successfully"})
+}
@@ -0,0 +1,173 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"reschedule-program/middleware"
+	"reschedule-program/models"
+	"reschedule-program/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// webhookErrorStatus 将 Webhook 错误映射为HTTP状态码
+func webhookErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidWebhookURL), errors.Is(err, services.ErrInvalidWebhookEvents):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrWebhookNotFound), errors.Is(err, services.ErrWebhookDeliveryNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// listWebhooks 获取全部 Webhook 订阅及可订阅的事件类型
+func listWebhooks(c *gin.Context) {
+	webhooks, err := services.GetWebhooks()
+	if err != nil {
+		c.JSON(webhookErrorStatus(err), gin.H{"error": "Failed to get webhooks: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"webhooks": webhooks, "eventTypes": services.WebhookEventTypes()})
+}
+
+// createWebhook 创建 Webhook 订阅，返回的 secret 只在创建和更换时出现
+func createWebhook(c *gin.Context) {
+	var data services.WebhookData
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	webhook, err := services.CreateWebhook(middleware.CurrentActor(c), data)
+	if err != nil {
+		c.JSON(webhookErrorStatus(err), gin.H{"error": "Failed to create webhook: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, webhook)
+}
+
+// updateWebhook 修改 Webhook 订阅，rotateSecret 为 true 时生成新的密钥
+func updateWebhook(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return
+	}
+	var data services.WebhookData
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	webhook, err := services.UpdateWebhook(middleware.CurrentActor(c), id, data)
+	if err != nil {
+		c.JSON(webhookErrorStatus(err), gin.H{"error": "Failed to update webhook: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, webhook)
+}
+
+// deleteWebhook 删除 Webhook 订阅及其投递日志
+func deleteWebhook(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return
+	}
+
+	if err := services.DeleteWebhook(middleware.CurrentActor(c), id); err != nil {
+		c.JSON(webhookErrorStatus(err), gin.H{"error": "Failed to delete webhook: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted successfully"})
+}
+
+// pingWebhook 向订阅发送 ping 事件
+func pingWebhook(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return
+	}
+
+	delivery, err := services.PingWebhook(middleware.CurrentActor(c), id)
+	if err != nil {
+		c.JSON(webhookErrorStatus(err), gin.H{"error": "Failed to ping webhook: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, delivery)
+}
+
+// listWebhookDeliveries 查询订阅的投递日志，最新的在前；?status= 按状态筛选，?cursor= 翻页
+func listWebhookDeliveries(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return
+	}
+	query := services.WebhookDeliveryQuery{SubscriptionID: id, Status: c.Query("status")}
+	switch query.Status {
+	case "", models.WebhookDeliveryPending, models.WebhookDeliveryDelivered, models.WebhookDeliveryFailed:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be pending, delivered or failed"})
+		return
+	}
+	if value := c.Query("cursor"); value != "" {
+		cursor, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return
+		}
+		query.Before = uint(cursor)
+	}
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+		query.Limit = limit
+	}
+
+	page, err := services.GetWebhookDeliveries(query)
+	if err != nil {
+		c.JSON(webhookErrorStatus(err), gin.H{"error": "Failed to get webhook deliveries: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// getWebhookDelivery 获取一次投递及发送的内容
+func getWebhookDelivery(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delivery ID"})
+		return
+	}
+
+	delivery, err := services.GetWebhookDelivery(id)
+	if err != nil {
+		c.JSON(webhookErrorStatus(err), gin.H{"error": "Failed to get webhook delivery: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, delivery)
+}
+
+// redeliverWebhook 以相同内容重新投递
+func redeliverWebhook(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delivery ID"})
+		return
+	}
+
+	delivery, err := services.RedeliverWebhook(id)
+	if err != nil {
+		c.JSON(webhookErrorStatus(err), gin.H{"error": "Failed to redeliver webhook: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, delivery)
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"reschedule-program/database"
 	"reschedule-program/models"
+	"reschedule-program/services"
 	"strconv"
 	"strings"
 )
@@ -289,18 +290,20 @@ func deleteUser(username string) {
 }
 
 func deleteSchedule(className string) {
-	var schedule models.ClassSchedule
-	if err := database.DB.Where("class_name = ?", className).First(&schedule).Error; err != nil {
-		fmt.Printf("课程表不存在: %s\n", className)
+	var class models.Class
+	if err := database.DB.Where("name = ?", className).First(&class).Error; err != nil {
+		fmt.Printf("班级不存在: %s\n", className)
 		return
 	}
 	
-	if err := database.DB.Delete(&schedule).Error; err != nil {
+	// 删除班级及其所有课程记录
+	_, deleted, err := services.DeleteClass(class.ID, true)
+	if err != nil {
 		log.Printf("删除课程表失败: %v", err)
 		return
 	}
 	
-	fmt.Printf("✅ 课程表删除成功: %s\n", className)
+	fmt.Printf("✅ 课程表删除成功: %s (%d 条课程记录)\n", className, deleted)
 	
 	// 记录日志
 	logEntry := &models.ActivityLog{
@@ -0,0 +1,284 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"reschedule-program/models"
+
+	"gorm.io/gorm"
+)
+
+// ActivityEvent 一次写操作的活动日志内容
+type ActivityEvent struct {
+	Action     string      // 操作类型，见 models.Activity* 常量
+	EntityType string      // 操作对象类型，见 models.Entity* 常量
+	EntityID   interface{} // 操作对象ID
+	EntityName string      // 操作对象名称
+	ClassID    uint        // 涉及的班级，0 表示与班级无关
+	Before     interface{} // 变更前的数据，序列化为JSON
+	After      interface{} // 变更后的数据，序列化为JSON
+}
+
+// UserActivityData 活动日志中的用户数据，不含密码
+func UserActivityData(user models.User) map[string]interface{} {
+	return map[string]interface{}{"userID": user.UserID, "username": user.Username, "userType": user.UserType}
+}
+
+// activityJSON 将变更数据序列化为JSON，nil 时为空
+func activityJSON(value interface{}) (models.JSONText, error) {
+	if value == nil {
+		return "", nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return models.JSONText(data), nil
+}
+
+// RecordActivity 在写操作的事务中追加一条活动日志，日志消息由结构化数据生成。
+// 所有活动日志都通过此函数写入，写入失败时整个操作回滚；课程表和用户变更同时加入 Webhook 投递队列
+func RecordActivity(tx *gorm.DB, actor Actor, event ActivityEvent) error {
+	before, err := activityJSON(event.Before)
+	if err != nil {
+		return err
+	}
+	after, err := activityJSON(event.After)
+	if err != nil {
+		return err
+	}
+
+	entry := models.ActivityLog{
+		ActorID:    actor.UserID,
+		ActorName:  actor.Username,
+		Action:     event.Action,
+		EntityType: event.EntityType,
+		EntityName: event.EntityName,
+		Before:     before,
+		After:      after,
+		ClientIP:   actor.ClientIP,
+		RequestID:  actor.RequestID,
+	}
+	if event.EntityID != nil {
+		entry.EntityID = fmt.Sprint(event.EntityID)
+	}
+	if event.ClassID > 0 {
+		classID := event.ClassID
+		entry.ClassID = &classID
+	}
+	entry.Message = RenderActivityMessage(&entry)
+	if err := tx.Create(&entry).Error; err != nil {
+		return err
+	}
+	return enqueueWebhooks(tx, &entry)
+}
+
+// activityData 解析后的变更数据
+type activityData map[string]interface{}
+
+// text 读取字符串字段
+func (d activityData) text(key string) string {
+	if value, ok := d[key].(string); ok {
+		return value
+	}
+	return ""
+}
+
+// number 读取数值字段
+func (d activityData) number(key string) int {
+	if value, ok := d[key].(float64); ok {
+		return int(value)
+	}
+	return 0
+}
+
+// count 读取列表字段的长度
+func (d activityData) count(key string) int {
+	if value, ok := d[key].([]interface{}); ok {
+		return len(value)
+	}
+	return 0
+}
+
+// changedCells 统计变更前后课程不同的位置数
+func changedCells(before []LessonSnapshot, after []LessonSnapshot) int {
+	cells := make(map[slotKey]*LessonSnapshot, len(before))
+	for i := range before {
+		cells[before[i].key()] = &before[i]
+	}
+	changed := 0
+	for _, snapshot := range after {
+		old, ok := cells[snapshot.key()]
+		if !ok || !old.sameContent(snapshot) {
+			changed++
+		}
+		delete(cells, snapshot.key())
+	}
+	return changed + len(cells)
+}
+
+// RenderActivityMessage 由活动日志的结构化数据生成日志消息，早期只有消息的日志原样返回
+func RenderActivityMessage(entry *models.ActivityLog) string {
+	if entry.Action == "" {
+		return entry.Message
+	}
+
+	actor := entry.ActorName
+	if actor == "" {
+		actor = "Anonymous"
+	}
+	var before, after activityData
+	json.Unmarshal([]byte(entry.Before), &before)
+	json.Unmarshal([]byte(entry.After), &after)
+
+	switch entry.Action {
+	case models.ActivityUserCreate:
+		if entry.ActorID != "" && entry.ActorID == entry.EntityID {
+			return entry.EntityName + " registered"
+		}
+		return "Admin added user: " + entry.EntityName
+	case models.ActivityUserUpdate:
+		return fmt.Sprintf("Admin updated user information: %s -> %s", before.text("username"), after.text("username"))
+	case models.ActivityUserPassword:
+		return "Admin updated user password: " + entry.EntityName
+	case models.ActivityUserDelete:
+		return "Admin deleted user: " + entry.EntityName
+
+	case models.ActivityClassCreate:
+		return "Admin created class: " + entry.EntityName
+	case models.ActivityClassUpdate:
+		if before.text("name") != after.text("name") {
+			return fmt.Sprintf("Admin renamed class: %s -> %s", before.text("name"), after.text("name"))
+		}
+		return "Admin updated class: " + entry.EntityName
+	case models.ActivityClassArchive:
+		return "Admin archived class: " + entry.EntityName
+	case models.ActivityClassUnarchive:
+		return "Admin unarchived class: " + entry.EntityName
+	case models.ActivityClassDelete:
+		return fmt.Sprintf("Admin deleted class: %s (%d schedules)", entry.EntityName, after.number("deletedSchedules"))
+
+	case models.ActivityCourseCreate:
+		return "Admin created course: " + entry.EntityName
+	case models.ActivityCourseUpdate:
+		return "Admin updated course: " + entry.EntityName
+	case models.ActivityCourseDelete:
+		return "Admin deleted course: " + entry.EntityName
+	case models.ActivityCourseMerge:
+		return fmt.Sprintf("Admin merged %d courses into: %s", before.count("courses"), entry.EntityName)
+
+	case models.ActivityTeacherCreate:
+		return "Admin added teacher: " + entry.EntityName
+	case models.ActivityTeacherUpdate:
+		return "Admin updated teacher: " + entry.EntityName
+	case models.ActivityTeacherDelete:
+		return "Admin deleted teacher: " + entry.EntityName
+
+	case models.ActivityRoomCreate:
+		return "Admin added room: " + entry.EntityName
+	case models.ActivityRoomUpdate:
+		return "Admin updated room: " + entry.EntityName
+	case models.ActivityRoomDelete:
+		return "Admin deleted room: " + entry.EntityName
+
+	case models.ActivityRescheduleCreate:
+		return fmt.Sprintf("%s requested to %s a lesson of class %s: %s", actor, after.text("action"), entry.EntityName, after.text("reason"))
+	case models.ActivityRescheduleApprove:
+		return fmt.Sprintf("%s approved reschedule request #%s of class %s", actor, entry.EntityID, entry.EntityName)
+	case models.ActivityRescheduleReject:
+		return fmt.Sprintf("%s rejected reschedule request #%s of class %s", actor, entry.EntityID, entry.EntityName)
+	case models.ActivityRescheduleWithdraw:
+		return fmt.Sprintf("%s withdrew reschedule request #%s of class %s", actor, entry.EntityID, entry.EntityName)
+
+	case models.ActivityTimetableStart:
+		return fmt.Sprintf("Admin started timetable job #%s for %d classes", entry.EntityID, after.number("classes"))
+	case models.ActivityTimetableApply:
+		return fmt.Sprintf("Admin applied timetable job #%s", entry.EntityID)
+	case models.ActivityTimetableDelete:
+		return fmt.Sprintf("Admin deleted timetable job #%s", entry.EntityID)
+	case models.ActivitySchedulePublish:
+		return fmt.Sprintf("%s published schedule of class %s (%d cells changed)", actor, entry.EntityName, after.count("changes"))
+
+	case models.ActivityTermCreate:
+		return "Admin created term: " + entry.EntityName
+	case models.ActivityTermUpdate:
+		return "Admin updated term: " + entry.EntityName
+	case models.ActivityTermActivate:
+		if previous := before.text("activeTerm"); previous != "" {
+			return fmt.Sprintf("Admin switched current term: %s -> %s", previous, entry.EntityName)
+		}
+		return "Admin set current term: " + entry.EntityName
+	case models.ActivityTermDelete:
+		return "Admin deleted term: " + entry.EntityName
+	case models.ActivityCalendarDayAdd:
+		if name := after.text("name"); name != "" {
+			return fmt.Sprintf("Admin added %s %s (%s) to the calendar", after.text("kind"), entry.EntityName, name)
+		}
+		return fmt.Sprintf("Admin added %s %s to the calendar", after.text("kind"), entry.EntityName)
+	case models.ActivityCalendarDayDelete:
+		return fmt.Sprintf("Admin removed %s %s from the calendar", before.text("kind"), entry.EntityName)
+
+	case models.ActivityFeedCreate:
+		return fmt.Sprintf("%s created calendar feed #%s for %s %s", actor, entry.EntityID, after.text("scope"), entry.EntityName)
+	case models.ActivityFeedRegenerate:
+		return fmt.Sprintf("%s regenerated the link of calendar feed #%s", actor, entry.EntityID)
+	case models.ActivityFeedRevoke:
+		return fmt.Sprintf("%s revoked calendar feed #%s", actor, entry.EntityID)
+
+	case models.ActivityLogRetention:
+		return fmt.Sprintf("Admin updated log retention policy: max age %d days, max %d rows, archive %t",
+			after.number("maxAgeDays"), after.number("maxRows"), after["archive"] == true)
+	case models.ActivityLogPrune:
+		if archive := after.text("archive"); archive != "" {
+			return fmt.Sprintf("%s pruned %d activity logs (archived to %s)", actor, after.number("pruned"), archive)
+		}
+		return fmt.Sprintf("%s pruned %d activity logs", actor, after.number("pruned"))
+	case models.ActivityBackupRestore:
+		return fmt.Sprintf("%s restored the database from a backup taken at %s", actor, after.text("createdAt"))
+
+	case models.ActivityWebhookCreate:
+		return "Admin added webhook: " + entry.EntityName
+	case models.ActivityWebhookUpdate:
+		return "Admin updated webhook: " + entry.EntityName
+	case models.ActivityWebhookDelete:
+		return "Admin deleted webhook: " + entry.EntityName
+	}
+
+	// 课程表变更的变更前后数据为课程列表
+	var lessonsBefore, lessonsAfter []LessonSnapshot
+	json.Unmarshal([]byte(entry.Before), &lessonsBefore)
+	json.Unmarshal([]byte(entry.After), &lessonsAfter)
+	switch entry.Action {
+	case scheduleActivity(models.ScheduleChangeInsert):
+		return fmt.Sprintf("%s added %d lessons to class %s", actor, len(lessonsAfter), entry.EntityName)
+	case scheduleActivity(models.ScheduleChangeDelete):
+		return fmt.Sprintf("%s deleted %d lessons of class %s", actor, len(lessonsBefore), entry.EntityName)
+	case scheduleActivity(models.ScheduleChangeMove):
+		if len(lessonsBefore) == 1 && len(lessonsAfter) == 1 {
+			from, to := lessonsBefore[0], lessonsAfter[0]
+			return fmt.Sprintf("%s moved %s of class %s from week %d (%d,%d) to week %d (%d,%d)", actor, from.CourseName, entry.EntityName,
+				from.WeekNumber, from.TimeSlotRow, from.TimeSlotCol, to.WeekNumber, to.TimeSlotRow, to.TimeSlotCol)
+		}
+	case scheduleActivity(models.ScheduleChangeSwap):
+		return fmt.Sprintf("%s swapped two lessons of class %s", actor, entry.EntityName)
+	case scheduleActivity(models.ScheduleChangeUpdate):
+		return fmt.Sprintf("%s updated %d lessons of class %s", actor, len(lessonsAfter), entry.EntityName)
+	case scheduleActivity(models.ScheduleChangeDiscard):
+		return fmt.Sprintf("%s discarded draft of class %s (%d cells reverted)", actor, entry.EntityName, changedCells(lessonsBefore, lessonsAfter))
+	case scheduleActivity(models.ScheduleChangeRevert):
+		return fmt.Sprintf("%s reverted schedule of class %s (%d lessons restored, %d removed)",
+			actor, entry.EntityName, len(lessonsAfter), len(lessonsBefore))
+	case scheduleActivity(models.ScheduleChangeUndo):
+		return fmt.Sprintf("%s undid a change in class %s (%d lessons restored, %d removed)",
+			actor, entry.EntityName, len(lessonsAfter), len(lessonsBefore))
+	case scheduleActivity(models.ScheduleChangeRedo):
+		return fmt.Sprintf("%s redid a change in class %s (%d lessons restored, %d removed)",
+			actor, entry.EntityName, len(lessonsAfter), len(lessonsBefore))
+	}
+	return fmt.Sprintf("%s: %s %s %s", actor, entry.Action, entry.EntityType, entry.EntityName)
+}
+
+// scheduleActivity 课程表变更对应的活动日志操作类型
+func scheduleActivity(action string) string {
+	return "schedule." + action
+}
@@ -0,0 +1,831 @@
+package services
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"reschedule-program/database"
+	"reschedule-program/models"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	backupFormat   = "reschedule-program-backup"
+	backupVersion  = 1 // 归档格式版本，格式变化时递增；可以恢复不高于当前版本的归档
+	backupManifest = "manifest.json"
+)
+
+var (
+	ErrInvalidBackup     = errors.New("invalid backup archive")
+	ErrBackupVersion     = errors.New("backup archive version is newer than this program supports")
+	ErrDatabaseNotEmpty  = errors.New("database is not empty, restore needs an empty database")
+	ErrBackupCountsWrong = errors.New("restored record counts do not match the backup")
+)
+
+// 备份格式
+const (
+	BackupFormatZip  = "zip"  // zip 归档：manifest.json 加每个表一个 JSONL 文件
+	BackupFormatJSON = "json" // 单个 JSON 文件
+)
+
+// backupTable 备份中的一个表及其引用关系
+type backupTable struct {
+	Model interface{}
+	Refs  map[string]string // 外键列 -> 被引用的表，恢复时替换为新ID
+	// Remap 处理外键列以外需要替换的ID，如按类型引用不同表的列、JSON中的ID
+	Remap func(row map[string]interface{}, ids *idRemapper) error
+}
+
+// backupTables 备份的表，按恢复顺序排列（被引用的表在前）。登录会话不备份
+var backupTables = []backupTable{
+	{Model: &models.User{}},
+	{Model: &models.Term{}},
+	{Model: &models.CalendarDay{}, Refs: map[string]string{"term_id": "terms"}},
+	{Model: &models.Teacher{}},
+	{Model: &models.Room{}},
+	{Model: &models.Class{}},
+	{Model: &models.Course{}, Refs: map[string]string{"default_teacher_id": "teachers"}},
+	{Model: &models.WeeklySchedule{}, Refs: scheduleRefs},
+	{Model: &models.PublishedSchedule{}, Refs: scheduleRefs},
+	{Model: &models.ScheduleChange{}, Refs: map[string]string{"term_id": "terms", "class_id": "classes"},
+		Remap: remapChangeSnapshots},
+	{Model: &models.UndoEntry{}, Refs: map[string]string{"change_id": "schedule_changes"}},
+	{Model: &models.RescheduleRequest{}, Refs: map[string]string{"term_id": "terms", "class_id": "classes"}},
+	{Model: &models.TimetableJob{}, Refs: map[string]string{"term_id": "terms"}},
+	{Model: &models.TimetableLesson{}, Refs: map[string]string{"job_id": "timetable_jobs", "class_id": "classes",
+		"course_id": "courses", "teacher_id": "teachers", "room_id": "rooms"}},
+	{Model: &models.ActivityLog{}, Refs: map[string]string{"class_id": "classes"}, Remap: remapActivityEntity},
+	{Model: &models.LogRetentionPolicy{}},
+	{Model: &models.CalendarFeed{}, Remap: remapFeedTarget},
+	{Model: &models.WebhookSubscription{}},
+	// 投递的事件ID与已发送的载荷一致，不替换
+	{Model: &models.WebhookDelivery{}, Refs: map[string]string{"subscription_id": "webhook_subscriptions",
+		"redelivery_of": "webhook_deliveries"}},
+}
+
+// scheduleRefs 课程表记录的外键
+var scheduleRefs = map[string]string{"term_id": "terms", "class_id": "classes", "course_id": "courses",
+	"teacher_id": "teachers", "room_id": "rooms"}
+
+// entityTables 活动日志对象类型对应的表，用户以用户ID引用，不需要替换
+var entityTables = map[string]string{
+	models.EntityClass:             "classes",
+	models.EntityCourse:            "courses",
+	models.EntityTeacher:           "teachers",
+	models.EntityRoom:              "rooms",
+	models.EntityRescheduleRequest: "reschedule_requests",
+	models.EntityTimetableJob:      "timetable_jobs",
+	models.EntityActivityLog:       "activity_logs",
+	models.EntityWebhook:           "webhook_subscriptions",
+	models.EntityTerm:              "terms",
+	models.EntityCalendarDay:       "calendar_days",
+	models.EntityCalendarFeed:      "calendar_feeds",
+}
+
+// feedTables 日历订阅范围对应的表
+var feedTables = map[string]string{
+	models.CalendarScopeClass:   "classes",
+	models.CalendarScopeTeacher: "teachers",
+	models.CalendarScopeRoom:    "rooms",
+}
+
+// BackupTableInfo 备份中一个表的记录数
+type BackupTableInfo struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+// BackupManifest 备份归档的描述
+type BackupManifest struct {
+	Format    string            `json:"format"`
+	Version   int               `json:"version"`
+	CreatedAt time.Time         `json:"createdAt"`
+	Dialect   string            `json:"dialect"` // 来源数据库类型，仅供参考，恢复与数据库类型无关
+	Tables    []BackupTableInfo `json:"tables"`
+}
+
+// RestoredTable 恢复后一个表的记录数
+type RestoredTable struct {
+	Name     string `json:"name"`
+	Expected int64  `json:"expected"` // 备份中的记录数
+	Restored int64  `json:"restored"` // 恢复后数据库中的记录数
+}
+
+// RestoreResult 恢复结果
+type RestoreResult struct {
+	Version    int             `json:"version"`
+	CreatedAt  time.Time       `json:"createdAt"` // 备份的时间
+	Tables     []RestoredTable `json:"tables"`
+	Unresolved int64           `json:"unresolved"` // 引用了备份中不存在的记录、已置空的外键数
+}
+
+// tableSchema 解析模型的表结构
+func tableSchema(db *gorm.DB, model interface{}) (*schema.Schema, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return nil, err
+	}
+	return stmt.Schema, nil
+}
+
+// dumpValue 将数据库读出的值转换为与数据库类型无关的JSON值：时间为 UTC 的 RFC 3339，布尔值为 true/false
+func dumpValue(field *schema.Field, value interface{}) interface{} {
+	if raw, ok := value.([]byte); ok {
+		value = string(raw)
+	}
+	if value == nil {
+		return nil
+	}
+	switch field.DataType {
+	case schema.Bool:
+		switch v := value.(type) {
+		case int64:
+			return v != 0
+		case string:
+			parsed, _ := strconv.ParseBool(v)
+			return parsed
+		}
+	case schema.Time:
+		if t, ok := value.(time.Time); ok {
+			return t.UTC().Format(time.RFC3339Nano)
+		}
+	}
+	return value
+}
+
+// backupWriter 按格式写出备份
+type backupWriter interface {
+	begin(manifest BackupManifest) error
+	beginTable(info BackupTableInfo) error
+	row(row map[string]interface{}) error
+	endTable() error
+	end() error
+}
+
+// zipBackupWriter 写出 zip 归档
+type zipBackupWriter struct {
+	zw    *zip.Writer
+	table *bufio.Writer
+}
+
+func (w *zipBackupWriter) begin(manifest BackupManifest) error {
+	part, err := w.zw.Create(backupManifest)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(part)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(manifest)
+}
+
+func (w *zipBackupWriter) beginTable(info BackupTableInfo) error {
+	part, err := w.zw.Create("tables/" + info.Name + ".jsonl")
+	if err != nil {
+		return err
+	}
+	w.table = bufio.NewWriter(part)
+	return nil
+}
+
+func (w *zipBackupWriter) row(row map[string]interface{}) error {
+	line, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+	w.table.Write(line)
+	return w.table.WriteByte('\n')
+}
+
+func (w *zipBackupWriter) endTable() error {
+	return w.table.Flush()
+}
+
+func (w *zipBackupWriter) end() error {
+	return w.zw.Close()
+}
+
+// jsonBackupWriter 写出单个 JSON 文件：描述字段加 tables 数组，每个表带 rows
+type jsonBackupWriter struct {
+	w        *bufio.Writer
+	firstRow bool
+	tables   int
+}
+
+func (w *jsonBackupWriter) begin(manifest BackupManifest) error {
+	header, err := json.Marshal(struct {
+		Format    string    `json:"format"`
+		Version   int       `json:"version"`
+		CreatedAt time.Time `json:"createdAt"`
+		Dialect   string    `json:"dialect"`
+	}{manifest.Format, manifest.Version, manifest.CreatedAt, manifest.Dialect})
+	if err != nil {
+		return err
+	}
+	w.w.Write(header[:len(header)-1])
+	_, err = w.w.WriteString(`,"tables":[`)
+	return err
+}
+
+func (w *jsonBackupWriter) beginTable(info BackupTableInfo) error {
+	if w.tables > 0 {
+		w.w.WriteByte(',')
+	}
+	w.tables++
+	w.firstRow = true
+	_, err := fmt.Fprintf(w.w, "\n{\"name\":%q,\"count\":%d,\"rows\":[", info.Name, info.Count)
+	return err
+}
+
+func (w *jsonBackupWriter) row(row map[string]interface{}) error {
+	line, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+	if !w.firstRow {
+		w.w.WriteByte(',')
+	}
+	w.firstRow = false
+	w.w.WriteByte('\n')
+	_, err = w.w.Write(line)
+	return err
+}
+
+func (w *jsonBackupWriter) endTable() error {
+	_, err := w.w.WriteString("]}")
+	return err
+}
+
+func (w *jsonBackupWriter) end() error {
+	w.w.WriteString("]}\n")
+	return w.w.Flush()
+}
+
+// WriteBackup 将整个数据库写为备份归档（zip 或 JSON），包含软删除的记录。
+// 在一个事务中读取，得到一致的快照；记录逐批读取，不整体加载到内存
+func WriteBackup(w io.Writer, format string) (*BackupManifest, error) {
+	var out backupWriter
+	switch format {
+	case BackupFormatZip, "":
+		out = &zipBackupWriter{zw: zip.NewWriter(w)}
+	case BackupFormatJSON:
+		out = &jsonBackupWriter{w: bufio.NewWriter(w)}
+	default:
+		return nil, fmt.Errorf("%w: unknown format %q", ErrInvalidBackup, format)
+	}
+
+	manifest := &BackupManifest{Format: backupFormat, Version: backupVersion, CreatedAt: time.Now().UTC(),
+		Dialect: database.DB.Dialector.Name()}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// 1. 各表的记录数
+		schemas := make([]*schema.Schema, len(backupTables))
+		for i, table := range backupTables {
+			tableSchema, err := tableSchema(tx, table.Model)
+			if err != nil {
+				return err
+			}
+			schemas[i] = tableSchema
+			var count int64
+			if err := tx.Unscoped().Model(table.Model).Count(&count).Error; err != nil {
+				return err
+			}
+			manifest.Tables = append(manifest.Tables, BackupTableInfo{Name: tableSchema.Table, Count: count})
+		}
+		if err := out.begin(*manifest); err != nil {
+			return err
+		}
+
+		// 2. 逐表写出，按主键顺序
+		for i, table := range backupTables {
+			tableSchema := schemas[i]
+			var columns []string
+			for _, field := range tableSchema.Fields {
+				if field.DBName != "" {
+					columns = append(columns, field.DBName)
+				}
+			}
+			if err := out.beginTable(manifest.Tables[i]); err != nil {
+				return err
+			}
+			rows, err := tx.Unscoped().Model(table.Model).Select(columns).
+				Order(tableSchema.PrioritizedPrimaryField.DBName).Rows()
+			if err != nil {
+				return err
+			}
+			for rows.Next() {
+				values := make([]interface{}, len(columns))
+				pointers := make([]interface{}, len(columns))
+				for j := range values {
+					pointers[j] = &values[j]
+				}
+				if err := rows.Scan(pointers...); err != nil {
+					rows.Close()
+					return err
+				}
+				row := make(map[string]interface{}, len(columns))
+				for j, column := range columns {
+					row[column] = dumpValue(tableSchema.FieldsByDBName[column], values[j])
+				}
+				if err := out.row(row); err != nil {
+					rows.Close()
+					return err
+				}
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return err
+			}
+			if err := out.endTable(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return manifest, out.end()
+}
+
+// backupSource 读取备份归档
+type backupSource interface {
+	manifest() BackupManifest
+	eachRow(table string, fn func(row map[string]interface{}) error) error
+}
+
+// decodeRow 解析一行记录，数字保留为 json.Number
+func decodeRow(data []byte) (map[string]interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var row map[string]interface{}
+	if err := decoder.Decode(&row); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	return row, nil
+}
+
+// zipBackupSource 从 zip 归档读取，每次读取一个表
+type zipBackupSource struct {
+	reader *zip.Reader
+	info   BackupManifest
+}
+
+func (s *zipBackupSource) manifest() BackupManifest {
+	return s.info
+}
+
+func (s *zipBackupSource) eachRow(table string, fn func(row map[string]interface{}) error) error {
+	file, err := s.reader.Open("tables/" + table + ".jsonl")
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		row, err := decodeRow(scanner.Bytes())
+		if err != nil {
+			return err
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// jsonBackupSource 从单个 JSON 文件读取
+type jsonBackupSource struct {
+	info BackupManifest
+	rows map[string][]json.RawMessage
+}
+
+func (s *jsonBackupSource) manifest() BackupManifest {
+	return s.info
+}
+
+func (s *jsonBackupSource) eachRow(table string, fn func(row map[string]interface{}) error) error {
+	for _, data := range s.rows[table] {
+		row, err := decodeRow(data)
+		if err != nil {
+			return err
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openBackup 按文件内容识别 zip 或 JSON 归档
+func openBackup(file *os.File) (backupSource, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	head := make([]byte, 1)
+	for {
+		if _, err := io.ReadFull(file, head); err != nil {
+			return nil, fmt.Errorf("%w: file is empty", ErrInvalidBackup)
+		}
+		if head[0] != ' ' && head[0] != '\n' && head[0] != '\r' && head[0] != '\t' {
+			break
+		}
+	}
+
+	var source backupSource
+	switch head[0] {
+	case 'P':
+		reader, err := zip.NewReader(file, info.Size())
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+		}
+		manifestFile, err := reader.Open(backupManifest)
+		if err != nil {
+			return nil, fmt.Errorf("%w: missing %s", ErrInvalidBackup, backupManifest)
+		}
+		zipSource := &zipBackupSource{reader: reader}
+		err = json.NewDecoder(manifestFile).Decode(&zipSource.info)
+		manifestFile.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+		}
+		source = zipSource
+	case '{':
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		var document struct {
+			BackupManifest
+			Tables []struct {
+				Name  string            `json:"name"`
+				Count int64             `json:"count"`
+				Rows  []json.RawMessage `json:"rows"`
+			} `json:"tables"`
+		}
+		if err := json.NewDecoder(file).Decode(&document); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+		}
+		jsonSource := &jsonBackupSource{info: document.BackupManifest, rows: map[string][]json.RawMessage{}}
+		jsonSource.info.Tables = nil
+		for _, table := range document.Tables {
+			jsonSource.info.Tables = append(jsonSource.info.Tables, BackupTableInfo{Name: table.Name, Count: table.Count})
+			jsonSource.rows[table.Name] = table.Rows
+		}
+		source = jsonSource
+	default:
+		return nil, fmt.Errorf("%w: not a zip or JSON file", ErrInvalidBackup)
+	}
+
+	manifest := source.manifest()
+	if manifest.Format != backupFormat {
+		return nil, fmt.Errorf("%w: unknown format %q", ErrInvalidBackup, manifest.Format)
+	}
+	if manifest.Version < 1 || manifest.Version > backupVersion {
+		return nil, fmt.Errorf("%w: version %d", ErrBackupVersion, manifest.Version)
+	}
+	return source, nil
+}
+
+// idRemapper 记录恢复时各表旧ID到新ID的对应关系
+type idRemapper struct {
+	ids        map[string]map[uint64]uint64
+	unresolved int64
+}
+
+// toID 将备份或数据库中的ID值转换为整数，空值返回 false
+func toID(value interface{}) (uint64, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		id, err := strconv.ParseUint(v.String(), 10, 64)
+		return id, err == nil
+	case int64:
+		return uint64(v), v >= 0
+	case int32:
+		return uint64(v), v >= 0
+	case uint64:
+		return v, true
+	case int:
+		return uint64(v), v >= 0
+	case uint:
+		return uint64(v), true
+	case float64:
+		return uint64(v), v >= 0
+	case string:
+		id, err := strconv.ParseUint(v, 10, 64)
+		return id, err == nil
+	}
+	return 0, false
+}
+
+// lookup 返回表中旧ID对应的新ID。0 表示未设置，保持为 0；备份中不存在的记录返回 false
+func (m *idRemapper) lookup(table string, value interface{}) (uint64, bool) {
+	id, ok := toID(value)
+	if !ok {
+		return 0, false
+	}
+	if id == 0 {
+		return 0, true
+	}
+	newID, ok := m.ids[table][id]
+	return newID, ok
+}
+
+// remapRef 替换外键值，引用的记录不在备份中时置空（可为空的列）或置 0
+func (m *idRemapper) remapRef(table string, value interface{}, nullable bool) interface{} {
+	if value == nil {
+		return nil
+	}
+	if newID, ok := m.lookup(table, value); ok {
+		return json.Number(strconv.FormatUint(newID, 10))
+	}
+	m.unresolved++
+	if nullable {
+		return nil
+	}
+	return json.Number("0")
+}
+
+// remapSnapshotIDs 替换课程快照中的课程、教师和教室ID
+func remapSnapshotIDs(value interface{}, ids *idRemapper) (interface{}, error) {
+	text, ok := value.(string)
+	if !ok || text == "" {
+		return value, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(text)))
+	decoder.UseNumber()
+	var snapshots []map[string]interface{}
+	if err := decoder.Decode(&snapshots); err != nil {
+		return value, nil // 不是课程列表时原样保留
+	}
+	for _, snapshot := range snapshots {
+		for key, table := range map[string]string{"courseId": "courses", "teacherId": "teachers", "roomId": "rooms"} {
+			if ref, ok := snapshot[key]; ok {
+				snapshot[key] = ids.remapRef(table, ref, key != "courseId")
+			}
+		}
+	}
+	data, err := json.Marshal(snapshots)
+	return string(data), err
+}
+
+// remapChangeSnapshots 变更历史中变更前后的课程
+func remapChangeSnapshots(row map[string]interface{}, ids *idRemapper) error {
+	for _, column := range []string{"before", "after"} {
+		value, err := remapSnapshotIDs(row[column], ids)
+		if err != nil {
+			return err
+		}
+		row[column] = value
+	}
+	return nil
+}
+
+// remapActivityEntity 活动日志的对象ID按对象类型引用不同的表；变更前后的数据是历史记录，原样保留
+func remapActivityEntity(row map[string]interface{}, ids *idRemapper) error {
+	entityType, _ := row["entity_type"].(string)
+	table, ok := entityTables[entityType]
+	if !ok || row["entity_id"] == nil || row["entity_id"] == "" {
+		return nil
+	}
+	if newID, ok := ids.lookup(table, row["entity_id"]); ok {
+		row["entity_id"] = strconv.FormatUint(newID, 10)
+	}
+	// 已被删除的对象保留原ID，日志中的名称仍可识别
+	return nil
+}
+
+// remapFeedTarget 日历订阅的对象ID按订阅范围引用不同的表
+func remapFeedTarget(row map[string]interface{}, ids *idRemapper) error {
+	scope, _ := row["scope"].(string)
+	if table, ok := feedTables[scope]; ok {
+		row["target_id"] = ids.remapRef(table, row["target_id"], false)
+	}
+	return nil
+}
+
+// restoreValue 将备份中的JSON值转换为写入数据库的值
+func restoreValue(field *schema.Field, value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	invalid := fmt.Errorf("%w: invalid value %v for column %s", ErrInvalidBackup, value, field.DBName)
+	switch field.DataType {
+	case schema.Time:
+		text, ok := value.(string)
+		if !ok {
+			return nil, invalid
+		}
+		parsed, err := time.Parse(time.RFC3339Nano, text)
+		if err != nil {
+			return nil, invalid
+		}
+		return parsed, nil
+	case schema.Bool:
+		flag, ok := value.(bool)
+		if !ok {
+			return nil, invalid
+		}
+		return flag, nil
+	case schema.Int, schema.Uint:
+		number, ok := value.(json.Number)
+		if !ok {
+			return nil, invalid
+		}
+		parsed, err := number.Int64()
+		if err != nil {
+			return nil, invalid
+		}
+		return parsed, nil
+	case schema.Float:
+		number, ok := value.(json.Number)
+		if !ok {
+			return nil, invalid
+		}
+		parsed, err := number.Float64()
+		if err != nil {
+			return nil, invalid
+		}
+		return parsed, nil
+	case schema.String:
+		text, ok := value.(string)
+		if !ok {
+			return nil, invalid
+		}
+		return text, nil
+	}
+	return value, nil
+}
+
+// resetIDSequence 将 PostgreSQL 表的自增序列设到表中最大ID之后。序列与表中的数据分开保存，
+// 恢复一个表后对齐，之后新建的记录不会与恢复的ID冲突；SQLite 按表中最大ID分配，不需要处理
+func resetIDSequence(tx *gorm.DB, table string, column string) error {
+	if tx.Dialector.Name() != "postgres" {
+		return nil
+	}
+	return tx.Exec("SELECT setval(pg_get_serial_sequence(?, ?), COALESCE(MAX(?), 0) + 1, false) FROM ?",
+		table, column, clause.Column{Name: column}, clause.Table{Name: table}).Error
+}
+
+// singletonTable 只有一行设置的表，新数据库启动时可能已自动创建，恢复时覆盖
+func singletonTable(name string) bool {
+	return name == "log_retention_policies"
+}
+
+// RestoreBackup 将备份归档恢复到空数据库（SQLite 或 PostgreSQL）。记录按表的依赖顺序写入，自增ID由数据库重新分配，
+// 外键和引用替换为新ID，PostgreSQL 的自增序列随后对齐；恢复后核对各表的记录数，不一致时整体回滚
+func RestoreBackup(actor Actor, file *os.File) (*RestoreResult, error) {
+	source, err := openBackup(file)
+	if err != nil {
+		return nil, err
+	}
+	manifest := source.manifest()
+	expected := map[string]int64{}
+	for _, table := range manifest.Tables {
+		expected[table.Name] = table.Count
+	}
+
+	result := &RestoreResult{Version: manifest.Version, CreatedAt: manifest.CreatedAt}
+	ids := &idRemapper{ids: map[string]map[uint64]uint64{}}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// 1. 数据库必须为空
+		for _, table := range backupTables {
+			tableSchema, err := tableSchema(tx, table.Model)
+			if err != nil {
+				return err
+			}
+			if singletonTable(tableSchema.Table) {
+				continue
+			}
+			var count int64
+			if err := tx.Unscoped().Model(table.Model).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return fmt.Errorf("%w: table %s has %d records", ErrDatabaseNotEmpty, tableSchema.Table, count)
+			}
+		}
+
+		// 2. 按顺序写入各表
+		for _, table := range backupTables {
+			tableSchema, err := tableSchema(tx, table.Model)
+			if err != nil {
+				return err
+			}
+			name := tableSchema.Table
+			if singletonTable(name) && expected[name] > 0 {
+				if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().
+					Delete(table.Model).Error; err != nil {
+					return err
+				}
+			}
+
+			primary := tableSchema.PrioritizedPrimaryField
+			autoID := primary != nil && primary.HasDefaultValue && primary.DataType == schema.Uint
+			ids.ids[name] = map[uint64]uint64{}
+			err = source.eachRow(name, func(row map[string]interface{}) error {
+				// 替换引用
+				for column, refTable := range table.Refs {
+					if value, ok := row[column]; ok {
+						field := tableSchema.FieldsByDBName[column]
+						row[column] = ids.remapRef(refTable, value, field != nil && field.FieldType.Kind() == reflect.Ptr)
+					}
+				}
+				if table.Remap != nil {
+					if err := table.Remap(row, ids); err != nil {
+						return err
+					}
+				}
+
+				// 转换为数据库的值，自增主键由数据库分配
+				values := map[string]interface{}{}
+				for column, value := range row {
+					field := tableSchema.FieldsByDBName[column]
+					if field == nil || (autoID && field == primary) {
+						continue
+					}
+					converted, err := restoreValue(field, value)
+					if err != nil {
+						return err
+					}
+					values[column] = converted
+				}
+				if err := tx.Model(table.Model).Create(values).Error; err != nil {
+					return err
+				}
+				if autoID {
+					oldID, ok := toID(row[primary.DBName])
+					newID, created := toID(values[primary.DBName])
+					if !ok || !created {
+						return fmt.Errorf("%w: missing id in table %s", ErrInvalidBackup, name)
+					}
+					ids.ids[name][oldID] = newID
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if autoID {
+				if err := resetIDSequence(tx, name, primary.DBName); err != nil {
+					return err
+				}
+			}
+		}
+
+		// 3. 核对记录数
+		for _, table := range backupTables {
+			tableSchema, err := tableSchema(tx, table.Model)
+			if err != nil {
+				return err
+			}
+			var count int64
+			if err := tx.Unscoped().Model(table.Model).Count(&count).Error; err != nil {
+				return err
+			}
+			want, ok := expected[tableSchema.Table]
+			if !ok && singletonTable(tableSchema.Table) {
+				continue
+			}
+			result.Tables = append(result.Tables, RestoredTable{Name: tableSchema.Table, Expected: want, Restored: count})
+			if count != want {
+				return fmt.Errorf("%w: table %s has %d records, expected %d", ErrBackupCountsWrong,
+					tableSchema.Table, count, want)
+			}
+		}
+		result.Unresolved = ids.unresolved
+
+		return RecordActivity(tx, actor, ActivityEvent{
+			Action: models.ActivityBackupRestore,
+			After: map[string]interface{}{
+				"createdAt": manifest.CreatedAt, "version": manifest.Version, "unresolved": ids.unresolved,
+			},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	// 恢复的变更历史不作为新的事件发布
+	if err := resetScheduleEvents(); err != nil {
+		log.Println("Failed to reset schedule events:", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,272 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reschedule-program/database"
+	"reschedule-program/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrFeedNotFound     = errors.New("calendar feed not found")
+	ErrInvalidFeedScope = errors.New("scope must be class, teacher or room")
+)
+
+// FeedData 创建日历订阅的请求数据，班级可用 targetId 或 className 指定
+type FeedData struct {
+	Scope     string `json:"scope"`
+	TargetID  uint   `json:"targetId"`
+	ClassName string `json:"className"`
+	Draft     bool   `json:"draft"`
+}
+
+// FeedInfo 日历订阅及其订阅路径
+type FeedInfo struct {
+	models.CalendarFeed
+	TargetName string `json:"targetName"`
+	Path       string `json:"path"` // 订阅链接的路径
+}
+
+// FeedCalendarResult 读取订阅得到的日历，客户端缓存有效时 Calendar 为 nil
+type FeedCalendarResult struct {
+	Calendar  *Calendar
+	ETag      string
+	ChangedAt time.Time // 订阅内容最近一次变化的时间
+}
+
+// newFeedToken 生成订阅密钥
+func newFeedToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// ownFeeds 会话用户创建的日历订阅
+func ownFeeds(db *gorm.DB, session *models.Session) *gorm.DB {
+	return db.Model(&models.CalendarFeed{}).Where("owner_id = ? AND owner_name = ?", session.UserID, session.Username)
+}
+
+// feedTargetName 订阅对象的名称，对象已被删除时返回对应的错误
+func feedTargetName(scope string, targetID uint) (string, error) {
+	switch scope {
+	case models.CalendarScopeClass:
+		var class models.Class
+		if err := database.DB.First(&class, targetID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return "", ErrClassNotFound
+			}
+			return "", err
+		}
+		return class.Name, nil
+	case models.CalendarScopeTeacher:
+		teacher, err := GetTeacher(targetID)
+		if err != nil {
+			return "", err
+		}
+		return teacher.Name, nil
+	case models.CalendarScopeRoom:
+		room, err := GetRoom(targetID)
+		if err != nil {
+			return "", err
+		}
+		return room.Name, nil
+	}
+	return "", ErrInvalidFeedScope
+}
+
+// feedInfo 补充订阅对象名称和订阅路径，对象已被删除时名称为空
+func feedInfo(feed models.CalendarFeed) FeedInfo {
+	name, _ := feedTargetName(feed.Scope, feed.TargetID)
+	return FeedInfo{CalendarFeed: feed, TargetName: name, Path: "/api/calendar/feeds/" + feed.Token + ".ics"}
+}
+
+// recordFeedActivity 在事务中记录日历订阅的活动日志，日志中不包含订阅密钥
+func recordFeedActivity(tx *gorm.DB, actor Actor, action string, feed models.CalendarFeed) error {
+	name, _ := feedTargetName(feed.Scope, feed.TargetID)
+	return RecordActivity(tx, actor, ActivityEvent{
+		Action: action, EntityType: models.EntityCalendarFeed, EntityID: feed.ID, EntityName: name,
+		After: map[string]interface{}{"scope": feed.Scope, "targetId": feed.TargetID, "draft": feed.Draft, "ownerId": feed.OwnerID},
+	})
+}
+
+// CreateCalendarFeed 为会话用户创建班级、教师或教室的日历订阅
+func CreateCalendarFeed(actor Actor, session *models.Session, data FeedData) (*FeedInfo, error) {
+	// 1. 确定订阅对象
+	if data.Scope == models.CalendarScopeClass && data.TargetID == 0 && data.ClassName != "" {
+		class, err := findClassByName(database.DB, data.ClassName)
+		if err != nil {
+			return nil, err
+		}
+		data.TargetID = class.ID
+	}
+	if _, err := feedTargetName(data.Scope, data.TargetID); err != nil {
+		return nil, err
+	}
+
+	// 2. 生成密钥并保存
+	token, err := newFeedToken()
+	if err != nil {
+		return nil, err
+	}
+	feed := models.CalendarFeed{
+		OwnerID:   session.UserID,
+		OwnerName: session.Username,
+		Scope:     data.Scope,
+		TargetID:  data.TargetID,
+		Draft:     data.Draft,
+		Token:     token,
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&feed).Error; err != nil {
+			return err
+		}
+		return recordFeedActivity(tx, actor, models.ActivityFeedCreate, feed)
+	})
+	if err != nil {
+		return nil, err
+	}
+	info := feedInfo(feed)
+	return &info, nil
+}
+
+// GetCalendarFeeds 获取会话用户的日历订阅
+func GetCalendarFeeds(session *models.Session) ([]FeedInfo, error) {
+	var feeds []models.CalendarFeed
+	if err := ownFeeds(database.DB, session).Order("id").Find(&feeds).Error; err != nil {
+		return nil, err
+	}
+	infos := make([]FeedInfo, 0, len(feeds))
+	for _, feed := range feeds {
+		infos = append(infos, feedInfo(feed))
+	}
+	return infos, nil
+}
+
+// getOwnFeed 获取会话用户的一个日历订阅
+func getOwnFeed(session *models.Session, id uint) (*models.CalendarFeed, error) {
+	var feed models.CalendarFeed
+	if err := ownFeeds(database.DB, session).Where("id = ?", id).First(&feed).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrFeedNotFound
+		}
+		return nil, err
+	}
+	return &feed, nil
+}
+
+// RegenerateCalendarFeed 为日历订阅生成新的密钥，原订阅链接立即失效
+func RegenerateCalendarFeed(actor Actor, session *models.Session, id uint) (*FeedInfo, error) {
+	feed, err := getOwnFeed(session, id)
+	if err != nil {
+		return nil, err
+	}
+	if feed.Token, err = newFeedToken(); err != nil {
+		return nil, err
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(feed).Update("token", feed.Token).Error; err != nil {
+			return err
+		}
+		return recordFeedActivity(tx, actor, models.ActivityFeedRegenerate, *feed)
+	})
+	if err != nil {
+		return nil, err
+	}
+	info := feedInfo(*feed)
+	return &info, nil
+}
+
+// RevokeCalendarFeed 撤销日历订阅，订阅链接立即失效
+func RevokeCalendarFeed(actor Actor, session *models.Session, id uint) error {
+	feed, err := getOwnFeed(session, id)
+	if err != nil {
+		return err
+	}
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(feed).Error; err != nil {
+			return err
+		}
+		return recordFeedActivity(tx, actor, models.ActivityFeedRevoke, *feed)
+	})
+}
+
+// feedFetchedInterval 记录订阅最近拉取时间的最小间隔，避免每次拉取都写数据库
+const feedFetchedInterval = 10 * time.Minute
+
+// feedSourceVersion 订阅内容依赖的数据版本：当前学期和最新一条活动日志。
+// 课程表、发布、课程目录、学期和校历的修改都会记录活动日志，版本不变时日历内容不变
+func feedSourceVersion() (string, error) {
+	termID, err := currentTermID()
+	if err != nil {
+		return "", err
+	}
+	var latest models.ActivityLog
+	if err := database.DB.Unscoped().Select("id", "created_at").Order("id DESC").Limit(1).Find(&latest).Error; err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d:%d:%d", termID, latest.ID, latest.CreatedAt.UnixNano()), nil
+}
+
+// FeedCalendar 按订阅密钥读取当前学期的日历，已发布的订阅读取已发布的课程表，草稿订阅读取草稿。
+// 数据版本与上次生成时相同时沿用上次的 ETag，notModified 返回 true 时不生成日历，Calendar 为 nil；
+// 否则重新生成，内容与上次不同时记录变化时间，作为 Last-Modified
+func FeedCalendar(token string, notModified func(etag string, changedAt time.Time) bool) (*FeedCalendarResult, error) {
+	var feed models.CalendarFeed
+	if err := database.DB.Where("token = ?", token).First(&feed).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrFeedNotFound
+		}
+		return nil, err
+	}
+
+	// 1. 数据未变化且客户端缓存有效时直接返回
+	version, err := feedSourceVersion()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	updates := map[string]interface{}{}
+	if feed.LastFetchedAt == nil || now.Sub(*feed.LastFetchedAt) >= feedFetchedInterval {
+		updates["last_fetched_at"] = now
+	}
+	result := &FeedCalendarResult{}
+	if feed.SourceVersion == version && feed.ContentHash != "" && feed.ChangedAt != nil &&
+		notModified(feed.ContentHash, *feed.ChangedAt) {
+		result.ETag, result.ChangedAt = feed.ContentHash, *feed.ChangedAt
+		return result, saveFeedFetch(&feed, updates)
+	}
+
+	// 2. 重新生成日历
+	calendar, err := ScopeCalendar(feed.Scope, feed.TargetID, 0, feed.Draft)
+	if err != nil {
+		return nil, err
+	}
+	hash := calendar.ETag()
+	if feed.ContentHash != hash || feed.ChangedAt == nil {
+		feed.ContentHash, feed.ChangedAt = hash, &now
+		updates["content_hash"], updates["changed_at"] = hash, now
+	}
+	if feed.SourceVersion != version {
+		updates["source_version"] = version
+	}
+	if err := saveFeedFetch(&feed, updates); err != nil {
+		return nil, err
+	}
+	result.Calendar, result.ETag, result.ChangedAt = calendar, hash, *feed.ChangedAt
+	return result, nil
+}
+
+// saveFeedFetch 保存读取订阅时更新的字段，没有需要更新的字段时不写数据库
+func saveFeedFetch(feed *models.CalendarFeed, updates map[string]interface{}) error {
+	if len(updates) == 0 {
+		return nil
+	}
+	return database.DB.Model(feed).UpdateColumns(updates).Error
+}
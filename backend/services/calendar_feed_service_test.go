@@ -0,0 +1,59 @@
+package services
+
+import (
+	"reschedule-program/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+// feedContent 读取订阅的日历内容
+func feedContent(t *testing.T, token string) string {
+	t.Helper()
+	result, err := FeedCalendar(token, func(string, time.Time) bool { return false })
+	if err != nil {
+		t.Fatalf("FeedCalendar: %v", err)
+	}
+	return result.Calendar.Content
+}
+
+func TestFeedReflectsMoveOnNextFetch(t *testing.T) {
+	setupTestDB(t)
+	mustCreate(t, &models.Term{Name: "2026 Autumn", StartDate: "2026-09-07", WeekCount: 18, Active: true,
+		PeriodTimes: defaultPeriodTimes, TimeZone: "Asia/Shanghai"})
+	admin := Actor{Username: "Admin"}
+	if _, err := SaveSchedule(admin, ScheduleData{ClassName: "C1", Schedule: [][]*CourseAssignmentData{
+		{lessonData("数学", 1)},
+	}}, false); err != nil {
+		t.Fatalf("SaveSchedule: %v", err)
+	}
+	if _, err := PublishSchedule(admin, "C1"); err != nil {
+		t.Fatalf("PublishSchedule: %v", err)
+	}
+	feed, err := CreateCalendarFeed(admin, &models.Session{Username: "Admin", UserType: "admin"},
+		FeedData{Scope: models.CalendarScopeClass, ClassName: "C1"})
+	if err != nil {
+		t.Fatalf("CreateCalendarFeed: %v", err)
+	}
+
+	// 第1周周一第1节移到第2节
+	if content := feedContent(t, feed.Token); !strings.Contains(content, "20260907T080000") {
+		t.Fatalf("published lesson missing from the feed:\n%s", content)
+	}
+	if _, err := MoveSchedule(admin, "C1", 1, 0, 0, 1, 1, 0, false); err != nil {
+		t.Fatalf("MoveSchedule: %v", err)
+	}
+	content := feedContent(t, feed.Token)
+	if !strings.Contains(content, "20260907T100000") || strings.Contains(content, "20260907T080000") {
+		t.Errorf("feed does not reflect the move:\n%s", content)
+	}
+
+	// 撤销移动后订阅恢复原位置
+	if _, err := UndoSchedule(admin, false); err != nil {
+		t.Fatalf("UndoSchedule: %v", err)
+	}
+	content = feedContent(t, feed.Token)
+	if !strings.Contains(content, "20260907T080000") || strings.Contains(content, "20260907T100000") {
+		t.Errorf("feed does not reflect the undone move:\n%s", content)
+	}
+}
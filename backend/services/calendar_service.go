@@ -0,0 +1,578 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reschedule-program/database"
+	"reschedule-program/models"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	calendarProductID = "-//Reschedule Program//Timetable//ZH"
+	calendarUIDDomain = "reschedule-program"
+	maxSeriesGap      = 4 // 同一位置的课程相隔超过该周数时拆为新的重复系列
+	icsDateTime       = "20060102T150405"
+)
+
+// calendarLesson 日历中的一节课
+type calendarLesson struct {
+	ClassID    uint
+	ClassName  string
+	CourseID   uint
+	CourseName string
+	CourseCode string
+	Week       int
+	Row        int
+	Col        int
+	Teacher    string
+	Room       string
+	UpdatedAt  time.Time
+}
+
+// Calendar 导出的 iCalendar 日历，相同数据生成的内容完全相同
+type Calendar struct {
+	Content      string
+	LastModified time.Time // 日历中课程的最后修改时间
+}
+
+// ETag 由日历内容计算的版本标识
+func (c *Calendar) ETag() string {
+	sum := sha256.Sum256([]byte(c.Content))
+	return hex.EncodeToString(sum[:16])
+}
+
+// seriesKey 重复系列的分组：同一班级同一课程在每周同一位置
+type seriesKey struct {
+	ClassID  uint
+	CourseID uint
+	Row      int
+	Col      int
+}
+
+// calendarTerm 生成日历所需的学期信息
+type calendarTerm struct {
+	term     *models.Term
+	location *time.Location
+	periods  []PeriodTime
+	holidays map[string]bool  // 节假日日期
+	workdays map[int][]string // 调休补课日：周数 -> 日期，仅含指定了上课星期的
+	follows  map[string]int   // 调休补课日按哪一天的课表上课
+}
+
+// loadCalendarTerm 读取学期的上课时间、时区和校历
+func loadCalendarTerm(term *models.Term) (*calendarTerm, error) {
+	location, err := TermLocation(term)
+	if err != nil {
+		return nil, err
+	}
+	periods, err := ParsePeriodTimes(term.PeriodTimes)
+	if err != nil {
+		return nil, err
+	}
+	days, err := GetCalendarDays(term.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	ct := &calendarTerm{term: term, location: location, periods: periods,
+		holidays: map[string]bool{}, workdays: map[int][]string{}, follows: map[string]int{}}
+	for _, day := range days {
+		switch {
+		case day.Kind == models.CalendarDayHoliday:
+			ct.holidays[day.Date] = true
+		case day.Kind == models.CalendarDayWorkday && day.FollowsCol != nil:
+			week, _, err := TermSlotOfDate(term, day.Date)
+			if err != nil {
+				continue
+			}
+			ct.workdays[week] = append(ct.workdays[week], day.Date)
+			ct.follows[day.Date] = *day.FollowsCol
+		}
+	}
+	return ct, nil
+}
+
+// lessonTime 某天第 row 个时间段的上课和下课时间
+func (ct *calendarTerm) lessonTime(date time.Time, row int) (time.Time, time.Time) {
+	period := ct.periods[row]
+	at := func(minutes int) time.Time {
+		return time.Date(date.Year(), date.Month(), date.Day(), minutes/60, minutes%60, 0, 0, ct.location)
+	}
+	return at(period.Start), at(period.End)
+}
+
+// slotDate 第 week 周第 col 天的日期
+func (ct *calendarTerm) slotDate(week int, col int) (time.Time, error) {
+	return TermDate(ct.term, week, col)
+}
+
+// resolveTerm 返回指定学期，termID 为 0 时返回当前学期
+func resolveTerm(termID uint) (*models.Term, error) {
+	if termID == 0 {
+		return GetActiveTerm()
+	}
+	return GetTerm(termID)
+}
+
+// scheduleCalendarLessons 读取课程表记录并转换为日历课程，draft 为 false 时读取已发布版本。
+// where 为对课程表记录的筛选条件，列名不带表名
+func scheduleCalendarLessons(termID uint, draft bool, where string, args ...interface{}) ([]calendarLesson, error) {
+	var lessons []calendarLesson
+	teacherName := func(teacher *models.Teacher, course models.Course) string {
+		if teacher != nil {
+			return teacher.Name
+		}
+		if course.DefaultTeacher != nil {
+			return course.DefaultTeacher.Name
+		}
+		return ""
+	}
+	roomName := func(room *models.Room) string {
+		if room != nil {
+			return room.Name
+		}
+		return ""
+	}
+	courseCode := func(course models.Course) string {
+		if course.Code != nil {
+			return *course.Code
+		}
+		return ""
+	}
+
+	if draft {
+		var rows []models.WeeklySchedule
+		err := database.DB.Preload("Class").Preload("Course.DefaultTeacher").Preload("Teacher").Preload("Room").
+			Where("term_id = ?", termID).Where(where, args...).Find(&rows).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			lessons = append(lessons, calendarLesson{
+				ClassID: row.ClassID, ClassName: row.Class.Name, CourseID: row.CourseID, CourseName: row.Course.Name,
+				CourseCode: courseCode(row.Course), Week: row.WeekNumber, Row: row.TimeSlotRow, Col: row.TimeSlotCol,
+				Teacher: teacherName(row.Teacher, row.Course), Room: roomName(row.Room), UpdatedAt: row.UpdatedAt,
+			})
+		}
+		return lessons, nil
+	}
+
+	var rows []models.PublishedSchedule
+	err := database.DB.Preload("Class").Preload("Course.DefaultTeacher").Preload("Teacher").Preload("Room").
+		Where("term_id = ?", termID).Where(where, args...).Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		lessons = append(lessons, calendarLesson{
+			ClassID: row.ClassID, ClassName: row.Class.Name, CourseID: row.CourseID, CourseName: row.Course.Name,
+			CourseCode: courseCode(row.Course), Week: row.WeekNumber, Row: row.TimeSlotRow, Col: row.TimeSlotCol,
+			Teacher: teacherName(row.Teacher, row.Course), Room: roomName(row.Room), UpdatedAt: row.PublishedAt,
+		})
+	}
+	return lessons, nil
+}
+
+// ClassCalendar 生成班级在学期中的 iCalendar 日历，termID 为 0 时使用当前学期，
+// draft 为 false 时使用已发布的课程表
+func ClassCalendar(className string, termID uint, draft bool) (*Calendar, error) {
+	class, err := findClassByName(database.DB, className)
+	if err != nil {
+		return nil, err
+	}
+	return ScopeCalendar(models.CalendarScopeClass, class.ID, termID, draft)
+}
+
+// ScopeCalendar 生成班级、教师或教室在学期中的 iCalendar 日历。
+// 教师的日历包含单独指定该教师的课程，以及未指定教师、课程默认教师为该教师的课程
+func ScopeCalendar(scope string, targetID uint, termID uint, draft bool) (*Calendar, error) {
+	term, err := resolveTerm(termID)
+	if err != nil {
+		return nil, err
+	}
+	name, lessons, err := scopeLessons(scope, targetID, term.ID, draft)
+	if err != nil {
+		return nil, err
+	}
+	// 教师和教室的日历中注明班级
+	return buildCalendar(term, name, lessons, scope != models.CalendarScopeClass)
+}
+
+// scopeLessons 读取班级、教师或教室在学期中的课程，返回对象名称
+func scopeLessons(scope string, targetID uint, termID uint, draft bool) (string, []calendarLesson, error) {
+	var name string
+	var lessons []calendarLesson
+	var err error
+	switch scope {
+	case models.CalendarScopeClass:
+		var class models.Class
+		if err := database.DB.First(&class, targetID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return "", nil, ErrClassNotFound
+			}
+			return "", nil, err
+		}
+		name = class.Name
+		lessons, err = scheduleCalendarLessons(termID, draft, "class_id = ?", class.ID)
+	case models.CalendarScopeTeacher:
+		teacher, findErr := GetTeacher(targetID)
+		if findErr != nil {
+			return "", nil, findErr
+		}
+		name = teacher.Name
+		defaults := database.DB.Model(&models.Course{}).Select("id").Where("default_teacher_id = ?", teacher.ID)
+		lessons, err = scheduleCalendarLessons(termID, draft,
+			"teacher_id = ? OR (teacher_id IS NULL AND course_id IN (?))", teacher.ID, defaults)
+	case models.CalendarScopeRoom:
+		room, findErr := GetRoom(targetID)
+		if findErr != nil {
+			return "", nil, findErr
+		}
+		name = room.Name
+		lessons, err = scheduleCalendarLessons(termID, draft, "room_id = ?", room.ID)
+	default:
+		return "", nil, ErrInvalidFeedScope
+	}
+	return name, lessons, err
+}
+
+// calendarWriter 按 RFC 5545 输出内容行：CRLF 换行，超过75字节的行折行
+type calendarWriter struct {
+	builder strings.Builder
+}
+
+// line 输出一个内容行，折行时不拆开 UTF-8 字符
+func (w *calendarWriter) line(format string, args ...interface{}) {
+	text := fmt.Sprintf(format, args...)
+	limit := 75
+	for len(text) > limit {
+		cut := limit
+		for cut > 0 && !utf8Start(text[cut]) {
+			cut--
+		}
+		w.builder.WriteString(text[:cut])
+		w.builder.WriteString("\r\n ")
+		text = text[cut:]
+		// 续行以一个空格开头，占用一个字节
+		limit = 74
+	}
+	w.builder.WriteString(text)
+	w.builder.WriteString("\r\n")
+}
+
+// utf8Start 判断字节是否为 UTF-8 字符的首字节
+func utf8Start(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// escapeText 转义 TEXT 类型的属性值
+func escapeText(value string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(value)
+}
+
+// icsUTC 以 UTC 格式输出时间
+func icsUTC(t time.Time) string {
+	return t.UTC().Format(icsDateTime) + "Z"
+}
+
+// icsOffset 以 ±HHMM 格式输出时区偏移
+func icsOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign, seconds = "-", -seconds
+	}
+	return fmt.Sprintf("%s%02d%02d", sign, seconds/3600, seconds%3600/60)
+}
+
+// writeTimezone 输出学期时区的 VTIMEZONE：学期开始时的偏移，以及学期内的每次偏移变化（如夏令时）
+func (w *calendarWriter) writeTimezone(ct *calendarTerm) error {
+	first, err := ct.slotDate(1, 0)
+	if err != nil {
+		return err
+	}
+	from := time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, ct.location)
+	to := from.AddDate(0, 0, ct.term.WeekCount*7+1)
+
+	observance := func(start time.Time, before int) {
+		name, offset := start.Zone()
+		kind := "STANDARD"
+		if start.IsDST() {
+			kind = "DAYLIGHT"
+		}
+		w.line("BEGIN:%s", kind)
+		w.line("DTSTART:%s", start.In(time.FixedZone("", before)).Format(icsDateTime))
+		w.line("TZOFFSETFROM:%s", icsOffset(before))
+		w.line("TZOFFSETTO:%s", icsOffset(offset))
+		w.line("TZNAME:%s", escapeText(name))
+		w.line("END:%s", kind)
+	}
+
+	w.line("BEGIN:VTIMEZONE")
+	w.line("TZID:%s", ct.location.String())
+	_, offset := from.Zone()
+	observance(from, offset)
+	// 按天查找偏移变化，再按分钟二分定位变化时刻
+	for day := from; day.Before(to); day = day.Add(24 * time.Hour) {
+		next := day.Add(24 * time.Hour)
+		_, before := day.Zone()
+		if _, after := next.Zone(); after == before {
+			continue
+		}
+		low, high := day, next
+		for high.Sub(low) > time.Minute {
+			mid := low.Add(high.Sub(low) / 2)
+			if _, current := mid.Zone(); current == before {
+				low = mid
+			} else {
+				high = mid
+			}
+		}
+		observance(high.Truncate(time.Minute), before)
+	}
+	w.line("END:VTIMEZONE")
+	return nil
+}
+
+// mostCommon 返回出现次数最多的值，次数相同时取最早出现的
+func mostCommon(values []string) string {
+	counts := map[string]int{}
+	for _, value := range values {
+		counts[value]++
+	}
+	best := ""
+	for _, value := range values {
+		if counts[value] > counts[best] {
+			best = value
+		}
+	}
+	return best
+}
+
+// splitSeries 将课程所在的周按间隔拆为若干段，每段生成一个重复系列
+func splitSeries(weeks []int) [][]int {
+	var runs [][]int
+	for i, week := range weeks {
+		if i == 0 || week-weeks[i-1] > maxSeriesGap {
+			runs = append(runs, nil)
+		}
+		runs[len(runs)-1] = append(runs[len(runs)-1], week)
+	}
+	return runs
+}
+
+// seriesInterval 一段中相邻周的间隔都相同时按该间隔重复（如单双周），否则每周重复
+func seriesInterval(weeks []int) int {
+	if len(weeks) < 2 {
+		return 1
+	}
+	interval := weeks[1] - weeks[0]
+	for i := 2; i < len(weeks); i++ {
+		if weeks[i]-weeks[i-1] != interval {
+			return 1
+		}
+	}
+	return interval
+}
+
+// buildCalendar 将课程转换为 iCalendar 日历。同一班级同一课程在每周同一位置的课程合并为每周重复的事件，
+// 期间未上课的周和节假日作为 EXDATE，调休补课日作为 RDATE，教师或教室不同的周单独覆盖。
+// 事件的 UID 由班级、课程和位置决定，重新导入时更新原事件而不是重复添加。showClass 为 true 时在标题中注明班级
+func buildCalendar(term *models.Term, name string, lessons []calendarLesson, showClass bool) (*Calendar, error) {
+	ct, err := loadCalendarTerm(term)
+	if err != nil {
+		return nil, err
+	}
+
+	// 1. 按位置分组，最后修改时间作为 DTSTAMP，保证相同数据的输出相同
+	series := map[seriesKey]map[int]calendarLesson{}
+	lastModified := term.UpdatedAt
+	for _, lesson := range lessons {
+		if lesson.Row < 0 || lesson.Row >= len(ct.periods) || lesson.Col < 0 || lesson.Col > 6 {
+			continue
+		}
+		key := seriesKey{lesson.ClassID, lesson.CourseID, lesson.Row, lesson.Col}
+		if series[key] == nil {
+			series[key] = map[int]calendarLesson{}
+		}
+		series[key][lesson.Week] = lesson
+		if lesson.UpdatedAt.After(lastModified) {
+			lastModified = lesson.UpdatedAt
+		}
+	}
+	keys := make([]seriesKey, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.ClassID != b.ClassID {
+			return a.ClassID < b.ClassID
+		}
+		if a.Col != b.Col {
+			return a.Col < b.Col
+		}
+		if a.Row != b.Row {
+			return a.Row < b.Row
+		}
+		return a.CourseID < b.CourseID
+	})
+
+	w := &calendarWriter{}
+	w.line("BEGIN:VCALENDAR")
+	w.line("VERSION:2.0")
+	w.line("PRODID:%s", calendarProductID)
+	w.line("CALSCALE:GREGORIAN")
+	w.line("METHOD:PUBLISH")
+	w.line("X-WR-CALNAME:%s", escapeText(name+" "+term.Name))
+	w.line("X-WR-TIMEZONE:%s", ct.location.String())
+	if err := w.writeTimezone(ct); err != nil {
+		return nil, err
+	}
+
+	tzid := ct.location.String()
+	stamp := icsUTC(lastModified)
+	localTime := func(t time.Time) string {
+		return fmt.Sprintf("TZID=%s:%s", tzid, t.Format(icsDateTime))
+	}
+
+	for _, key := range keys {
+		byWeek := series[key]
+		weeks := make([]int, 0, len(byWeek))
+		for week := range byWeek {
+			weeks = append(weeks, week)
+		}
+		sort.Ints(weeks)
+
+		for index, run := range splitSeries(weeks) {
+			// 2. 系列的 UID：第一段只由班级、课程和位置决定，之后各段加上开始周
+			uid := fmt.Sprintf("term%d-class%d-course%d-r%d-c%d", term.ID, key.ClassID, key.CourseID, key.Row, key.Col)
+			if index > 0 {
+				uid += fmt.Sprintf("-w%d", run[0])
+			}
+			uid += "@" + calendarUIDDomain
+
+			// 3. 系列使用出现最多的教师和教室，其他周单独覆盖
+			teachers, rooms := make([]string, len(run)), make([]string, len(run))
+			for i, week := range run {
+				teachers[i], rooms[i] = byWeek[week].Teacher, byWeek[week].Room
+			}
+			teacher, room := mostCommon(teachers), mostCommon(rooms)
+			first := byWeek[run[0]]
+
+			interval := seriesInterval(run)
+			count := (run[len(run)-1]-run[0])/interval + 1
+			present := map[int]bool{}
+			for _, week := range run {
+				present[week] = true
+			}
+
+			var exdates, rdates []string
+			var overrides []int
+			cancelled := false
+			for week := run[0]; week <= run[len(run)-1]; week += interval {
+				date, err := ct.slotDate(week, key.Col)
+				if err != nil {
+					return nil, err
+				}
+				start, _ := ct.lessonTime(date, key.Row)
+				switch {
+				case !present[week] || ct.holidays[date.Format(dateLayout)]:
+					if count == 1 {
+						cancelled = true
+					} else {
+						exdates = append(exdates, start.Format(icsDateTime))
+					}
+				case byWeek[week].Teacher != teacher || byWeek[week].Room != room:
+					overrides = append(overrides, week)
+				}
+				// 调休补课日按该天的课表上课
+				if present[week] {
+					for _, workday := range ct.workdays[week] {
+						if ct.follows[workday] != key.Col {
+							continue
+						}
+						extra, err := parseDate(workday)
+						if err != nil {
+							return nil, err
+						}
+						extraStart, _ := ct.lessonTime(extra, key.Row)
+						rdates = append(rdates, extraStart.Format(icsDateTime))
+					}
+				}
+			}
+
+			writeEvent := func(week int, teacher string, room string, recurrence bool) error {
+				date, err := ct.slotDate(week, key.Col)
+				if err != nil {
+					return err
+				}
+				start, end := ct.lessonTime(date, key.Row)
+				w.line("BEGIN:VEVENT")
+				w.line("UID:%s", uid)
+				w.line("DTSTAMP:%s", stamp)
+				w.line("LAST-MODIFIED:%s", stamp)
+				if recurrence {
+					w.line("RECURRENCE-ID;%s", localTime(start))
+				}
+				w.line("DTSTART;%s", localTime(start))
+				w.line("DTEND;%s", localTime(end))
+				if !recurrence {
+					if count > 1 {
+						rule := fmt.Sprintf("FREQ=WEEKLY;COUNT=%d", count)
+						if interval > 1 {
+							rule = fmt.Sprintf("FREQ=WEEKLY;INTERVAL=%d;COUNT=%d", interval, count)
+						}
+						w.line("RRULE:%s", rule)
+					}
+					if len(exdates) > 0 {
+						w.line("EXDATE;TZID=%s:%s", tzid, strings.Join(exdates, ","))
+					}
+					if len(rdates) > 0 {
+						w.line("RDATE;TZID=%s:%s", tzid, strings.Join(rdates, ","))
+					}
+				}
+				summary := first.CourseName
+				if showClass {
+					summary += " (" + first.ClassName + ")"
+				}
+				w.line("SUMMARY:%s", escapeText(summary))
+				if room != "" {
+					w.line("LOCATION:%s", escapeText(room))
+				}
+				description := []string{"Class: " + first.ClassName}
+				if first.CourseCode != "" {
+					description = append(description, "Course code: "+first.CourseCode)
+				}
+				if teacher != "" {
+					description = append(description, "Teacher: "+teacher)
+				}
+				w.line("DESCRIPTION:%s", escapeText(strings.Join(description, "\n")))
+				if cancelled {
+					w.line("STATUS:CANCELLED")
+				}
+				w.line("END:VEVENT")
+				return nil
+			}
+
+			// 4. 输出系列及各周的覆盖
+			if err := writeEvent(run[0], teacher, room, false); err != nil {
+				return nil, err
+			}
+			for _, week := range overrides {
+				if err := writeEvent(week, byWeek[week].Teacher, byWeek[week].Room, true); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	w.line("END:VCALENDAR")
+	return &Calendar{Content: w.builder.String(), LastModified: lastModified}, nil
+}
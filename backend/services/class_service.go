@@ -0,0 +1,310 @@
+package services
+
+import (
+	"errors"
+	"reschedule-program/database"
+	"reschedule-program/models"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidClassName  = errors.New("class name must not be empty or contain '/'")
+	ErrClassExists       = errors.New("class name already exists")
+	ErrClassHasSchedules = errors.New("class still has schedules")
+	ErrClassArchived     = errors.New("class is archived")
+	ErrInvalidClassSize  = errors.New("class size must not be negative")
+	ErrOwnerNotFound     = errors.New("class owner user not found")
+)
+
+// ClassData 前端传来的班级数据
+type ClassData struct {
+	Name    string  `json:"name"`
+	Size    *int    `json:"size"`    // 班级人数，为空时不修改
+	OwnerID *string `json:"ownerId"` // 班级负责人的用户ID，为空时不修改，空字符串表示取消负责人
+}
+
+// ensureClassOwner 检查班级负责人是否为已有用户，空字符串表示不设置负责人
+func ensureClassOwner(db *gorm.DB, ownerID *string) error {
+	if ownerID == nil || *ownerID == "" {
+		return nil
+	}
+	var count int64
+	if err := db.Model(&models.User{}).Where("user_id = ?", *ownerID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrOwnerNotFound
+	}
+	return nil
+}
+
+// ClassInfo 班级及其课程记录数
+type ClassInfo struct {
+	models.Class
+	ScheduleCount int64 `json:"scheduleCount"`
+}
+
+// normalizeClassName 校验班级名；班级名作为 /api/schedule/class/:className 的路径参数，不能包含 '/'
+func normalizeClassName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || strings.Contains(name, "/") {
+		return "", ErrInvalidClassName
+	}
+	return name, nil
+}
+
+// classNameTaken 检查班级名是否已被其他班级使用
+func classNameTaken(db *gorm.DB, name string, excludeID uint) (bool, error) {
+	var count int64
+	err := db.Model(&models.Class{}).Unscoped().Where("name = ? AND id <> ?", name, excludeID).Count(&count).Error
+	return count > 0, err
+}
+
+// GetClass 根据ID获取班级
+func GetClass(id uint) (*models.Class, error) {
+	var class models.Class
+	if err := database.DB.First(&class, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrClassNotFound
+		}
+		return nil, err
+	}
+	return &class, nil
+}
+
+// ListClasses 获取班级及课程记录数，includeArchived 为 false 时不含已归档班级
+func ListClasses(includeArchived bool) ([]ClassInfo, error) {
+	var classes []models.Class
+	query := database.DB.Order("name")
+	if !includeArchived {
+		query = query.Where("archived = ?", false)
+	}
+	if err := query.Find(&classes).Error; err != nil {
+		return nil, err
+	}
+
+	var counts []struct {
+		ClassID uint
+		Count   int64
+	}
+	if err := database.DB.Model(&models.WeeklySchedule{}).Select("class_id, COUNT(*) AS count").
+		Group("class_id").Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	countByClass := make(map[uint]int64, len(counts))
+	for _, row := range counts {
+		countByClass[row.ClassID] = row.Count
+	}
+
+	infos := make([]ClassInfo, 0, len(classes))
+	for _, class := range classes {
+		infos = append(infos, ClassInfo{Class: class, ScheduleCount: countByClass[class.ID]})
+	}
+	return infos, nil
+}
+
+// CreateClass 创建班级
+func CreateClass(actor Actor, data ClassData) (*models.Class, error) {
+	name, err := normalizeClassName(data.Name)
+	if err != nil {
+		return nil, err
+	}
+	if data.Size != nil && *data.Size < 0 {
+		return nil, ErrInvalidClassSize
+	}
+
+	taken, err := classNameTaken(database.DB, name, 0)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, ErrClassExists
+	}
+	if err := ensureClassOwner(database.DB, data.OwnerID); err != nil {
+		return nil, err
+	}
+
+	class := models.Class{Name: name}
+	if data.Size != nil {
+		class.Size = *data.Size
+	}
+	if data.OwnerID != nil {
+		class.OwnerID = *data.OwnerID
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&class).Error; err != nil {
+			return err
+		}
+		return RecordActivity(tx, actor, ActivityEvent{
+			Action: models.ActivityClassCreate, EntityType: models.EntityClass, EntityID: class.ID, EntityName: class.Name,
+			ClassID: class.ID, After: class,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &class, nil
+}
+
+// UpdateClass 重命名班级或修改班级人数，课程记录通过班级ID关联，不需要改动
+func UpdateClass(actor Actor, id uint, data ClassData) (*models.Class, error) {
+	name, err := normalizeClassName(data.Name)
+	if err != nil {
+		return nil, err
+	}
+	if data.Size != nil && *data.Size < 0 {
+		return nil, ErrInvalidClassSize
+	}
+
+	var class models.Class
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&class, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrClassNotFound
+			}
+			return err
+		}
+
+		taken, err := classNameTaken(tx, name, id)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return ErrClassExists
+		}
+		if err := ensureClassOwner(tx, data.OwnerID); err != nil {
+			return err
+		}
+
+		before := class
+		updates := map[string]interface{}{"name": name}
+		if data.Size != nil {
+			updates["size"] = *data.Size
+		}
+		if data.OwnerID != nil {
+			updates["owner_id"] = *data.OwnerID
+		}
+		if err := tx.Model(&class).Updates(updates).Error; err != nil {
+			return err
+		}
+		return RecordActivity(tx, actor, ActivityEvent{
+			Action: models.ActivityClassUpdate, EntityType: models.EntityClass, EntityID: class.ID, EntityName: class.Name,
+			ClassID: class.ID, Before: before, After: class,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &class, nil
+}
+
+// SetClassArchived 归档或取消归档班级
+func SetClassArchived(actor Actor, id uint, archived bool) (*models.Class, error) {
+	class, err := GetClass(id)
+	if err != nil {
+		return nil, err
+	}
+	action := models.ActivityClassArchive
+	if !archived {
+		action = models.ActivityClassUnarchive
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		before := *class
+		if err := tx.Model(class).Update("archived", archived).Error; err != nil {
+			return err
+		}
+		return RecordActivity(tx, actor, ActivityEvent{
+			Action: action, EntityType: models.EntityClass, EntityID: class.ID, EntityName: class.Name,
+			ClassID: class.ID, Before: before, After: class,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return class, nil
+}
+
+// DeleteClass 删除班级；cascade 为 true 时同时删除其所有课程记录，否则班级仍有课程时拒绝删除。
+// 删除的草稿课程按学期记入变更历史并推送给订阅者；班级的日历订阅被撤销，调课申请被删除，
+// 撤销日志中涉及该班级的记录一并删除，变更历史保留。返回被删除的班级和课程记录数
+func DeleteClass(actor Actor, id uint, cascade bool) (*models.Class, int64, error) {
+	var class models.Class
+	var deleted int64
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&class, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrClassNotFound
+			}
+			return err
+		}
+
+		var schedules []models.WeeklySchedule
+		if err := tx.Where("class_id = ?", id).Order("term_id, week_number, time_slot_row, time_slot_col").
+			Find(&schedules).Error; err != nil {
+			return err
+		}
+		var published int64
+		if err := tx.Model(&models.PublishedSchedule{}).Where("class_id = ?", id).Count(&published).Error; err != nil {
+			return err
+		}
+		if (len(schedules) > 0 || published > 0) && !cascade {
+			return ErrClassHasSchedules
+		}
+
+		// 1. 按学期记录删除的草稿课程
+		byTerm := map[uint][]models.WeeklySchedule{}
+		var termIDs []uint
+		for _, row := range schedules {
+			if _, ok := byTerm[row.TermID]; !ok {
+				termIDs = append(termIDs, row.TermID)
+			}
+			byTerm[row.TermID] = append(byTerm[row.TermID], row)
+		}
+		for _, termID := range termIDs {
+			if err := recordScheduleChange(tx, actor, models.ScheduleChangeDelete, termID, id, byTerm[termID], nil); err != nil {
+				return err
+			}
+		}
+
+		// 2. 删除草稿（包括已软删除的记录）和已发布的课程，均直接删除记录
+		if err := tx.Unscoped().Where("class_id = ?", id).Delete(&models.WeeklySchedule{}).Error; err != nil {
+			return err
+		}
+		deleted = int64(len(schedules))
+		if err := tx.Unscoped().Where("class_id = ?", id).Delete(&models.PublishedSchedule{}).Error; err != nil {
+			return err
+		}
+
+		// 3. 撤销日历订阅，删除调课申请和撤销日志
+		feeds := tx.Where("scope = ? AND target_id = ?", models.CalendarScopeClass, id).Delete(&models.CalendarFeed{})
+		if feeds.Error != nil {
+			return feeds.Error
+		}
+		requests := tx.Where("class_id = ?", id).Delete(&models.RescheduleRequest{})
+		if requests.Error != nil {
+			return requests.Error
+		}
+		if err := tx.Where("change_id IN (?)", tx.Model(&models.ScheduleChange{}).Select("id").Where("class_id = ?", id)).
+			Delete(&models.UndoEntry{}).Error; err != nil {
+			return err
+		}
+
+		// 硬删除，释放班级名的唯一索引
+		if err := tx.Unscoped().Delete(&class).Error; err != nil {
+			return err
+		}
+		return RecordActivity(tx, actor, ActivityEvent{
+			Action: models.ActivityClassDelete, EntityType: models.EntityClass, EntityID: class.ID, EntityName: class.Name,
+			ClassID: class.ID, Before: class, After: map[string]interface{}{
+				"deletedSchedules": deleted, "revokedFeeds": feeds.RowsAffected, "deletedRequests": requests.RowsAffected,
+			},
+		})
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	publishScheduleEvents()
+	return &class, deleted, nil
+}
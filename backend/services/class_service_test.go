@@ -0,0 +1,114 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"reschedule-program/database"
+	"reschedule-program/models"
+	"testing"
+)
+
+// setupClassFixture 两个班级，各有草稿和已发布的课程、日历订阅和调课申请
+func setupClassFixture(t *testing.T) {
+	t.Helper()
+	setupTestDB(t)
+
+	mustCreate(t, &models.Class{Name: "C1"})
+	mustCreate(t, &models.Class{Name: "C2"})
+	mustCreate(t, &models.Course{Name: "数学"})
+	for classID := uint(1); classID <= 2; classID++ {
+		for week := 1; week <= 2; week++ {
+			mustCreate(t, &models.WeeklySchedule{ClassID: classID, CourseID: 1, WeekNumber: week, TimeSlotRow: 0, TimeSlotCol: 0})
+			mustCreate(t, &models.PublishedSchedule{ClassID: classID, CourseID: 1, WeekNumber: week, TimeSlotRow: 0, TimeSlotCol: 0})
+		}
+		mustCreate(t, &models.CalendarFeed{Scope: models.CalendarScopeClass, TargetID: classID, Token: "token-" + string(rune('0'+classID))})
+		mustCreate(t, &models.RescheduleRequest{
+			ClassID: classID, Action: models.RescheduleCancel, WeekNumber: 2, Reason: "sick",
+			Status: models.RescheduleRequestPending,
+		})
+	}
+}
+
+func countRows(t *testing.T, model interface{}, query string, args ...interface{}) int64 {
+	t.Helper()
+	var count int64
+	if err := database.DB.Model(model).Where(query, args...).Count(&count).Error; err != nil {
+		t.Fatalf("count %T: %v", model, err)
+	}
+	return count
+}
+
+func TestDeleteClassRequiresCascade(t *testing.T) {
+	setupClassFixture(t)
+
+	if _, _, err := DeleteClass(Actor{}, 1, false); !errors.Is(err, ErrClassHasSchedules) {
+		t.Fatalf("err = %v, want ErrClassHasSchedules", err)
+	}
+	if count := countRows(t, &models.Class{}, "id = ?", 1); count != 1 {
+		t.Errorf("class deleted without cascade")
+	}
+}
+
+func TestDeleteClassCascade(t *testing.T) {
+	setupClassFixture(t)
+	// 用户删除一节课，记入变更历史和撤销日志
+	if err := DeleteSchedule(Actor{UserID: "1234567890", Username: "bob"}, "C1", 2, 0, 0); err != nil {
+		t.Fatalf("DeleteSchedule: %v", err)
+	}
+
+	class, deleted, err := DeleteClass(Actor{Username: "Admin"}, 1, true)
+	if err != nil {
+		t.Fatalf("DeleteClass: %v", err)
+	}
+	if class.Name != "C1" || deleted != 1 {
+		t.Errorf("DeleteClass = %s, %d deleted; want C1, 1", class.Name, deleted)
+	}
+
+	// 课程、订阅、申请和撤销日志都不再指向被删除的班级
+	for _, check := range []struct {
+		model interface{}
+		query string
+	}{
+		{&models.WeeklySchedule{}, "class_id = ?"},
+		{&models.PublishedSchedule{}, "class_id = ?"},
+		{&models.CalendarFeed{}, "scope = 'class' AND target_id = ?"},
+		{&models.RescheduleRequest{}, "class_id = ?"},
+	} {
+		if count := countRows(t, check.model, check.query, 1); count != 0 {
+			t.Errorf("%T: %d rows left for the deleted class", check.model, count)
+		}
+	}
+	if count := countRows(t, &models.UndoEntry{}, "1 = 1"); count != 0 {
+		t.Errorf("undo journal still has %d entries for the deleted class", count)
+	}
+	if _, err := FeedCalendar("token-1", nil); !errors.Is(err, ErrFeedNotFound) {
+		t.Errorf("FeedCalendar for the deleted class: err = %v, want ErrFeedNotFound", err)
+	}
+
+	// 其他班级不受影响
+	for _, model := range []interface{}{&models.WeeklySchedule{}, &models.PublishedSchedule{}} {
+		if count := countRows(t, model, "class_id = ?", 2); count != 2 {
+			t.Errorf("%T: class C2 has %d rows, want 2", model, count)
+		}
+	}
+	if count := countRows(t, &models.CalendarFeed{}, "target_id = ?", 2); count != 1 {
+		t.Errorf("class C2 has %d feeds, want 1", count)
+	}
+	if count := countRows(t, &models.RescheduleRequest{}, "class_id = ?", 2); count != 1 {
+		t.Errorf("class C2 has %d requests, want 1", count)
+	}
+
+	// 删除的课程记入变更历史
+	var change models.ScheduleChange
+	if err := database.DB.Where("class_id = ?", 1).Order("id DESC").First(&change).Error; err != nil {
+		t.Fatalf("load change: %v", err)
+	}
+	var before []LessonSnapshot
+	if err := json.Unmarshal([]byte(change.Before), &before); err != nil {
+		t.Fatalf("decode change: %v", err)
+	}
+	if change.Action != models.ScheduleChangeDelete || change.ActorName != "Admin" || len(before) != 1 ||
+		before[0].WeekNumber != 1 || before[0].CourseName != "数学" {
+		t.Errorf("change = %s by %q, before %+v; want the week 1 lesson deleted by Admin", change.Action, change.ActorName, before)
+	}
+}
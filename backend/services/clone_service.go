@@ -0,0 +1,293 @@
+package services
+
+import (
+	"errors"
+	"reschedule-program/database"
+	"reschedule-program/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrCloneSameTarget  = errors.New("source and target are identical")
+	ErrCloneTargetClass = errors.New("target class requires a source class")
+)
+
+// 复制冲突原因
+const (
+	CloneConflictOccupied   = "occupied"          // 目标位置已有课程
+	CloneConflictWeekBounds = "week_out_of_range" // 偏移后的周数超出目标学期
+	CloneConflictTeacher    = "teacher_conflict"  // 任课教师同一时间已在其他班级上课
+	CloneConflictRoom       = "room_conflict"     // 教室同一时间已被其他班级使用
+	CloneConflictCourse     = "unknown_course"    // 要求课程已在目录中，但目录中没有该课程
+)
+
+// CloneData 复制课程表的请求数据
+type CloneData struct {
+	SourceClass  string            `json:"sourceClass"`  // 为空时复制源学期的所有班级
+	TargetClass  string            `json:"targetClass"`  // 为空时与源班级同名
+	SourceTermID uint              `json:"sourceTermId"` // 为 0 时使用当前学期
+	TargetTermID uint              `json:"targetTermId"` // 为 0 时使用当前学期
+	WeekOffset   int               `json:"weekOffset"`   // 目标周数 = 源周数 + WeekOffset
+	CourseMap    map[string]string `json:"courseMap"`    // 课程名重映射：源课程名 -> 目标课程名
+
+	// RejectUnknownCourses 为 true 时重映射后的课程名必须已在课程目录中，否则该课程不复制并记录
+	RejectUnknownCourses bool `json:"rejectUnknownCourses"`
+}
+
+// CloneConflict 复制时未写入目标的课程
+type CloneConflict struct {
+	ClassName      string `json:"className"`
+	CourseName     string `json:"courseName"`
+	WeekNumber     int    `json:"weekNumber"` // 目标周数
+	TimeSlotRow    int    `json:"timeSlotRow"`
+	TimeSlotCol    int    `json:"timeSlotCol"`
+	ExistingCourse string `json:"existingCourse,omitempty"`
+	OtherClassName string `json:"otherClassName,omitempty"` // 教师或教室冲突时占用该资源的班级
+	Reason         string `json:"reason"`
+}
+
+// CloneSummary 复制结果
+type CloneSummary struct {
+	Classes   []string        `json:"classes"`  // 写入的目标班级
+	Copied    int             `json:"copied"`   // 写入的课程记录数
+	Remapped  int             `json:"remapped"` // 其中课程名被重映射的记录数
+	Conflicts []CloneConflict `json:"conflicts"`
+}
+
+// slotKey 班级内一个时间槽的唯一标识
+type slotKey struct {
+	Week int
+	Row  int
+	Col  int
+}
+
+// CloneSchedule 将一个班级或整个学期的课程表复制到另一个班级或学期，在同一事务中完成
+func CloneSchedule(actor Actor, data CloneData) (*CloneSummary, error) {
+	if data.TargetClass != "" && data.SourceClass == "" {
+		return nil, ErrCloneTargetClass
+	}
+
+	// 1. 确定源学期和目标学期
+	active, err := currentTermID()
+	if err != nil {
+		return nil, err
+	}
+	sourceTermID, targetTermID := data.SourceTermID, data.TargetTermID
+	if sourceTermID == 0 {
+		sourceTermID = active
+	}
+	if targetTermID == 0 {
+		targetTermID = active
+	}
+	targetClassName := data.TargetClass
+	if targetClassName == "" {
+		targetClassName = data.SourceClass
+	}
+	if sourceTermID == targetTermID && data.SourceClass == targetClassName && data.WeekOffset == 0 {
+		return nil, ErrCloneSameTarget
+	}
+	maxWeek, err := termWeekCount(targetTermID)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &CloneSummary{Classes: []string{}, Conflicts: []CloneConflict{}}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// 2. 获取源班级
+		var sourceClasses []models.Class
+		if data.SourceClass != "" {
+			var class models.Class
+			if err := tx.Where("name = ?", data.SourceClass).First(&class).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return ErrClassNotFound
+				}
+				return err
+			}
+			sourceClasses = append(sourceClasses, class)
+		} else if err := tx.Where("id IN (?)",
+			tx.Model(&models.WeeklySchedule{}).Select("class_id").Where("term_id = ?", sourceTermID)).
+			Order("name").Find(&sourceClasses).Error; err != nil {
+			return err
+		}
+
+		courseIDs := make(map[string]uint)
+		for _, source := range sourceClasses {
+			name := targetClassName
+			if name == "" {
+				name = source.Name
+			}
+			target, err := findOrCreateClass(tx, name)
+			if err != nil {
+				return err
+			}
+			summary.Classes = append(summary.Classes, target.Name)
+
+			// 3. 读取源课程和目标班级已占用的时间槽
+			var rows []models.WeeklySchedule
+			if err := tx.Preload("Course").Where("term_id = ? AND class_id = ?", sourceTermID, source.ID).
+				Order("week_number, time_slot_row, time_slot_col").Find(&rows).Error; err != nil {
+				return err
+			}
+
+			var existing []models.WeeklySchedule
+			if err := tx.Preload("Course").Where("term_id = ? AND class_id = ?", targetTermID, target.ID).
+				Find(&existing).Error; err != nil {
+				return err
+			}
+			occupied := make(map[slotKey]string, len(existing))
+			for _, row := range existing {
+				occupied[slotKey{row.WeekNumber, row.TimeSlotRow, row.TimeSlotCol}] = row.Course.Name
+			}
+
+			// 4. 逐条写入，目标位置冲突的课程跳过并记录
+			var pending []clonedLesson
+			for _, row := range rows {
+				courseName := row.Course.Name
+				if mapped, ok := data.CourseMap[courseName]; ok && mapped != "" {
+					courseName = mapped
+				}
+				week := row.WeekNumber + data.WeekOffset
+				conflict := CloneConflict{
+					ClassName:   target.Name,
+					CourseName:  courseName,
+					WeekNumber:  week,
+					TimeSlotRow: row.TimeSlotRow,
+					TimeSlotCol: row.TimeSlotCol,
+				}
+
+				if week < 1 || week > maxWeek {
+					conflict.Reason = CloneConflictWeekBounds
+					summary.Conflicts = append(summary.Conflicts, conflict)
+					continue
+				}
+				key := slotKey{week, row.TimeSlotRow, row.TimeSlotCol}
+				if existingCourse, ok := occupied[key]; ok {
+					conflict.Reason = CloneConflictOccupied
+					conflict.ExistingCourse = existingCourse
+					summary.Conflicts = append(summary.Conflicts, conflict)
+					continue
+				}
+
+				courseID, ok := courseIDs[courseName]
+				if !ok {
+					find := findOrCreateCourse
+					if data.RejectUnknownCourses {
+						find = findCourse
+					}
+					course, err := find(tx, courseName)
+					if err != nil && !errors.Is(err, ErrUnknownCourse) {
+						return err
+					}
+					// 目录中没有的课程记为 0，之后同名的课程直接跳过
+					courseID = course.ID
+					courseIDs[courseName] = courseID
+				}
+				if courseID == 0 {
+					conflict.Reason = CloneConflictCourse
+					summary.Conflicts = append(summary.Conflicts, conflict)
+					continue
+				}
+
+				copied := models.WeeklySchedule{
+					TermID:      targetTermID,
+					ClassID:     target.ID,
+					CourseID:    courseID,
+					WeekNumber:  week,
+					TimeSlotRow: row.TimeSlotRow,
+					TimeSlotCol: row.TimeSlotCol,
+					TeacherID:   row.TeacherID,
+					RoomID:      row.RoomID,
+				}
+				if err := tx.Create(&copied).Error; err != nil {
+					return err
+				}
+
+				occupied[key] = courseName
+				pending = append(pending, clonedLesson{row: copied, conflict: conflict, remapped: courseName != row.Course.Name})
+			}
+
+			// 5. 一次检查本班级写入的全部课程，任课教师或教室冲突的撤销写入并记录
+			copiedRows, err := dropClashingCopies(tx, pending, summary)
+			if err != nil {
+				return err
+			}
+
+			if err := recordScheduleChange(tx, actor, models.ScheduleChangeInsert, targetTermID, target.ID, nil, copiedRows); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	publishScheduleEvents()
+	return summary, nil
+}
+
+// clonedLesson 复制写入的一条课程记录，以及发生冲突时要记录的内容
+type clonedLesson struct {
+	row      models.WeeklySchedule
+	conflict CloneConflict
+	remapped bool
+}
+
+// dropClashingCopies 对复制写入的课程统一检查冲突，撤销与其他班级共用教师或教室的课程并记入 summary，
+// 返回保留的课程记录
+func dropClashingCopies(tx *gorm.DB, pending []clonedLesson, summary *CloneSummary) ([]models.WeeklySchedule, error) {
+	rows := make([]models.WeeklySchedule, 0, len(pending))
+	for _, lesson := range pending {
+		rows = append(rows, lesson.row)
+	}
+	clashes, err := checkConflicts(tx, rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// 同一班级每个时间槽只有一条复制的课程，按时间槽取第一个冲突
+	firstClash := make(map[conflictSlot]ScheduleConflict, len(clashes))
+	for _, clash := range clashes {
+		slot := conflictSlot{TermID: rows[0].TermID, Week: clash.WeekNumber, Row: clash.TimeSlotRow, Col: clash.TimeSlotCol}
+		if _, ok := firstClash[slot]; !ok {
+			firstClash[slot] = clash
+		}
+	}
+
+	var kept []models.WeeklySchedule
+	var dropped []uint
+	for _, lesson := range pending {
+		clash, ok := firstClash[slotOf(lesson.row)]
+		if !ok {
+			kept = append(kept, lesson.row)
+			summary.Copied++
+			if lesson.remapped {
+				summary.Remapped++
+			}
+			continue
+		}
+
+		dropped = append(dropped, lesson.row.ID)
+		conflict := lesson.conflict
+		switch clash.Type {
+		case ConflictRoom:
+			conflict.Reason = CloneConflictRoom
+		case ConflictClass:
+			conflict.Reason = CloneConflictOccupied
+			conflict.ExistingCourse = clash.OtherCourseName
+		default:
+			conflict.Reason = CloneConflictTeacher
+		}
+		if clash.Type != ConflictClass {
+			conflict.OtherClassName = clash.OtherClassName
+		}
+		summary.Conflicts = append(summary.Conflicts, conflict)
+	}
+
+	if len(dropped) > 0 {
+		if err := tx.Unscoped().Delete(&models.WeeklySchedule{}, dropped).Error; err != nil {
+			return nil, err
+		}
+	}
+	return kept, nil
+}
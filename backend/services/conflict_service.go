@@ -0,0 +1,296 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"reschedule-program/database"
+	"reschedule-program/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrScheduleConflict = errors.New("schedule conflicts with existing lessons")
+
+	// errDryRun 用于在预览模式下回滚事务
+	errDryRun = errors.New("dry run")
+)
+
+// 冲突类型
+const (
+	ConflictTeacher = "teacher" // 教师同一时间在两个班级上课
+	ConflictRoom    = "room"    // 教室同一时间被两个班级使用
+	ConflictClass   = "class"   // 班级同一时间槽有两节课
+)
+
+// ScheduleConflict 一次写入造成的资源冲突
+type ScheduleConflict struct {
+	Type            string `json:"type"`
+	ResourceID      uint   `json:"resourceId"`
+	ResourceName    string `json:"resourceName"`
+	WeekNumber      int    `json:"weekNumber"`
+	TimeSlotRow     int    `json:"timeSlotRow"`
+	TimeSlotCol     int    `json:"timeSlotCol"`
+	ClassName       string `json:"className"`       // 本次写入的班级
+	CourseName      string `json:"courseName"`      // 本次写入的课程
+	OtherClassName  string `json:"otherClassName"`  // 已占用该资源的班级
+	OtherCourseName string `json:"otherCourseName"` // 已占用该资源的课程
+}
+
+func (c ScheduleConflict) String() string {
+	return fmt.Sprintf("%s %s is double-booked in week %d slot (%d,%d): %s / %s",
+		c.Type, c.ResourceName, c.WeekNumber, c.TimeSlotRow, c.TimeSlotCol, c.ClassName, c.OtherClassName)
+}
+
+// CapacityWarning 班级人数超过教室容量，不阻止写入
+type CapacityWarning struct {
+	RoomID      uint   `json:"roomId"`
+	RoomName    string `json:"roomName"`
+	Capacity    int    `json:"capacity"`
+	ClassName   string `json:"className"`
+	ClassSize   int    `json:"classSize"`
+	WeekNumber  int    `json:"weekNumber"`
+	TimeSlotRow int    `json:"timeSlotRow"`
+	TimeSlotCol int    `json:"timeSlotCol"`
+}
+
+// WriteResult 课程表写操作的检查结果
+type WriteResult struct {
+	Conflicts []ScheduleConflict `json:"conflicts"`
+	Warnings  []CapacityWarning  `json:"warnings"`
+}
+
+// runScheduleWrite 在一个事务中执行课程表写操作，并对写入的课程记录检查冲突和教室容量。
+// 存在冲突时回滚并返回 ErrScheduleConflict；dryRun 为 true 时总是回滚，只返回检查结果
+func runScheduleWrite(dryRun bool, write func(tx *gorm.DB) ([]models.WeeklySchedule, error)) (*WriteResult, error) {
+	result := &WriteResult{}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		written, err := write(tx)
+		if err != nil {
+			return err
+		}
+
+		if result.Conflicts, err = checkConflicts(tx, written); err != nil {
+			return err
+		}
+		if result.Warnings, err = checkCapacity(tx, written); err != nil {
+			return err
+		}
+
+		if dryRun {
+			return errDryRun
+		}
+		if len(result.Conflicts) > 0 {
+			return ErrScheduleConflict
+		}
+		return nil
+	})
+	if errors.Is(err, errDryRun) {
+		return result, nil
+	}
+	if err == nil {
+		publishScheduleEvents()
+	}
+	return result, err
+}
+
+// conflictBatchSize 每次查询的记录或时间槽个数，避免超过数据库的参数个数限制
+const conflictBatchSize = 200
+
+// conflictSlot 学期中某一周的一个时间槽
+type conflictSlot struct {
+	TermID uint
+	Week   int
+	Row    int
+	Col    int
+}
+
+func slotOf(row models.WeeklySchedule) conflictSlot {
+	return conflictSlot{TermID: row.TermID, Week: row.WeekNumber, Row: row.TimeSlotRow, Col: row.TimeSlotCol}
+}
+
+// loadWritten 分批重新读取写入的课程记录及其班级、课程、教室，保持写入顺序
+func loadWritten(tx *gorm.DB, written []models.WeeklySchedule) ([]models.WeeklySchedule, error) {
+	ids := make([]uint, 0, len(written))
+	for _, row := range written {
+		ids = append(ids, row.ID)
+	}
+
+	byID := make(map[uint]models.WeeklySchedule, len(ids))
+	for start := 0; start < len(ids); start += conflictBatchSize {
+		end := min(start+conflictBatchSize, len(ids))
+		var rows []models.WeeklySchedule
+		if err := tx.Preload("Class").Preload("Course").Preload("Room").
+			Where("id IN ?", ids[start:end]).Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			byID[row.ID] = row
+		}
+	}
+
+	loaded := make([]models.WeeklySchedule, 0, len(written))
+	for _, row := range written {
+		if row, ok := byID[row.ID]; ok {
+			loaded = append(loaded, row)
+		}
+	}
+	return loaded, nil
+}
+
+// slotLessons 分批读取指定时间槽中的全部课程记录，按时间槽分组
+func slotLessons(tx *gorm.DB, slots []conflictSlot) (map[conflictSlot][]models.WeeklySchedule, error) {
+	bySlot := make(map[conflictSlot][]models.WeeklySchedule, len(slots))
+	for start := 0; start < len(slots); start += conflictBatchSize {
+		end := min(start+conflictBatchSize, len(slots))
+		keys := make([][]interface{}, 0, end-start)
+		for _, slot := range slots[start:end] {
+			keys = append(keys, []interface{}{slot.TermID, slot.Week, slot.Row, slot.Col})
+		}
+
+		var rows []models.WeeklySchedule
+		if err := tx.Preload("Class").Preload("Course").
+			Where("(term_id, week_number, time_slot_row, time_slot_col) IN ?", keys).
+			Order("id").Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			bySlot[slotOf(row)] = append(bySlot[slotOf(row)], row)
+		}
+	}
+	return bySlot, nil
+}
+
+// roomScheduleScope 筛选使用指定教室的课程记录
+func roomScheduleScope(roomID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("weekly_schedules.room_id = ?", roomID)
+	}
+}
+
+// checkConflicts 检查写入的课程记录是否与同一时间槽的其他课程冲突：
+// 同一班级有两节课，或与其他班级共用教师、教室。每批时间槽只查询一次
+func checkConflicts(tx *gorm.DB, written []models.WeeklySchedule) ([]ScheduleConflict, error) {
+	conflicts := []ScheduleConflict{}
+	if len(written) == 0 {
+		return conflicts, nil
+	}
+
+	// 1. 读取写入的课程记录及其涉及的时间槽
+	rows, err := loadWritten(tx, written)
+	if err != nil {
+		return nil, err
+	}
+	var slots []conflictSlot
+	slotSeen := make(map[conflictSlot]bool)
+	for _, row := range rows {
+		if slot := slotOf(row); !slotSeen[slot] {
+			slotSeen[slot] = true
+			slots = append(slots, slot)
+		}
+	}
+
+	// 2. 一次读取这些时间槽中的全部课程
+	bySlot, err := slotLessons(tx, slots)
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. 读取涉及的教师名称
+	var teacherIDs []uint
+	for _, row := range rows {
+		if teacherID := row.EffectiveTeacherID(); teacherID != nil {
+			teacherIDs = append(teacherIDs, *teacherID)
+		}
+	}
+	teacherNames := make(map[uint]string)
+	if len(teacherIDs) > 0 {
+		var teachers []models.Teacher
+		if err := tx.Where("id IN ?", teacherIDs).Find(&teachers).Error; err != nil {
+			return nil, err
+		}
+		for _, teacher := range teachers {
+			teacherNames[teacher.ID] = teacher.Name
+		}
+	}
+
+	seen := make(map[string]bool)
+	report := func(row models.WeeklySchedule, kind string, resourceID uint, resourceName string, clash models.WeeklySchedule) {
+		// 同一批写入的两条记录互相冲突时只报告一次
+		low, high := row.ID, clash.ID
+		if low > high {
+			low, high = high, low
+		}
+		key := fmt.Sprintf("%s:%d:%d", kind, low, high)
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+
+		conflicts = append(conflicts, ScheduleConflict{
+			Type:            kind,
+			ResourceID:      resourceID,
+			ResourceName:    resourceName,
+			WeekNumber:      row.WeekNumber,
+			TimeSlotRow:     row.TimeSlotRow,
+			TimeSlotCol:     row.TimeSlotCol,
+			ClassName:       row.Class.Name,
+			CourseName:      row.Course.Name,
+			OtherClassName:  clash.Class.Name,
+			OtherCourseName: clash.Course.Name,
+		})
+	}
+
+	// 4. 逐条比较同一时间槽中的其他课程
+	for _, row := range rows {
+		teacherID := row.EffectiveTeacherID()
+		for _, other := range bySlot[slotOf(row)] {
+			if other.ID == row.ID {
+				continue
+			}
+			if other.ClassID == row.ClassID {
+				report(row, ConflictClass, row.ClassID, row.Class.Name, other)
+				continue
+			}
+			if otherTeacherID := other.EffectiveTeacherID(); teacherID != nil && otherTeacherID != nil && *otherTeacherID == *teacherID {
+				report(row, ConflictTeacher, *teacherID, teacherNames[*teacherID], other)
+			}
+			if row.RoomID != nil && other.RoomID != nil && *other.RoomID == *row.RoomID {
+				report(row, ConflictRoom, *row.RoomID, row.Room.Name, other)
+			}
+		}
+	}
+	return conflicts, nil
+}
+
+// checkCapacity 检查写入课程的班级人数是否超过教室容量，未设置人数或容量时不检查
+func checkCapacity(tx *gorm.DB, written []models.WeeklySchedule) ([]CapacityWarning, error) {
+	warnings := []CapacityWarning{}
+	var withRoom []models.WeeklySchedule
+	for _, row := range written {
+		if row.RoomID != nil {
+			withRoom = append(withRoom, row)
+		}
+	}
+	rows, err := loadWritten(tx, withRoom)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		if row.Room == nil || row.Room.Capacity <= 0 || row.Class.Size <= row.Room.Capacity {
+			continue
+		}
+		warnings = append(warnings, CapacityWarning{
+			RoomID:      row.Room.ID,
+			RoomName:    row.Room.Name,
+			Capacity:    row.Room.Capacity,
+			ClassName:   row.Class.Name,
+			ClassSize:   row.Class.Size,
+			WeekNumber:  row.WeekNumber,
+			TimeSlotRow: row.TimeSlotRow,
+			TimeSlotCol: row.TimeSlotCol,
+		})
+	}
+	return warnings, nil
+}
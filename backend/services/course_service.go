@@ -0,0 +1,313 @@
+package services
+
+import (
+	"errors"
+	"regexp"
+	"reschedule-program/database"
+	"reschedule-program/models"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrCourseNotFound   = errors.New("course not found")
+	ErrCourseExists     = errors.New("course code already exists")
+	ErrCourseInUse      = errors.New("course is still used by schedules")
+	ErrInvalidCourse    = errors.New("course name is required, color must be #RRGGBB, credits and weekly hours must not be negative")
+	ErrInvalidMergeList = errors.New("merge requires a target and at least one other source course")
+)
+
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// CourseData 前端传来的课程目录数据
+type CourseData struct {
+	Code        string  `json:"code"`
+	Name        string  `json:"name"`
+	Credits     float64 `json:"credits"`
+	WeeklyHours int     `json:"weeklyHours"`
+	Color       string  `json:"color"`
+	Description string  `json:"description"`
+
+	DefaultTeacherID *uint `json:"defaultTeacherId"`
+}
+
+// CourseMergeResult 合并重复课程的结果
+type CourseMergeResult struct {
+	Target          models.Course `json:"target"`
+	MergedCourseIDs []uint        `json:"mergedCourseIds"`
+	Repointed       int64         `json:"repointed"` // 改为指向目标课程的课程记录数
+}
+
+// validateCourseData 校验并规范化课程目录数据
+func validateCourseData(data *CourseData) error {
+	data.Code = strings.TrimSpace(data.Code)
+	data.Name = strings.TrimSpace(data.Name)
+	if data.Name == "" || data.Credits < 0 || data.WeeklyHours < 0 {
+		return ErrInvalidCourse
+	}
+	if data.Color != "" && !colorPattern.MatchString(data.Color) {
+		return ErrInvalidCourse
+	}
+	return nil
+}
+
+// applyCourseData 将数据写入课程模型，空课程代码存为 NULL 以免违反唯一索引
+func applyCourseData(course *models.Course, data CourseData) {
+	course.Code = nil
+	if data.Code != "" {
+		code := data.Code
+		course.Code = &code
+	}
+	course.Name = data.Name
+	course.Credits = data.Credits
+	course.WeeklyHours = data.WeeklyHours
+	course.Color = data.Color
+	course.Description = data.Description
+	course.DefaultTeacherID = data.DefaultTeacherID
+	course.DefaultTeacher = nil
+}
+
+// courseCodeTaken 检查课程代码是否已被其他课程使用
+func courseCodeTaken(db *gorm.DB, code string, excludeID uint) (bool, error) {
+	if code == "" {
+		return false, nil
+	}
+	var count int64
+	err := db.Model(&models.Course{}).Unscoped().Where("code = ? AND id <> ?", code, excludeID).Count(&count).Error
+	return count > 0, err
+}
+
+// GetAllCourses 获取课程目录
+func GetAllCourses() ([]models.Course, error) {
+	var courses []models.Course
+	err := database.DB.Preload("DefaultTeacher").Order("name").Find(&courses).Error
+	return courses, err
+}
+
+// GetCourse 根据ID获取课程
+func GetCourse(id uint) (*models.Course, error) {
+	var course models.Course
+	if err := database.DB.Preload("DefaultTeacher").First(&course, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCourseNotFound
+		}
+		return nil, err
+	}
+	return &course, nil
+}
+
+// CreateCourse 向课程目录添加课程
+func CreateCourse(actor Actor, data CourseData) (*models.Course, error) {
+	if err := validateCourseData(&data); err != nil {
+		return nil, err
+	}
+
+	if err := ensureTeacher(database.DB, data.DefaultTeacherID); err != nil {
+		return nil, err
+	}
+
+	taken, err := courseCodeTaken(database.DB, data.Code, 0)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, ErrCourseExists
+	}
+
+	var course models.Course
+	applyCourseData(&course, data)
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&course).Error; err != nil {
+			return err
+		}
+		return RecordActivity(tx, actor, ActivityEvent{
+			Action: models.ActivityCourseCreate, EntityType: models.EntityCourse, EntityID: course.ID, EntityName: course.Name,
+			After: course,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &course, nil
+}
+
+// UpdateCourse 更新课程目录中的课程。默认教师变化时，未单独指定教师的课程记录的任课教师随之变化，
+// 与其他写操作一样检查教师冲突，存在冲突时不修改并返回 ErrScheduleConflict；dryRun 为 true 时只返回检查结果
+func UpdateCourse(actor Actor, id uint, data CourseData, dryRun bool) (*models.Course, *WriteResult, error) {
+	if err := validateCourseData(&data); err != nil {
+		return nil, nil, err
+	}
+
+	course, err := GetCourse(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := ensureTeacher(database.DB, data.DefaultTeacherID); err != nil {
+		return nil, nil, err
+	}
+
+	taken, err := courseCodeTaken(database.DB, data.Code, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if taken {
+		return nil, nil, ErrCourseExists
+	}
+
+	before := *course
+	applyCourseData(course, data)
+	result, err := runScheduleWrite(dryRun, func(tx *gorm.DB) ([]models.WeeklySchedule, error) {
+		if err := tx.Save(course).Error; err != nil {
+			return nil, err
+		}
+		if err := RecordActivity(tx, actor, ActivityEvent{
+			Action: models.ActivityCourseUpdate, EntityType: models.EntityCourse, EntityID: course.ID, EntityName: course.Name,
+			Before: before, After: course,
+		}); err != nil {
+			return nil, err
+		}
+
+		if sameUint(before.DefaultTeacherID, course.DefaultTeacherID) || course.DefaultTeacherID == nil {
+			return nil, nil
+		}
+		var affected []models.WeeklySchedule
+		err := tx.Where("course_id = ? AND teacher_id IS NULL", id).Find(&affected).Error
+		return affected, err
+	})
+	if err != nil {
+		return nil, result, err
+	}
+	return course, result, nil
+}
+
+// DeleteCourse 删除课程，仍被课程记录使用时拒绝删除
+func DeleteCourse(actor Actor, id uint) (*models.Course, error) {
+	var course models.Course
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&course, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrCourseNotFound
+			}
+			return err
+		}
+
+		var count, published int64
+		if err := tx.Model(&models.WeeklySchedule{}).Where("course_id = ?", id).Count(&count).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.PublishedSchedule{}).Where("course_id = ?", id).Count(&published).Error; err != nil {
+			return err
+		}
+		if count > 0 || published > 0 {
+			return ErrCourseInUse
+		}
+
+		if err := tx.Unscoped().Delete(&course).Error; err != nil {
+			return err
+		}
+		return RecordActivity(tx, actor, ActivityEvent{
+			Action: models.ActivityCourseDelete, EntityType: models.EntityCourse, EntityID: course.ID, EntityName: course.Name,
+			Before: course,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &course, nil
+}
+
+// MergeCourses 将重复课程合并到目标课程：课程记录改为指向目标课程，然后软删除重复课程。
+// 未单独指定教师的课程记录改用目标课程的默认教师，与其他写操作一样检查教师冲突；dryRun 为 true 时只返回检查结果
+func MergeCourses(actor Actor, targetID uint, sourceIDs []uint, dryRun bool) (*CourseMergeResult, *WriteResult, error) {
+	merged := make([]uint, 0, len(sourceIDs))
+	for _, id := range sourceIDs {
+		if id != targetID {
+			merged = append(merged, id)
+		}
+	}
+	if targetID == 0 || len(merged) == 0 {
+		return nil, nil, ErrInvalidMergeList
+	}
+
+	result := &CourseMergeResult{MergedCourseIDs: merged}
+	check, err := runScheduleWrite(dryRun, func(tx *gorm.DB) ([]models.WeeklySchedule, error) {
+		if err := tx.First(&result.Target, targetID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrCourseNotFound
+			}
+			return nil, err
+		}
+
+		var sources []models.Course
+		if err := tx.Where("id IN ?", merged).Find(&sources).Error; err != nil {
+			return nil, err
+		}
+		if len(sources) != len(merged) {
+			return nil, ErrCourseNotFound
+		}
+		defaults := make(map[uint]*uint, len(sources))
+		for _, source := range sources {
+			defaults[source.ID] = source.DefaultTeacherID
+		}
+
+		var affected []models.WeeklySchedule
+		if err := tx.Where("course_id IN ?", merged).Order("term_id, class_id").Find(&affected).Error; err != nil {
+			return nil, err
+		}
+		update := tx.Model(&models.WeeklySchedule{}).Where("course_id IN ?", merged).Update("course_id", targetID)
+		if update.Error != nil {
+			return nil, update.Error
+		}
+		result.Repointed = update.RowsAffected
+
+		// 任课教师随默认教师变化的课程记录需要检查教师冲突
+		var retaught []models.WeeklySchedule
+		for _, row := range affected {
+			if row.TeacherID == nil && result.Target.DefaultTeacherID != nil &&
+				!sameUint(defaults[row.CourseID], result.Target.DefaultTeacherID) {
+				retaught = append(retaught, row)
+			}
+		}
+
+		// 按班级记录课程变更，需在删除重复课程之前记录以保留原课程名称
+		for start := 0; start < len(affected); {
+			end := start
+			for end < len(affected) && affected[end].TermID == affected[start].TermID && affected[end].ClassID == affected[start].ClassID {
+				end++
+			}
+			before := affected[start:end]
+			after := make([]models.WeeklySchedule, len(before))
+			for i, row := range before {
+				row.CourseID = targetID
+				after[i] = row
+			}
+			if err := recordScheduleChange(tx, actor, models.ScheduleChangeUpdate, before[0].TermID, before[0].ClassID, before, after); err != nil {
+				return nil, err
+			}
+			start = end
+		}
+
+		// 已发布版本同样指向目标课程
+		if err := tx.Model(&models.PublishedSchedule{}).Where("course_id IN ?", merged).Update("course_id", targetID).Error; err != nil {
+			return nil, err
+		}
+
+		// 软删除，恢复合并之前的历史版本时可以重新启用；课程代码仍被占用
+		if err := tx.Where("id IN ?", merged).Delete(&models.Course{}).Error; err != nil {
+			return nil, err
+		}
+		if err := RecordActivity(tx, actor, ActivityEvent{
+			Action: models.ActivityCourseMerge, EntityType: models.EntityCourse, EntityID: targetID, EntityName: result.Target.Name,
+			Before: map[string]interface{}{"courses": sources}, After: result,
+		}); err != nil {
+			return nil, err
+		}
+		return retaught, nil
+	})
+	if err != nil {
+		return nil, check, err
+	}
+	return result, check, nil
+}
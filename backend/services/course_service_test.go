@@ -0,0 +1,49 @@
+package services
+
+import (
+	"reschedule-program/database"
+	"reschedule-program/models"
+	"testing"
+)
+
+func TestRevertBeforeMergeRestoresMergedCourse(t *testing.T) {
+	setupTestDB(t)
+	mustCreate(t, &models.Course{Name: "高等数学"})
+	mustCreate(t, &models.Course{Name: "高数"})
+
+	data := ScheduleData{ClassName: "C1", RejectUnknownCourses: true, Schedule: [][]*CourseAssignmentData{
+		{lessonData("高等数学", 1), lessonData("高数", 1)},
+	}}
+	if _, err := SaveSchedule(Actor{}, data, false); err != nil {
+		t.Fatalf("SaveSchedule: %v", err)
+	}
+	var saved models.ScheduleChange
+	if err := database.DB.Order("id DESC").First(&saved).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := MergeCourses(Actor{}, 1, []uint{2}, false); err != nil {
+		t.Fatalf("MergeCourses: %v", err)
+	}
+	if _, err := GetCourse(2); err == nil {
+		t.Fatal("merged course still in the catalogue")
+	}
+
+	revert, err := RevertSchedule(Actor{}, "C1", HistoryPoint{ChangeID: saved.ID}, false)
+	if err != nil {
+		t.Fatalf("RevertSchedule: %v", err)
+	}
+	if len(revert.Restored) != 1 || revert.Restored[0].CourseID != 2 {
+		t.Errorf("restored = %+v, want the lesson of course 2", revert.Restored)
+	}
+	course, err := GetCourse(2)
+	if err != nil {
+		t.Fatalf("merged course not restored: %v", err)
+	}
+	if course.Name != "高数" {
+		t.Errorf("restored course name = %q", course.Name)
+	}
+	if count := countRows(t, &models.WeeklySchedule{}, "course_id = ?", 2); count != 1 {
+		t.Errorf("%d lessons of the restored course, want 1", count)
+	}
+}
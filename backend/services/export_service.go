@@ -0,0 +1,475 @@
+package services
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"reschedule-program/database"
+	"reschedule-program/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ExportScopeTerm 导出学期中所有班级的课程表
+const ExportScopeTerm = "term"
+
+var ErrInvalidExportScope = errors.New("scope must be class, teacher, room or term")
+
+// exportWeekdays 网格的列标题，对应列号 0-6
+var exportWeekdays = []string{"周一", "周二", "周三", "周四", "周五", "周六", "周日"}
+
+// ExportOptions 导出选项，班级可用 targetId 或 className 指定
+type ExportOptions struct {
+	Scope     string // class / teacher / room / term
+	TargetID  uint
+	ClassName string
+	TermID    uint // 为 0 时导出当前学期
+	Draft     bool // 导出草稿，默认导出已发布的课程表
+}
+
+// Export 已确定学期和范围的导出，课程在写出时逐行从数据库读取，不整体加载到内存
+type Export struct {
+	Term    *models.Term
+	Scope   string
+	Name    string // 班级、教师、教室或学期的名称
+	draft   bool
+	periods []PeriodTime
+	where   string
+	args    []interface{}
+}
+
+// exportLesson 导出中的一节课
+type exportLesson struct {
+	Week       int
+	SlotRow    int
+	SlotCol    int
+	ClassName  string
+	CourseName string
+	CourseCode string
+	Teacher    string
+	Room       string
+}
+
+// resolveExportTerm 返回导出的学期，termID 为 0 时为当前学期；
+// 未设置学期时导出学期为 0 的课程表，共 20 周，不含日期
+func resolveExportTerm(termID uint) (*models.Term, error) {
+	term, err := resolveTerm(termID)
+	if errors.Is(err, ErrNoActiveTerm) && termID == 0 {
+		return &models.Term{WeekCount: 20, PeriodTimes: defaultPeriodTimes}, nil
+	}
+	return term, err
+}
+
+// exportClassID 导出班级的ID，未指定 targetId 时按 className 查找
+func exportClassID(options ExportOptions) (uint, error) {
+	if options.TargetID != 0 || options.ClassName == "" {
+		return options.TargetID, nil
+	}
+	class, err := findClassByName(database.DB, options.ClassName)
+	if err != nil {
+		return 0, err
+	}
+	return class.ID, nil
+}
+
+// PrepareExport 确定导出的学期和范围，对象不存在时返回对应的错误
+func PrepareExport(options ExportOptions) (*Export, error) {
+	// 1. 学期
+	term, err := resolveExportTerm(options.TermID)
+	if err != nil {
+		return nil, err
+	}
+	periods, err := ParsePeriodTimes(term.PeriodTimes)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. 导出范围
+	export := &Export{Term: term, Scope: options.Scope, draft: options.Draft, periods: periods}
+	table := export.table()
+	switch options.Scope {
+	case models.CalendarScopeClass:
+		if options.TargetID, err = exportClassID(options); err != nil {
+			return nil, err
+		}
+		if export.Name, err = feedTargetName(options.Scope, options.TargetID); err != nil {
+			return nil, err
+		}
+		export.where, export.args = table+".class_id = ?", []interface{}{options.TargetID}
+	case models.CalendarScopeTeacher:
+		if export.Name, err = feedTargetName(options.Scope, options.TargetID); err != nil {
+			return nil, err
+		}
+		// 与教师日历相同：单独指定该教师的课程，以及未指定教师、课程默认教师为该教师的课程
+		export.where = table + ".teacher_id = ? OR (" + table + ".teacher_id IS NULL AND courses.default_teacher_id = ?)"
+		export.args = []interface{}{options.TargetID, options.TargetID}
+	case models.CalendarScopeRoom:
+		if export.Name, err = feedTargetName(options.Scope, options.TargetID); err != nil {
+			return nil, err
+		}
+		export.where, export.args = table+".room_id = ?", []interface{}{options.TargetID}
+	case ExportScopeTerm:
+		export.Name = term.Name
+		if export.Name == "" {
+			export.Name = "timetable"
+		}
+	default:
+		return nil, ErrInvalidExportScope
+	}
+	return export, nil
+}
+
+// table 导出读取的课程表：草稿或已发布版本
+func (e *Export) table() string {
+	if e.draft {
+		return "weekly_schedules"
+	}
+	return "published_schedules"
+}
+
+// rows 按周、班级和位置顺序读取课程的游标
+func (e *Export) rows() (*gorm.DB, *sql.Rows, error) {
+	table := e.table()
+	var query *gorm.DB
+	if e.draft {
+		query = database.DB.Model(&models.WeeklySchedule{})
+	} else {
+		query = database.DB.Model(&models.PublishedSchedule{})
+	}
+	query = query.Select(table+".week_number AS week, "+table+".time_slot_row AS slot_row, "+
+		table+".time_slot_col AS slot_col, classes.name AS class_name, courses.name AS course_name, "+
+		"COALESCE(courses.code, '') AS course_code, COALESCE(teachers.name, default_teachers.name, '') AS teacher, "+
+		"COALESCE(rooms.name, '') AS room").
+		Joins("JOIN classes ON classes.id = "+table+".class_id").
+		Joins("JOIN courses ON courses.id = "+table+".course_id").
+		Joins("LEFT JOIN teachers ON teachers.id = "+table+".teacher_id AND teachers.deleted_at IS NULL").
+		Joins("LEFT JOIN teachers AS default_teachers ON default_teachers.id = courses.default_teacher_id AND default_teachers.deleted_at IS NULL").
+		Joins("LEFT JOIN rooms ON rooms.id = "+table+".room_id AND rooms.deleted_at IS NULL").
+		Where(table+".term_id = ?", e.Term.ID)
+	if e.where != "" {
+		query = query.Where(e.where, e.args...)
+	}
+
+	order := table + ".week_number, classes.name, " + table + ".time_slot_row, " + table + ".time_slot_col, courses.name"
+	if e.Scope != ExportScopeTerm {
+		order = table + ".week_number, " + table + ".time_slot_row, " + table + ".time_slot_col, classes.name, courses.name"
+	}
+	rows, err := query.Order(order).Rows()
+	return query, rows, err
+}
+
+// eachLesson 按顺序对每节课调用 fn
+func (e *Export) eachLesson(fn func(lesson *exportLesson) error) error {
+	query, rows, err := e.rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var lesson exportLesson
+		if err := query.ScanRows(rows, &lesson); err != nil {
+			return err
+		}
+		if err := fn(&lesson); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// WriteCSV 以长格式导出 CSV：每周每节课一行，列名与导入格式兼容，可直接重新导入
+func (e *Export) WriteCSV(w io.Writer) error {
+	// 未设置学期时日期列为空
+	var start time.Time
+	if e.Term.ID != 0 {
+		var err error
+		if start, err = parseDate(e.Term.StartDate); err != nil {
+			return err
+		}
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"class", "course", "code", "day", "period", "week", "date", "teacher", "room"}); err != nil {
+		return err
+	}
+	err := e.eachLesson(func(lesson *exportLesson) error {
+		date := ""
+		if !start.IsZero() {
+			date = start.AddDate(0, 0, (lesson.Week-1)*7+lesson.SlotCol).Format(dateLayout)
+		}
+		return writer.Write([]string{
+			lesson.ClassName, lesson.CourseName, lesson.CourseCode,
+			strconv.Itoa(lesson.SlotCol + 1), strconv.Itoa(lesson.SlotRow + 1), strconv.Itoa(lesson.Week),
+			date, lesson.Teacher, lesson.Room,
+		})
+	})
+	if err != nil {
+		return err
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// xlsx 工作簿的固定部分
+const (
+	xlsxContentTypesHead = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+		`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`
+	xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+		`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`
+	// 样式：1 标题（粗体），2 表头（粗体、边框、居中），3 课程单元格（边框、自动换行）
+	xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+		`<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+		`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+		`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+		`<borders count="2"><border><left/><right/><top/><bottom/><diagonal/></border>` +
+		`<border><left style="thin"/><right style="thin"/><top style="thin"/><bottom style="thin"/><diagonal/></border></borders>` +
+		`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+		`<cellXfs count="4"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+		`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+		`<xf numFmtId="0" fontId="1" fillId="0" borderId="1" xfId="0" applyFont="1" applyBorder="1" applyAlignment="1">` +
+		`<alignment horizontal="center" vertical="center" wrapText="1"/></xf>` +
+		`<xf numFmtId="0" fontId="0" fillId="0" borderId="1" xfId="0" applyBorder="1" applyAlignment="1">` +
+		`<alignment vertical="top" wrapText="1"/></xf></cellXfs>` +
+		`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+		`</styleSheet>`
+	xlsxSheetHead = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+		`<cols><col min="1" max="1" width="14" customWidth="1"/><col min="2" max="8" width="22" customWidth="1"/></cols>` +
+		`<sheetData>`
+	xlsxSheetTail = `</sheetData></worksheet>`
+)
+
+const (
+	xlsxStyleTitle  = 1
+	xlsxStyleHeader = 2
+	xlsxStyleCell   = 3
+)
+
+// createXLSXPart 在工作簿中添加一个文件，使用固定的修改时间，相同数据导出的文件相同
+func createXLSXPart(zw *zip.Writer, name string) (io.Writer, error) {
+	return zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC),
+	})
+}
+
+// sheetWriter 逐行写出一个工作表
+type sheetWriter struct {
+	w   io.Writer
+	row int
+	err error
+}
+
+// cellText 单元格的 XML 文本
+func cellText(value string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(value))
+	return b.String()
+}
+
+// writeRow 写出一行，cells 依次为 A、B、C... 列，空字符串表示空单元格
+func (s *sheetWriter) writeRow(style int, cells ...string) {
+	s.row++
+	if s.err != nil {
+		return
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, `<row r="%d">`, s.row)
+	for i, value := range cells {
+		cellStyle := style
+		if style == xlsxStyleCell && i == 0 {
+			cellStyle = xlsxStyleHeader // 节次列
+		}
+		if value == "" && cellStyle != xlsxStyleCell && cellStyle != xlsxStyleHeader {
+			continue
+		}
+		fmt.Fprintf(&b, `<c r="%c%d" s="%d"`, 'A'+i, s.row, cellStyle)
+		if value != "" {
+			fmt.Fprintf(&b, ` t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, cellText(value))
+		} else {
+			b.WriteString(`/>`)
+		}
+	}
+	b.WriteString(`</row>`)
+	_, s.err = io.WriteString(s.w, b.String())
+}
+
+// skipRow 空一行
+func (s *sheetWriter) skipRow() {
+	s.row++
+}
+
+// exportGrid 一个 5×7 的课程网格
+type exportGrid struct {
+	title string
+	cells [periodCount][7][]string
+}
+
+// cellLines 单元格中一节课的内容：课程名，其后为导出对象以外的班级、教师和教室
+func (e *Export) cellLines(lesson *exportLesson) string {
+	parts := append([]string{lesson.CourseName}, lessonDetails(e.Scope, lesson.ClassName, lesson.Teacher, lesson.Room)...)
+	return strings.Join(parts, "\n")
+}
+
+// writeGrid 写出一个网格：标题行、星期表头和5个时间段
+func (e *Export) writeGrid(sheet *sheetWriter, grid *exportGrid) {
+	sheet.writeRow(xlsxStyleTitle, grid.title)
+	sheet.writeRow(xlsxStyleHeader, append([]string{""}, exportWeekdays...)...)
+	for row := 0; row < periodCount; row++ {
+		cells := []string{fmt.Sprintf("第%d节\n%s", row+1, e.periods[row])}
+		for col := 0; col < 7; col++ {
+			cells = append(cells, strings.Join(grid.cells[row][col], "\n\n"))
+		}
+		sheet.writeRow(xlsxStyleCell, cells...)
+	}
+	sheet.skipRow()
+}
+
+// WriteXLSX 导出 XLSX 工作簿：每周一个工作表，按页面上的 5×7 网格排列；
+// 导出整个学期时每个工作表依次列出当周有课的班级。工作表逐个写出，内存中最多保留一个网格
+func (e *Export) WriteXLSX(w io.Writer) error {
+	zw := zip.NewWriter(w)
+	writePart := func(name string, content string) error {
+		part, err := createXLSXPart(zw, name)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(part, content)
+		return err
+	}
+
+	// 1. 固定部分
+	var contentTypes strings.Builder
+	contentTypes.WriteString(xlsxContentTypesHead)
+	var workbook strings.Builder
+	workbook.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+		`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	var workbookRels strings.Builder
+	workbookRels.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+		`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for week := 1; week <= e.Term.WeekCount; week++ {
+		fmt.Fprintf(&contentTypes, `<Override PartName="/xl/worksheets/sheet%d.xml" `+
+			`ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, week)
+		fmt.Fprintf(&workbook, `<sheet name="第%d周" sheetId="%d" r:id="rId%d"/>`, week, week, week)
+		fmt.Fprintf(&workbookRels, `<Relationship Id="rId%d" `+
+			`Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" `+
+			`Target="worksheets/sheet%d.xml"/>`, week, week)
+	}
+	contentTypes.WriteString(`</Types>`)
+	workbook.WriteString(`</sheets></workbook>`)
+	fmt.Fprintf(&workbookRels, `<Relationship Id="rId%d" `+
+		`Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`,
+		e.Term.WeekCount+1)
+	workbookRels.WriteString(`</Relationships>`)
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", contentTypes.String()},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", workbook.String()},
+		{"xl/_rels/workbook.xml.rels", workbookRels.String()},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, part := range parts {
+		if err := writePart(part.name, part.content); err != nil {
+			return err
+		}
+	}
+
+	// 2. 按周顺序写出工作表。课程按周排序，当前周的网格写完后再开始下一个
+	var sheet *sheetWriter
+	var grid *exportGrid
+	week := 0
+	flushGrid := func() {
+		if grid != nil {
+			e.writeGrid(sheet, grid)
+			grid = nil
+		}
+	}
+	closeSheet := func() error {
+		if sheet == nil {
+			return nil
+		}
+		if e.Scope != ExportScopeTerm && grid == nil {
+			grid = &exportGrid{title: fmt.Sprintf("%s 第%d周", e.Name, week)}
+		}
+		flushGrid()
+		if sheet.err != nil {
+			return sheet.err
+		}
+		_, err := io.WriteString(sheet.w, xlsxSheetTail)
+		sheet = nil
+		return err
+	}
+	openSheet := func(number int) error {
+		part, err := createXLSXPart(zw, fmt.Sprintf("xl/worksheets/sheet%d.xml", number))
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(part, xlsxSheetHead); err != nil {
+			return err
+		}
+		sheet, week = &sheetWriter{w: part}, number
+		return nil
+	}
+	// advance 写完 target 之前的所有周（包括没有课的周），并打开第 target 周的工作表
+	advance := func(target int) error {
+		for week < target {
+			if err := closeSheet(); err != nil {
+				return err
+			}
+			if err := openSheet(week + 1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	err := e.eachLesson(func(lesson *exportLesson) error {
+		if lesson.Week < 1 || lesson.Week > e.Term.WeekCount || lesson.SlotRow < 0 || lesson.SlotRow >= periodCount ||
+			lesson.SlotCol < 0 || lesson.SlotCol > 6 {
+			return nil
+		}
+		if err := advance(lesson.Week); err != nil {
+			return err
+		}
+
+		title := fmt.Sprintf("%s 第%d周", e.Name, week)
+		if e.Scope == ExportScopeTerm {
+			title = fmt.Sprintf("%s 第%d周", lesson.ClassName, week)
+		}
+		if grid != nil && grid.title != title {
+			flushGrid()
+		}
+		if grid == nil {
+			grid = &exportGrid{title: title}
+		}
+		cell := &grid.cells[lesson.SlotRow][lesson.SlotCol]
+		*cell = append(*cell, e.cellLines(lesson))
+		return sheet.err
+	})
+	if err != nil {
+		return err
+	}
+	if err := advance(e.Term.WeekCount); err != nil {
+		return err
+	}
+	if err := closeSheet(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
@@ -0,0 +1,512 @@
+package services
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"reschedule-program/database"
+	"reschedule-program/models"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// 无法对应的 FET 数据种类
+const (
+	FETUnmappedStudents = "students"
+	FETUnmappedSubject  = "subject"
+	FETUnmappedTeacher  = "teacher"
+	FETUnmappedRoom     = "room"
+	FETUnmappedDay      = "day"
+	FETUnmappedHour     = "hour"
+	FETUnmappedActivity = "activity"
+)
+
+// FETImportOptions FET 导入选项
+type FETImportOptions struct {
+	ImportOptions
+	Weeks string // 写入的周次，格式同CSV导入的周次列，为空时为整个学期
+}
+
+// FETUnmapped 无法对应到本系统的 FET 数据及受影响的活动
+type FETUnmapped struct {
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	Reason     string `json:"reason"`
+	Activities []int  `json:"activities"`
+}
+
+// FETImportResult FET 导入结果。无法对应的学生、科目、星期或节次使对应的活动被跳过，
+// 无法对应的教师和教室只使课程不指定教师或教室，均列在 Unmapped 中；
+// 写入时的错误（Errors）与CSV导入相同，存在错误时不写入任何数据
+type FETImportResult struct {
+	*WriteResult
+	DryRun     bool              `json:"dryRun"`
+	Activities int               `json:"activities"` // 文件中启用的活动数
+	Placed     int               `json:"placed"`     // 导入（预览时为将导入）的活动数
+	Lessons    int               `json:"lessons"`    // 写入（预览时为将写入）的课程记录数
+	Weeks      []int             `json:"weeks"`
+	Classes    []string          `json:"classes"`
+	Unmapped   []FETUnmapped     `json:"unmapped"`
+	Errors     []ImportLineError `json:"errors"`
+}
+
+// fetName FET 中的名称，新版本为 <Day><Name>Monday</Name></Day>，旧版本为 <Day>Monday</Day>
+type fetName struct {
+	Name string `xml:"Name"`
+	Text string `xml:",chardata"`
+}
+
+// String 返回名称
+func (n fetName) String() string {
+	if n.Name != "" {
+		return strings.TrimSpace(n.Name)
+	}
+	return strings.TrimSpace(n.Text)
+}
+
+// fetStudents 学生集合：年级包含组，组包含子组
+type fetStudents struct {
+	Name      string        `xml:"Name"`
+	Groups    []fetStudents `xml:"Group"`
+	Subgroups []fetStudents `xml:"Subgroup"`
+}
+
+// fetActivity 活动，Duration 为连续的节数
+type fetActivity struct {
+	ID       int      `xml:"Id"`
+	Teachers []string `xml:"Teacher"`
+	Subject  string   `xml:"Subject"`
+	Students []string `xml:"Students"`
+	Duration int      `xml:"Duration"`
+	Active   string   `xml:"Active"`
+}
+
+// fetStartingTime 固定活动开始时间的约束，保存了结果的 .fet 文件用它锁定各活动的位置
+type fetStartingTime struct {
+	Weight   string `xml:"Weight_Percentage"`
+	Activity int    `xml:"Activity_Id"`
+	Day      string `xml:"Preferred_Day"`
+	Hour     string `xml:"Preferred_Hour"`
+	Active   string `xml:"Active"`
+}
+
+// fetPreferredRoom 固定活动教室的约束
+type fetPreferredRoom struct {
+	Weight   string `xml:"Weight_Percentage"`
+	Activity int    `xml:"Activity_Id"`
+	Room     string `xml:"Room"`
+	Active   string `xml:"Active"`
+}
+
+// fetFile .fet 文件中导入用到的部分
+type fetFile struct {
+	XMLName        xml.Name           `xml:"fet"`
+	Days           []fetName          `xml:"Days_List>Day"`
+	Hours          []fetName          `xml:"Hours_List>Hour"`
+	Years          []fetStudents      `xml:"Students_List>Year"`
+	Activities     []fetActivity      `xml:"Activities_List>Activity"`
+	StartingTimes  []fetStartingTime  `xml:"Time_Constraints_List>ConstraintActivityPreferredStartingTime"`
+	PreferredRooms []fetPreferredRoom `xml:"Space_Constraints_List>ConstraintActivityPreferredRoom"`
+}
+
+// fetPlacement 活动在结果中的位置
+type fetPlacement struct {
+	ID   int    `xml:"Id"`
+	Day  string `xml:"Day"`
+	Hour string `xml:"Hour"`
+	Room string `xml:"Room"`
+}
+
+// fetSolution FET 生成的活动结果文件（*_activities.xml）
+type fetSolution struct {
+	XMLName    xml.Name       `xml:"Activities_Timetable"`
+	Activities []fetPlacement `xml:"Activity"`
+}
+
+// fetActive FET 中的启用标记，缺省为启用
+func fetActive(value string) bool {
+	return strings.TrimSpace(value) != "false"
+}
+
+// fetLocked 约束是否固定了位置：启用且权重为 100
+func fetLocked(weight string, active string) bool {
+	percentage, err := strconv.ParseFloat(strings.TrimSpace(weight), 64)
+	return fetActive(active) && err == nil && percentage >= 100
+}
+
+// parseFET 解析 .fet 文件和结果文件，没有结果文件时使用 .fet 中固定的开始时间和教室
+func parseFET(fet io.Reader, solution io.Reader) (*fetFile, map[int]fetPlacement, error) {
+	var file fetFile
+	if err := xml.NewDecoder(fet).Decode(&file); err != nil {
+		return nil, nil, fmt.Errorf("%w: not a FET file: %v", ErrInvalidImport, err)
+	}
+	if len(file.Days) == 0 || len(file.Hours) == 0 {
+		return nil, nil, fmt.Errorf("%w: FET file has no days or hours", ErrInvalidImport)
+	}
+
+	placements := map[int]fetPlacement{}
+	if solution != nil {
+		var timetable fetSolution
+		if err := xml.NewDecoder(solution).Decode(&timetable); err != nil {
+			return nil, nil, fmt.Errorf("%w: not a FET activities timetable: %v", ErrInvalidImport, err)
+		}
+		for _, placement := range timetable.Activities {
+			placement.Day = strings.TrimSpace(placement.Day)
+			placement.Hour = strings.TrimSpace(placement.Hour)
+			placement.Room = strings.TrimSpace(placement.Room)
+			placements[placement.ID] = placement
+		}
+		return &file, placements, nil
+	}
+
+	for _, constraint := range file.StartingTimes {
+		if fetLocked(constraint.Weight, constraint.Active) {
+			placements[constraint.Activity] = fetPlacement{
+				ID:   constraint.Activity,
+				Day:  strings.TrimSpace(constraint.Day),
+				Hour: strings.TrimSpace(constraint.Hour),
+			}
+		}
+	}
+	for _, constraint := range file.PreferredRooms {
+		placement, ok := placements[constraint.Activity]
+		if ok && fetLocked(constraint.Weight, constraint.Active) {
+			placement.Room = strings.TrimSpace(constraint.Room)
+			placements[constraint.Activity] = placement
+		}
+	}
+	if len(placements) == 0 {
+		return nil, nil, fmt.Errorf("%w: FET file has no timetable, upload the activities timetable as well", ErrInvalidImport)
+	}
+	return &file, placements, nil
+}
+
+// fetHourRows 将 FET 的节次对应到行号：节次名称以上课时间开头（如 08:00 或 08:00-08:45）且
+// 与学期某一时间段的开始时间相同时按时间对应，否则按顺序对应前几个时间段。返回 -1 的节次无法对应
+func fetHourRows(hours []fetName, periods []PeriodTime) []int {
+	rows := make([]int, len(hours))
+	byTime := false
+	for i, hour := range hours {
+		rows[i] = -1
+		name := hour.String()
+		if len(name) < 5 {
+			continue
+		}
+		start, err := parseClock(name[:5])
+		if err != nil {
+			continue
+		}
+		for row, period := range periods {
+			if period.Start == start {
+				rows[i] = row
+				byTime = true
+			}
+		}
+	}
+	if byTime {
+		return rows
+	}
+	for i := range rows {
+		rows[i] = -1
+		if i < periodCount {
+			rows[i] = i
+		}
+	}
+	return rows
+}
+
+// fetStudentClasses 将学生集合对应到班级：与班级同名时为该班级，否则展开为其下各组和子组对应的班级
+func fetStudentClasses(tx *gorm.DB, years []fetStudents) (map[string][]string, error) {
+	var classes []models.Class
+	if err := tx.Select("name").Find(&classes).Error; err != nil {
+		return nil, err
+	}
+	known := map[string]bool{}
+	for _, class := range classes {
+		known[class.Name] = true
+	}
+
+	mapping := map[string][]string{}
+	var walk func(set fetStudents) []string
+	walk = func(set fetStudents) []string {
+		name := strings.TrimSpace(set.Name)
+		var names []string
+		for _, child := range append(append([]fetStudents{}, set.Groups...), set.Subgroups...) {
+			names = append(names, walk(child)...)
+		}
+		if known[name] {
+			names = []string{name}
+		}
+		if _, ok := mapping[name]; !ok {
+			mapping[name] = names
+		}
+		return names
+	}
+	for _, year := range years {
+		walk(year)
+	}
+	for name, names := range mapping {
+		mapping[name] = uniqueStrings(names)
+	}
+	// 学生列表中没有、但与班级同名的集合
+	for name := range known {
+		if _, ok := mapping[name]; !ok {
+			mapping[name] = []string{name}
+		}
+	}
+	return mapping, nil
+}
+
+// uniqueStrings 去重并保持顺序
+func uniqueStrings(values []string) []string {
+	seen := map[string]bool{}
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// ImportFET 从 FET 的 .fet 文件和活动结果文件导入课程表：学生集合对应班级，科目对应课程，
+// 星期和节次对应列号和行号，每个活动按选定的周次写入 WeeklySchedule。
+// 没有结果文件时使用 .fet 中固定（权重 100）的开始时间和教室
+func ImportFET(actor Actor, fet io.Reader, solution io.Reader, options FETImportOptions) (*FETImportResult, error) {
+	term, err := resolveExportTerm(options.TermID)
+	if err != nil {
+		return nil, err
+	}
+	periods, err := ParsePeriodTimes(term.PeriodTimes)
+	if err != nil {
+		return nil, err
+	}
+	weekPattern := options.Weeks
+	if strings.TrimSpace(weekPattern) == "" {
+		weekPattern = fmt.Sprintf("1-%d", term.WeekCount)
+	}
+	weeks, err := ParseWeekPattern(weekPattern, term.WeekCount)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+	}
+
+	file, placements, err := parseFET(fet, solution)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &FETImportResult{WriteResult: &WriteResult{Conflicts: []ScheduleConflict{}, Warnings: []CapacityWarning{}},
+		DryRun: options.DryRun, Weeks: weeks, Classes: []string{}, Unmapped: []FETUnmapped{}, Errors: []ImportLineError{}}
+	unmapped := map[[2]string]int{}
+	report := func(kind string, name string, activity int, format string, args ...interface{}) {
+		key := [2]string{kind, name}
+		index, ok := unmapped[key]
+		if !ok {
+			index = len(result.Unmapped)
+			unmapped[key] = index
+			result.Unmapped = append(result.Unmapped, FETUnmapped{Kind: kind, Name: name, Reason: fmt.Sprintf(format, args...)})
+		}
+		result.Unmapped[index].Activities = append(result.Unmapped[index].Activities, activity)
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// 1. 星期、节次、学生集合的对应关系
+		days := map[string]int{}
+		for col, day := range file.Days {
+			days[day.String()] = col
+		}
+		hours := map[string]int{}
+		for index, hour := range file.Hours {
+			hours[hour.String()] = index
+		}
+		hourRows := fetHourRows(file.Hours, periods)
+		students, err := fetStudentClasses(tx, file.Years)
+		if err != nil {
+			return err
+		}
+		teachers := map[string]*uint{}
+		rooms := map[string]*uint{}
+
+		// 2. 逐个活动对应到课程
+		var lines []importLine
+		for _, activity := range file.Activities {
+			if !fetActive(activity.Active) {
+				continue
+			}
+			result.Activities++
+			id := activity.ID
+
+			placement, ok := placements[id]
+			if !ok {
+				report(FETUnmappedActivity, strconv.Itoa(id), id, "activity is not placed in the timetable")
+				continue
+			}
+
+			// 位置
+			col, ok := days[placement.Day]
+			if !ok || col >= 7 {
+				report(FETUnmappedDay, placement.Day, id, "day is not one of the first 7 days")
+				continue
+			}
+			start, ok := hours[placement.Hour]
+			if !ok {
+				report(FETUnmappedHour, placement.Hour, id, "hour is not in the FET file")
+				continue
+			}
+			duration := activity.Duration
+			if duration < 1 {
+				duration = 1
+			}
+			var rows []int
+			for index := start; index < start+duration; index++ {
+				if index >= len(hourRows) || hourRows[index] < 0 {
+					name := placement.Hour
+					if index < len(file.Hours) {
+						name = file.Hours[index].String()
+					}
+					report(FETUnmappedHour, name, id, "hour does not match any of the %d periods", periodCount)
+					break
+				}
+				rows = append(rows, hourRows[index])
+			}
+			if len(rows) < duration {
+				continue
+			}
+
+			// 班级
+			var classNames []string
+			for _, set := range activity.Students {
+				set = strings.TrimSpace(set)
+				names := students[set]
+				if len(names) == 0 {
+					report(FETUnmappedStudents, set, id, "no class with this name or in this students set")
+				}
+				classNames = append(classNames, names...)
+			}
+			classNames = uniqueStrings(classNames)
+			if len(classNames) == 0 {
+				if len(activity.Students) == 0 {
+					report(FETUnmappedStudents, "", id, "activity has no students")
+				}
+				continue
+			}
+
+			// 课程
+			subject := strings.TrimSpace(activity.Subject)
+			if subject == "" {
+				report(FETUnmappedSubject, "", id, "activity has no subject")
+				continue
+			}
+			if options.RejectUnknownCourses {
+				if _, err := findCourse(tx, subject); errors.Is(err, ErrUnknownCourse) {
+					report(FETUnmappedSubject, subject, id, "no course with this name or code")
+					continue
+				} else if err != nil {
+					return err
+				}
+			}
+
+			// 教师和教室，无法对应时课程不指定
+			var teacherID *uint
+			for i, name := range activity.Teachers {
+				name = strings.TrimSpace(name)
+				if i > 0 {
+					report(FETUnmappedTeacher, name, id, "only the first teacher of an activity is kept")
+					continue
+				}
+				if _, ok := teachers[name]; !ok {
+					var found []models.Teacher
+					if err := tx.Where("name = ?", name).Limit(2).Find(&found).Error; err != nil {
+						return err
+					}
+					teachers[name] = nil
+					switch len(found) {
+					case 0:
+						report(FETUnmappedTeacher, name, id, "no teacher with this name")
+					case 1:
+						teachers[name] = &found[0].ID
+					default:
+						report(FETUnmappedTeacher, name, id, "teacher name is ambiguous")
+					}
+				} else if teachers[name] == nil {
+					report(FETUnmappedTeacher, name, id, "")
+				}
+				teacherID = teachers[name]
+			}
+			var roomID *uint
+			if name := placement.Room; name != "" {
+				if _, ok := rooms[name]; !ok {
+					var found []models.Room
+					if err := tx.Where("name = ?", name).Limit(1).Find(&found).Error; err != nil {
+						return err
+					}
+					rooms[name] = nil
+					if len(found) == 0 {
+						report(FETUnmappedRoom, name, id, "no room with this name")
+					} else {
+						rooms[name] = &found[0].ID
+					}
+				} else if rooms[name] == nil {
+					report(FETUnmappedRoom, name, id, "")
+				}
+				roomID = rooms[name]
+			}
+
+			result.Placed++
+			for _, className := range classNames {
+				for _, row := range rows {
+					lines = append(lines, importLine{Line: id, ClassName: className, Course: subject,
+						Row: row, Col: col, Weeks: weeks, TeacherID: teacherID, RoomID: roomID})
+				}
+			}
+		}
+
+		// 3. 按CSV导入的规则写入并检查冲突
+		// 一个活动展开的多节课可能产生相同的错误，只记录一次
+		failed := map[ImportLineError]bool{}
+		fail := func(activity int, column string, format string, args ...interface{}) {
+			lineError := ImportLineError{Activity: activity, Column: column, Message: fmt.Sprintf(format, args...)}
+			if !failed[lineError] {
+				failed[lineError] = true
+				result.Errors = append(result.Errors, lineError)
+			}
+		}
+		written, classes, err := writeImportLines(tx, actor, term.ID, lines, options.ImportOptions, result.WriteResult, "activity", fail)
+		if err != nil {
+			return err
+		}
+		result.Lessons = len(written)
+		result.Classes = append(result.Classes, classes...)
+
+		// 4. 有错误时整体回滚
+		sort.SliceStable(result.Errors, func(i, j int) bool { return result.Errors[i].Activity < result.Errors[j].Activity })
+		if len(result.Errors) > 0 {
+			return ErrImportRejected
+		}
+		if err := recordInsertsByClass(tx, actor, written); err != nil {
+			return err
+		}
+		if options.DryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if errors.Is(err, errDryRun) {
+		return result, nil
+	}
+	if errors.Is(err, ErrImportRejected) {
+		result.Lessons = 0
+		result.Placed = 0
+		return result, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	publishScheduleEvents()
+	return result, nil
+}
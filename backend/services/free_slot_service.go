@@ -0,0 +1,198 @@
+package services
+
+import (
+	"errors"
+	"reschedule-program/database"
+	"reschedule-program/models"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// 课程表网格大小：5 个时间段 × 7 天
+const (
+	slotRows = 5
+	slotCols = 7
+)
+
+// SlotPosition 课程表中的一个位置
+type SlotPosition struct {
+	WeekNumber  int `json:"weekNumber"`
+	TimeSlotRow int `json:"timeSlotRow"`
+	TimeSlotCol int `json:"timeSlotCol"`
+}
+
+// FreeSlotQuery 空闲时间查询条件
+type FreeSlotQuery struct {
+	ClassName string
+	TeacherID *uint         // 为空且指定了原位置时使用原课程的任课教师
+	RoomID    *uint         // 为空且指定了原位置时使用原课程的教室
+	FromWeek  int           // 为 0 时从第1周开始
+	ToWeek    int           // 为 0 时到学期最后一周
+	Days      []int         // 允许的星期 0-6，为空时不限
+	Source    *SlotPosition // 原位置，用于推断教师和教室并按距离排序
+	Limit     int           // 最多返回的数量，为 0 时返回全部
+}
+
+// FreeSlot 班级、教师和教室都空闲的位置
+type FreeSlot struct {
+	SlotPosition
+	Date     string `json:"date,omitempty"` // 当前学期设置了开学日期时的上课日期
+	Distance int    `json:"distance"`       // 与原位置的距离，越小越接近
+}
+
+// FreeSlotResult 空闲时间查询结果
+type FreeSlotResult struct {
+	TeacherID *uint      `json:"teacherId"` // 实际参与检查的教师
+	RoomID    *uint      `json:"roomId"`    // 实际参与检查的教室
+	Slots     []FreeSlot `json:"slots"`
+}
+
+// slotDistance 计算两个位置的距离：周数差优先，其次是星期差，最后是时间段差
+func slotDistance(a SlotPosition, b SlotPosition) int {
+	abs := func(v int) int {
+		if v < 0 {
+			return -v
+		}
+		return v
+	}
+	return abs(a.WeekNumber-b.WeekNumber)*100 + abs(a.TimeSlotCol-b.TimeSlotCol)*10 + abs(a.TimeSlotRow-b.TimeSlotRow)
+}
+
+// FindFreeSlots 查找班级、教师和教室在当前学期都空闲的位置，跳过节假日，按与原位置的距离排序
+func FindFreeSlots(query FreeSlotQuery) (*FreeSlotResult, error) {
+	termID, err := currentTermID()
+	if err != nil {
+		return nil, err
+	}
+	class, err := findClassByName(database.DB, query.ClassName)
+	if err != nil {
+		return nil, err
+	}
+
+	// 1. 确定周数范围
+	maxWeek, err := termWeekCount(termID)
+	if err != nil {
+		return nil, err
+	}
+	fromWeek, toWeek := query.FromWeek, query.ToWeek
+	if fromWeek < 1 {
+		fromWeek = 1
+	}
+	if toWeek < 1 || toWeek > maxWeek {
+		toWeek = maxWeek
+	}
+
+	// 2. 未指定教师和教室时沿用原位置课程的安排
+	teacherID, roomID := query.TeacherID, query.RoomID
+	if teacherID != nil {
+		if _, err := GetTeacher(*teacherID); err != nil {
+			return nil, err
+		}
+	}
+	if roomID != nil {
+		if _, err := GetRoom(*roomID); err != nil {
+			return nil, err
+		}
+	}
+	if query.Source != nil {
+		lesson, err := findLesson(database.DB.Preload("Course"), termID, class.ID,
+			query.Source.WeekNumber, query.Source.TimeSlotRow, query.Source.TimeSlotCol)
+		if err == nil {
+			if teacherID == nil {
+				teacherID = lesson.EffectiveTeacherID()
+			}
+			if roomID == nil {
+				roomID = lesson.RoomID
+			}
+		} else if !errors.Is(err, ErrLessonNotFound) {
+			return nil, err
+		}
+	}
+
+	// 3. 读取班级、教师、教室在范围内已占用的位置
+	busy := make(map[SlotPosition]bool)
+	collect := func(rows []models.WeeklySchedule) {
+		for _, row := range rows {
+			busy[SlotPosition{row.WeekNumber, row.TimeSlotRow, row.TimeSlotCol}] = true
+		}
+	}
+	base := func() *gorm.DB {
+		return database.DB.Model(&models.WeeklySchedule{}).
+			Where("weekly_schedules.term_id = ? AND weekly_schedules.week_number BETWEEN ? AND ?", termID, fromWeek, toWeek)
+	}
+
+	var rows []models.WeeklySchedule
+	if err := base().Where("weekly_schedules.class_id = ?", class.ID).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	collect(rows)
+	if teacherID != nil {
+		rows = nil
+		if err := base().Scopes(teacherScheduleScope(*teacherID)).Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		collect(rows)
+	}
+	if roomID != nil {
+		rows = nil
+		if err := base().Scopes(roomScheduleScope(*roomID)).Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		collect(rows)
+	}
+
+	allowed := make(map[int]bool)
+	for _, day := range query.Days {
+		allowed[day] = true
+	}
+
+	// 4. 枚举空闲位置，跳过节假日和调休补课日
+	var term *models.Term
+	if termID != 0 {
+		if term, err = GetTerm(termID); err != nil {
+			return nil, err
+		}
+	}
+	slots := []FreeSlot{}
+	for week := fromWeek; week <= toWeek; week++ {
+		var days []DayInfo
+		if term != nil {
+			if days, err = GetWeekCalendar(term, week); err != nil {
+				return nil, err
+			}
+		}
+		for col := 0; col < slotCols; col++ {
+			if len(allowed) > 0 && !allowed[col] {
+				continue
+			}
+			// 节假日不上课，调休补课日按其他星期的课表上课，都不作为空闲位置
+			if days != nil && (!days[col].Teaching || (days[col].FollowsCol != nil && *days[col].FollowsCol != col)) {
+				continue
+			}
+			for row := 0; row < slotRows; row++ {
+				position := SlotPosition{week, row, col}
+				if busy[position] {
+					continue
+				}
+				slot := FreeSlot{SlotPosition: position}
+				if days != nil {
+					slot.Date = days[col].Date
+				}
+				if query.Source != nil {
+					slot.Distance = slotDistance(position, *query.Source)
+				}
+				slots = append(slots, slot)
+			}
+		}
+	}
+
+	sort.SliceStable(slots, func(i, j int) bool {
+		return slots[i].Distance < slots[j].Distance
+	})
+	if query.Limit > 0 && len(slots) > query.Limit {
+		slots = slots[:query.Limit]
+	}
+
+	return &FreeSlotResult{TeacherID: teacherID, RoomID: roomID, Slots: slots}, nil
+}
@@ -0,0 +1,434 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reschedule-program/database"
+	"reschedule-program/models"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrChangeNotFound    = errors.New("schedule change not found")
+	ErrInvalidHistoryPos = errors.New("either a timestamp or a change ID is required")
+)
+
+// Actor 执行写操作的用户及请求来源，未登录时 UserID 和 Username 为空
+type Actor struct {
+	UserID    string
+	Username  string
+	ClientIP  string
+	RequestID string
+	journal   bool // 是否记入操作人的撤销日志
+}
+
+// SessionActor 由登录会话得到操作人
+func SessionActor(session *models.Session) Actor {
+	if session == nil {
+		return Actor{}
+	}
+	return Actor{UserID: session.UserID, Username: session.Username}
+}
+
+// LessonSnapshot 历史记录中一个位置的课程
+type LessonSnapshot struct {
+	WeekNumber  int    `json:"weekNumber"`
+	TimeSlotRow int    `json:"timeSlotRow"`
+	TimeSlotCol int    `json:"timeSlotCol"`
+	CourseID    uint   `json:"courseId"`
+	CourseName  string `json:"courseName"`
+	TeacherID   *uint  `json:"teacherId"`
+	RoomID      *uint  `json:"roomId"`
+}
+
+// key 课程所在的位置
+func (s LessonSnapshot) key() slotKey {
+	return slotKey{s.WeekNumber, s.TimeSlotRow, s.TimeSlotCol}
+}
+
+// sameContent 判断两个位置的课程内容是否相同
+func (s LessonSnapshot) sameContent(other LessonSnapshot) bool {
+	return s.CourseID == other.CourseID && sameUint(s.TeacherID, other.TeacherID) && sameUint(s.RoomID, other.RoomID)
+}
+
+// ScheduleChangeInfo 变更历史及解析后的变更前后课程
+type ScheduleChangeInfo struct {
+	models.ScheduleChange
+	Before []LessonSnapshot `json:"before"`
+	After  []LessonSnapshot `json:"after"`
+}
+
+// HistoryPoint 历史版本：某个时间点，或某条变更刚完成时
+type HistoryPoint struct {
+	At       *time.Time `json:"at"`
+	ChangeID uint       `json:"changeId"`
+}
+
+// lessonSnapshots 将课程记录转换为快照，课程名称从课程目录读取
+func lessonSnapshots(tx *gorm.DB, rows []models.WeeklySchedule) ([]LessonSnapshot, error) {
+	snapshots := make([]LessonSnapshot, 0, len(rows))
+	if len(rows) == 0 {
+		return snapshots, nil
+	}
+
+	ids := make([]uint, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, row.CourseID)
+	}
+	// 包括被合并（软删除）的课程
+	var courses []models.Course
+	if err := tx.Unscoped().Where("id IN ?", ids).Find(&courses).Error; err != nil {
+		return nil, err
+	}
+	names := make(map[uint]string, len(courses))
+	for _, course := range courses {
+		names[course.ID] = course.Name
+	}
+
+	for _, row := range rows {
+		snapshots = append(snapshots, LessonSnapshot{
+			WeekNumber:  row.WeekNumber,
+			TimeSlotRow: row.TimeSlotRow,
+			TimeSlotCol: row.TimeSlotCol,
+			CourseID:    row.CourseID,
+			CourseName:  names[row.CourseID],
+			TeacherID:   row.TeacherID,
+			RoomID:      row.RoomID,
+		})
+	}
+	return snapshots, nil
+}
+
+// restoreCourse 确认历史版本中的课程仍可使用：被合并（软删除）的课程恢复到课程目录，
+// 已被删除的课程返回 ErrCourseNotFound
+func restoreCourse(tx *gorm.DB, snapshot LessonSnapshot) error {
+	var course models.Course
+	if err := tx.Unscoped().Limit(1).Find(&course, snapshot.CourseID).Error; err != nil {
+		return err
+	}
+	if course.ID == 0 {
+		return fmt.Errorf("%w: %s", ErrCourseNotFound, snapshot.CourseName)
+	}
+	if !course.DeletedAt.Valid {
+		return nil
+	}
+	return tx.Unscoped().Model(&course).Update("deleted_at", nil).Error
+}
+
+// recordScheduleChange 在写操作的事务中追加一条变更历史及对应的活动日志，before/after 为涉及位置变更前后的课程记录
+func recordScheduleChange(tx *gorm.DB, actor Actor, action string, termID uint, classID uint,
+	before []models.WeeklySchedule, after []models.WeeklySchedule) error {
+	if len(before) == 0 && len(after) == 0 {
+		return nil
+	}
+
+	beforeSnapshots, err := lessonSnapshots(tx, before)
+	if err != nil {
+		return err
+	}
+	afterSnapshots, err := lessonSnapshots(tx, after)
+	if err != nil {
+		return err
+	}
+	beforeJSON, err := json.Marshal(beforeSnapshots)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := json.Marshal(afterSnapshots)
+	if err != nil {
+		return err
+	}
+
+	change := models.ScheduleChange{
+		TermID:    termID,
+		ClassID:   classID,
+		Action:    action,
+		ActorID:   actor.UserID,
+		ActorName: actor.Username,
+		Before:    string(beforeJSON),
+		After:     string(afterJSON),
+	}
+	if err := tx.Create(&change).Error; err != nil {
+		return err
+	}
+
+	var class models.Class
+	if err := tx.Select("name").First(&class, classID).Error; err != nil {
+		return err
+	}
+	if err := RecordActivity(tx, actor, ActivityEvent{
+		Action:     scheduleActivity(action),
+		EntityType: models.EntityClass,
+		EntityID:   classID,
+		EntityName: class.Name,
+		ClassID:    classID,
+		Before:     beforeSnapshots,
+		After:      afterSnapshots,
+	}); err != nil {
+		return err
+	}
+
+	if actor.journal {
+		return journalChange(tx, actor, change.ID)
+	}
+	return nil
+}
+
+// recordInsertsByClass 按班级记录批量新增的课程
+func recordInsertsByClass(tx *gorm.DB, actor Actor, rows []models.WeeklySchedule) error {
+	type classKey struct{ termID, classID uint }
+	groups := make(map[classKey][]models.WeeklySchedule)
+	var order []classKey
+	for _, row := range rows {
+		key := classKey{row.TermID, row.ClassID}
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], row)
+	}
+	for _, key := range order {
+		if err := recordScheduleChange(tx, actor, models.ScheduleChangeInsert, key.termID, key.classID, nil, groups[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scheduleChangeInfo 解析变更前后的课程
+func scheduleChangeInfo(change models.ScheduleChange) (ScheduleChangeInfo, error) {
+	info := ScheduleChangeInfo{ScheduleChange: change, Before: []LessonSnapshot{}, After: []LessonSnapshot{}}
+	if err := json.Unmarshal([]byte(change.Before), &info.Before); err != nil {
+		return info, err
+	}
+	if err := json.Unmarshal([]byte(change.After), &info.After); err != nil {
+		return info, err
+	}
+	return info, nil
+}
+
+// GetScheduleHistory 获取班级当前学期的变更历史，最新的在前；beforeID 大于 0 时只返回更早的记录
+func GetScheduleHistory(className string, beforeID uint, limit int) ([]ScheduleChangeInfo, error) {
+	termID, err := currentTermID()
+	if err != nil {
+		return nil, err
+	}
+	class, err := findClassByName(database.DB, className)
+	if err != nil {
+		return nil, err
+	}
+
+	query := database.DB.Where("term_id = ? AND class_id = ?", termID, class.ID).Order("id DESC")
+	if beforeID > 0 {
+		query = query.Where("id < ?", beforeID)
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	var changes []models.ScheduleChange
+	if err := query.Find(&changes).Error; err != nil {
+		return nil, err
+	}
+
+	infos := make([]ScheduleChangeInfo, 0, len(changes))
+	for _, change := range changes {
+		info, err := scheduleChangeInfo(change)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// reconstructSchedule 从当前课程表出发，倒序撤销历史版本之后的变更，得到班级在该版本的课程表。
+// 历史记录开始之前的版本按历史记录开始时的状态返回
+func reconstructSchedule(tx *gorm.DB, termID uint, classID uint, point HistoryPoint) (map[slotKey]LessonSnapshot, error) {
+	// 1. 当前课程表
+	var rows []models.WeeklySchedule
+	if err := tx.Where("term_id = ? AND class_id = ?", termID, classID).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	current, err := lessonSnapshots(tx, rows)
+	if err != nil {
+		return nil, err
+	}
+	cells := make(map[slotKey]LessonSnapshot, len(current))
+	for _, snapshot := range current {
+		cells[snapshot.key()] = snapshot
+	}
+
+	// 2. 历史版本之后的变更
+	query := tx.Where("term_id = ? AND class_id = ?", termID, classID).Order("id DESC")
+	switch {
+	case point.ChangeID > 0:
+		var change models.ScheduleChange
+		if err := tx.Where("id = ? AND term_id = ? AND class_id = ?", point.ChangeID, termID, classID).First(&change).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrChangeNotFound
+			}
+			return nil, err
+		}
+		query = query.Where("id > ?", point.ChangeID)
+	case point.At != nil:
+		// 数据库按服务器本地时区保存时间，比较前转换到同一时区
+		query = query.Where("created_at > ?", point.At.In(time.Local))
+	default:
+		return nil, ErrInvalidHistoryPos
+	}
+	var changes []models.ScheduleChange
+	if err := query.Find(&changes).Error; err != nil {
+		return nil, err
+	}
+
+	// 3. 倒序撤销：涉及的位置恢复为变更前的课程
+	for _, change := range changes {
+		info, err := scheduleChangeInfo(change)
+		if err != nil {
+			return nil, err
+		}
+		for _, snapshot := range info.After {
+			delete(cells, snapshot.key())
+		}
+		for _, snapshot := range info.Before {
+			cells[snapshot.key()] = snapshot
+		}
+	}
+	return cells, nil
+}
+
+// sortedSnapshots 按周、时间段、星期排序
+func sortedSnapshots(cells map[slotKey]LessonSnapshot) []LessonSnapshot {
+	snapshots := make([]LessonSnapshot, 0, len(cells))
+	for _, snapshot := range cells {
+		snapshots = append(snapshots, snapshot)
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		a, b := snapshots[i], snapshots[j]
+		if a.WeekNumber != b.WeekNumber {
+			return a.WeekNumber < b.WeekNumber
+		}
+		if a.TimeSlotRow != b.TimeSlotRow {
+			return a.TimeSlotRow < b.TimeSlotRow
+		}
+		return a.TimeSlotCol < b.TimeSlotCol
+	})
+	return snapshots
+}
+
+// GetScheduleAsOf 获取班级当前学期在历史版本时的课程表，weekNumber 大于 0 时只返回该周
+func GetScheduleAsOf(className string, point HistoryPoint, weekNumber int) ([]LessonSnapshot, error) {
+	termID, err := currentTermID()
+	if err != nil {
+		return nil, err
+	}
+	class, err := findClassByName(database.DB, className)
+	if err != nil {
+		return nil, err
+	}
+
+	cells, err := reconstructSchedule(database.DB, termID, class.ID, point)
+	if err != nil {
+		return nil, err
+	}
+	if weekNumber > 0 {
+		for key := range cells {
+			if key.Week != weekNumber {
+				delete(cells, key)
+			}
+		}
+	}
+	return sortedSnapshots(cells), nil
+}
+
+// RevertResult 恢复历史版本的结果
+type RevertResult struct {
+	*WriteResult
+	Restored []LessonSnapshot `json:"restored"` // 恢复后与当前不同的位置的课程
+	Removed  []LessonSnapshot `json:"removed"`  // 被移除的当前课程
+}
+
+// RevertSchedule 在一个事务中将班级当前学期的课程表恢复到历史版本，恢复本身也记入历史；
+// 恢复后存在冲突时整体回滚，dryRun 为 true 时只预览
+func RevertSchedule(actor Actor, className string, point HistoryPoint, dryRun bool) (*RevertResult, error) {
+	termID, err := currentTermID()
+	if err != nil {
+		return nil, err
+	}
+
+	revert := &RevertResult{Restored: []LessonSnapshot{}, Removed: []LessonSnapshot{}}
+	result, err := runScheduleWrite(dryRun, func(tx *gorm.DB) ([]models.WeeklySchedule, error) {
+		class, err := findClassByName(tx, className)
+		if err != nil {
+			return nil, err
+		}
+		if class.Archived {
+			return nil, ErrClassArchived
+		}
+
+		target, err := reconstructSchedule(tx, termID, class.ID, point)
+		if err != nil {
+			return nil, err
+		}
+
+		// 1. 移除与目标版本不同的当前课程
+		var rows []models.WeeklySchedule
+		if err := tx.Where("term_id = ? AND class_id = ?", termID, class.ID).Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		current, err := lessonSnapshots(tx, rows)
+		if err != nil {
+			return nil, err
+		}
+		var removed []models.WeeklySchedule
+		unchanged := make(map[slotKey]bool)
+		for i, snapshot := range current {
+			if wanted, ok := target[snapshot.key()]; ok && wanted.sameContent(snapshot) {
+				unchanged[snapshot.key()] = true
+				continue
+			}
+			if err := tx.Delete(&rows[i]).Error; err != nil {
+				return nil, err
+			}
+			removed = append(removed, rows[i])
+			revert.Removed = append(revert.Removed, snapshot)
+		}
+
+		// 2. 写入目标版本中不同的课程
+		var written []models.WeeklySchedule
+		for _, snapshot := range sortedSnapshots(target) {
+			if unchanged[snapshot.key()] {
+				continue
+			}
+			// 历史版本中的课程可能已被删除或合并
+			if err := restoreCourse(tx, snapshot); err != nil {
+				return nil, err
+			}
+			row := models.WeeklySchedule{
+				TermID:      termID,
+				ClassID:     class.ID,
+				CourseID:    snapshot.CourseID,
+				WeekNumber:  snapshot.WeekNumber,
+				TimeSlotRow: snapshot.TimeSlotRow,
+				TimeSlotCol: snapshot.TimeSlotCol,
+				TeacherID:   snapshot.TeacherID,
+				RoomID:      snapshot.RoomID,
+			}
+			if err := tx.Create(&row).Error; err != nil {
+				return nil, err
+			}
+			written = append(written, row)
+			revert.Restored = append(revert.Restored, snapshot)
+		}
+
+		if err := recordScheduleChange(tx, actor, models.ScheduleChangeRevert, termID, class.ID, removed, written); err != nil {
+			return nil, err
+		}
+		return written, nil
+	})
+	revert.WriteResult = result
+	return revert, err
+}
@@ -0,0 +1,538 @@
+package services
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"reschedule-program/database"
+	"reschedule-program/models"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidImport  = errors.New("invalid import file")
+	ErrImportRejected = errors.New("import has errors, nothing was written")
+)
+
+// ImportOptions 导入选项
+type ImportOptions struct {
+	TermID               uint // 为 0 时导入到当前学期
+	DryRun               bool // 只检查，不写入
+	Replace              bool // 先清空文件中各班级在该学期的课程
+	RejectUnknownCourses bool // 课程必须已在课程目录中
+}
+
+// ImportLineError 导入文件中一行的错误，Line 为文件中的行号（表头为第1行），FET 导入时 Activity 为活动编号
+type ImportLineError struct {
+	Line     int    `json:"line,omitempty"`
+	Activity int    `json:"activity,omitempty"`
+	Column   string `json:"column,omitempty"`
+	Message  string `json:"message"`
+}
+
+// ImportResult 导入结果，存在错误时不写入任何数据
+type ImportResult struct {
+	*WriteResult
+	DryRun  bool              `json:"dryRun"`
+	Lines   int               `json:"lines"`   // 数据行数
+	Lessons int               `json:"lessons"` // 写入（预览时为将写入）的课程记录数
+	Classes []string          `json:"classes"` // 涉及的班级
+	Errors  []ImportLineError `json:"errors"`
+}
+
+// importColumns 导入文件的列名，支持中英文表头
+var importColumns = map[string][]string{
+	"class":   {"class", "classname", "班级"},
+	"course":  {"course", "coursename", "课程"},
+	"day":     {"day", "weekday", "星期"},
+	"period":  {"period", "slot", "节次"},
+	"weeks":   {"weeks", "week", "weekpattern", "周次"},
+	"teacher": {"teacher", "教师"},
+	"room":    {"room", "教室"},
+}
+
+// requiredImportColumns 必须提供的列
+var requiredImportColumns = []string{"class", "course", "day", "period", "weeks"}
+
+// dayNames 星期的写法，对应列号 0-6
+var dayNames = map[string]int{
+	"mon": 0, "monday": 0, "周一": 0, "星期一": 0, "一": 0,
+	"tue": 1, "tuesday": 1, "周二": 1, "星期二": 1, "二": 1,
+	"wed": 2, "wednesday": 2, "周三": 2, "星期三": 2, "三": 2,
+	"thu": 3, "thursday": 3, "周四": 3, "星期四": 3, "四": 3,
+	"fri": 4, "friday": 4, "周五": 4, "星期五": 4, "五": 4,
+	"sat": 5, "saturday": 5, "周六": 5, "星期六": 5, "六": 5,
+	"sun": 6, "sunday": 6, "周日": 6, "星期日": 6, "周天": 6, "星期天": 6, "日": 6, "天": 6,
+}
+
+// importLine 解析后的一行
+type importLine struct {
+	Line      int // CSV中的行号，FET 导入时为活动编号
+	ClassName string
+	Course    string
+	Row       int
+	Col       int
+	Weeks     []int
+	TeacherID *uint
+	RoomID    *uint
+}
+
+// ParseDay 解析星期：1-7 或 Mon-Sun、周一-周日，返回列号 0-6
+func ParseDay(value string) (int, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if day, err := strconv.Atoi(value); err == nil {
+		if day < 1 || day > 7 {
+			return 0, fmt.Errorf("day %d is out of range 1-7", day)
+		}
+		return day - 1, nil
+	}
+	if col, ok := dayNames[value]; ok {
+		return col, nil
+	}
+	return 0, fmt.Errorf("unknown day %q, expected 1-7 or Mon-Sun", value)
+}
+
+// ParseWeekPattern 解析周次，如 "1-16"、"1,3,5"、"1-8,10-12"、"1-16 odd"（单周）、"2-16双"（双周），
+// 周数须在 1 到 weekCount 之间，返回排序去重后的周数
+func ParseWeekPattern(value string, weekCount int) ([]int, error) {
+	normalized := strings.NewReplacer("，", ",", "、", ",", ";", ",", "~", "-", "－", "-", "—", "-",
+		"(", "", ")", "", "（", "", "）", "", "周", "").Replace(strings.ToLower(value))
+
+	seen := map[int]bool{}
+	for _, item := range strings.Split(normalized, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		// 单双周后缀
+		parity := -1
+		for suffix, p := range map[string]int{"odd": 1, "单": 1, "even": 0, "双": 0} {
+			if strings.HasSuffix(item, suffix) {
+				parity = p
+				item = strings.TrimSpace(strings.TrimSuffix(item, suffix))
+				break
+			}
+		}
+
+		bounds := strings.SplitN(item, "-", 2)
+		start, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid week pattern %q", value)
+		}
+		end := start
+		if len(bounds) == 2 {
+			if end, err = strconv.Atoi(strings.TrimSpace(bounds[1])); err != nil {
+				return nil, fmt.Errorf("invalid week pattern %q", value)
+			}
+		}
+		if start > end {
+			return nil, fmt.Errorf("invalid week range %d-%d", start, end)
+		}
+		if start < 1 || end > weekCount {
+			return nil, fmt.Errorf("unknown week in %q, the term has weeks 1-%d", item, weekCount)
+		}
+		for week := start; week <= end; week++ {
+			if parity < 0 || week%2 == parity {
+				seen[week] = true
+			}
+		}
+	}
+	if len(seen) == 0 {
+		return nil, fmt.Errorf("week pattern %q selects no weeks", value)
+	}
+
+	weeks := make([]int, 0, len(seen))
+	for week := range seen {
+		weeks = append(weeks, week)
+	}
+	sort.Ints(weeks)
+	return weeks, nil
+}
+
+// importHeader 将表头映射为列序号，缺少必需列时返回错误
+func importHeader(header []string) (map[string]int, error) {
+	aliases := map[string]string{}
+	for column, names := range importColumns {
+		for _, name := range names {
+			aliases[name] = column
+		}
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		name = strings.NewReplacer(" ", "", "_", "").Replace(name)
+		if column, ok := aliases[name]; ok {
+			columns[column] = i
+		}
+	}
+	for _, column := range requiredImportColumns {
+		if _, ok := columns[column]; !ok {
+			return nil, fmt.Errorf("%w: missing column %q", ErrInvalidImport, column)
+		}
+	}
+	return columns, nil
+}
+
+// parseImportLines 解析导入文件的数据行，返回解析成功的行和各行的错误
+func parseImportLines(tx *gorm.DB, reader io.Reader, weekCount int) ([]importLine, []ImportLineError, int, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+	csvReader.TrimLeadingSpace = true
+
+	header, err := csvReader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil, 0, fmt.Errorf("%w: file is empty", ErrInvalidImport)
+		}
+		return nil, nil, 0, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+	}
+	columns, err := importHeader(header)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	var lines []importLine
+	var lineErrors []ImportLineError
+	count := 0
+	for {
+		record, err := csvReader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			// 解析失败的行没有字段位置，行号取自解析错误
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				lineErrors = append(lineErrors, ImportLineError{Line: parseErr.Line, Message: parseErr.Err.Error()})
+				count++
+				continue
+			}
+			return nil, nil, 0, err
+		}
+		lineNumber, _ := csvReader.FieldPos(0)
+
+		field := func(column string) string {
+			index, ok := columns[column]
+			if !ok || index >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[index])
+		}
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+		count++
+
+		fail := func(column string, format string, args ...interface{}) {
+			lineErrors = append(lineErrors, ImportLineError{Line: lineNumber, Column: column, Message: fmt.Sprintf(format, args...)})
+		}
+		line := importLine{Line: lineNumber, ClassName: field("class"), Course: field("course")}
+		valid := true
+
+		// 1. 班级和课程
+		if line.ClassName == "" {
+			fail("class", "class is required")
+			valid = false
+		}
+		if line.Course == "" {
+			fail("course", "course is required")
+			valid = false
+		}
+
+		// 2. 位置
+		if line.Col, err = ParseDay(field("day")); err != nil {
+			fail("day", "%v", err)
+			valid = false
+		}
+		period, err := strconv.Atoi(field("period"))
+		if err != nil || period < 1 || period > periodCount {
+			fail("period", "period %q is out of range 1-%d", field("period"), periodCount)
+			valid = false
+		}
+		line.Row = period - 1
+
+		// 3. 周次
+		if line.Weeks, err = ParseWeekPattern(field("weeks"), weekCount); err != nil {
+			fail("weeks", "%v", err)
+			valid = false
+		}
+
+		// 4. 教师和教室按名称查找
+		if name := field("teacher"); name != "" {
+			var teachers []models.Teacher
+			if err := tx.Where("name = ?", name).Limit(2).Find(&teachers).Error; err != nil {
+				return nil, nil, 0, err
+			}
+			switch len(teachers) {
+			case 0:
+				fail("teacher", "unknown teacher %q", name)
+				valid = false
+			case 1:
+				line.TeacherID = &teachers[0].ID
+			default:
+				fail("teacher", "teacher name %q is ambiguous", name)
+				valid = false
+			}
+		}
+		if name := field("room"); name != "" {
+			var rooms []models.Room
+			if err := tx.Where("name = ?", name).Limit(1).Find(&rooms).Error; err != nil {
+				return nil, nil, 0, err
+			}
+			if len(rooms) == 0 {
+				fail("room", "unknown room %q", name)
+				valid = false
+			} else {
+				line.RoomID = &rooms[0].ID
+			}
+		}
+
+		if valid {
+			lines = append(lines, line)
+		}
+	}
+	return lines, lineErrors, count, nil
+}
+
+// importSlotKey 班级在某一周的一个位置
+type importSlotKey struct {
+	ClassName string
+	Week      int
+	Row       int
+	Col       int
+}
+
+// ImportScheduleCSV 从CSV文件导入课程表，每行一门课：班级、课程、星期、节次、周次，可选教师和教室。
+// 每行按 SaveSchedule 的规则写入，并检查班级位置是否已有课程、教师和教室冲突；
+// 任何一行有错误时不写入任何数据，返回 ErrImportRejected 和各行的错误
+func ImportScheduleCSV(actor Actor, reader io.Reader, options ImportOptions) (*ImportResult, error) {
+	termID := options.TermID
+	if termID == 0 {
+		var err error
+		if termID, err = currentTermID(); err != nil {
+			return nil, err
+		}
+	}
+	weekCount, err := termWeekCount(termID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ImportResult{WriteResult: &WriteResult{Conflicts: []ScheduleConflict{}, Warnings: []CapacityWarning{}},
+		DryRun: options.DryRun, Classes: []string{}, Errors: []ImportLineError{}}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// 1. 解析各行
+		lines, lineErrors, count, err := parseImportLines(tx, reader, weekCount)
+		if err != nil {
+			return err
+		}
+		result.Lines = count
+		result.Errors = append(result.Errors, lineErrors...)
+		fail := func(line int, column string, format string, args ...interface{}) {
+			result.Errors = append(result.Errors, ImportLineError{Line: line, Column: column, Message: fmt.Sprintf(format, args...)})
+		}
+
+		// 2. 写入并检查冲突
+		written, classes, err := writeImportLines(tx, actor, termID, lines, options, result.WriteResult, "line", fail)
+		if err != nil {
+			return err
+		}
+		result.Lessons = len(written)
+		result.Classes = append(result.Classes, classes...)
+
+		// 3. 有错误时整体回滚
+		sort.SliceStable(result.Errors, func(i, j int) bool { return result.Errors[i].Line < result.Errors[j].Line })
+		if len(result.Errors) > 0 {
+			return ErrImportRejected
+		}
+		if err := recordInsertsByClass(tx, actor, written); err != nil {
+			return err
+		}
+		if options.DryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if errors.Is(err, errDryRun) {
+		return result, nil
+	}
+	if errors.Is(err, ErrImportRejected) {
+		result.Lessons = 0
+		return result, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	publishScheduleEvents()
+	return result, nil
+}
+
+// importErrorAt 记录一条导入错误，ref 为CSV中的行号或FET中的活动编号
+type importErrorAt func(ref int, column string, format string, args ...interface{})
+
+// writeImportLines 检查并写入导入的课程：同一班级同一位置不能重复，班级已有课程的位置不能覆盖，
+// 教师和教室不能冲突。错误通过 fail 记录，label 为错误信息中引用来源的名称（line 或 activity），
+// 冲突和容量提醒写入 result，返回写入的课程和涉及的班级
+func writeImportLines(tx *gorm.DB, actor Actor, termID uint, lines []importLine, options ImportOptions,
+	result *WriteResult, label string, fail importErrorAt) ([]models.WeeklySchedule, []string, error) {
+	// 1. 文件中同一班级同一位置只能有一门课
+	used := map[importSlotKey]int{}
+	var accepted []importLine
+	for _, line := range lines {
+		duplicate := false
+		for _, week := range line.Weeks {
+			key := importSlotKey{line.ClassName, week, line.Row, line.Col}
+			if other, ok := used[key]; ok {
+				fail(line.Line, "weeks", "week %d slot is already used by %s %d", week, label, other)
+				duplicate = true
+				break
+			}
+		}
+		if duplicate {
+			continue
+		}
+		for _, week := range line.Weeks {
+			used[importSlotKey{line.ClassName, week, line.Row, line.Col}] = line.Line
+		}
+		accepted = append(accepted, line)
+	}
+
+	// 2. 替换模式下先清空各班级的课程
+	if options.Replace {
+		cleared := map[string]bool{}
+		for _, line := range accepted {
+			if cleared[line.ClassName] {
+				continue
+			}
+			cleared[line.ClassName] = true
+			class, err := findClassByName(tx, line.ClassName)
+			if errors.Is(err, ErrClassNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			var existing []models.WeeklySchedule
+			if err := tx.Where("term_id = ? AND class_id = ?", termID, class.ID).Find(&existing).Error; err != nil {
+				return nil, nil, err
+			}
+			if len(existing) == 0 {
+				continue
+			}
+			if err := tx.Delete(&existing).Error; err != nil {
+				return nil, nil, err
+			}
+			if err := recordScheduleChange(tx, actor, models.ScheduleChangeDelete, termID, class.ID, existing, nil); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	// 3. 按 SaveSchedule 的规则逐行写入
+	var written []models.WeeklySchedule
+	lineOf := map[importSlotKey]int{}
+	classes := map[string]bool{}
+	var classNames []string
+	for _, line := range accepted {
+		// 班级在这些周的该位置已有课程
+		var occupied []models.WeeklySchedule
+		err := tx.Joins("JOIN classes ON classes.id = weekly_schedules.class_id").
+			Where("classes.name = ? AND weekly_schedules.term_id = ? AND weekly_schedules.time_slot_row = ? AND weekly_schedules.time_slot_col = ? AND weekly_schedules.week_number IN ?",
+				line.ClassName, termID, line.Row, line.Col, line.Weeks).
+			Order("weekly_schedules.week_number").Limit(1).Find(&occupied).Error
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(occupied) > 0 {
+			fail(line.Line, "weeks", "class %s already has a lesson in week %d at this slot", line.ClassName, occupied[0].WeekNumber)
+			continue
+		}
+
+		grid := make([][]*CourseAssignmentData, line.Row+1)
+		grid[line.Row] = make([]*CourseAssignmentData, line.Col+1)
+		grid[line.Row][line.Col] = &CourseAssignmentData{
+			Name:          line.Course,
+			WeekType:      "discrete",
+			SelectedWeeks: line.Weeks,
+			TeacherID:     line.TeacherID,
+			RoomID:        line.RoomID,
+		}
+		rows, err := saveSchedule(tx, termID, ScheduleData{
+			ClassName:            line.ClassName,
+			Schedule:             grid,
+			RejectUnknownCourses: options.RejectUnknownCourses,
+		})
+		switch {
+		case errors.Is(err, ErrUnknownCourse):
+			fail(line.Line, "course", "unknown course %q", line.Course)
+			continue
+		case errors.Is(err, ErrClassArchived), errors.Is(err, ErrInvalidClassName):
+			fail(line.Line, "class", "%v", err)
+			continue
+		case err != nil:
+			return nil, nil, err
+		}
+		for _, row := range rows {
+			lineOf[importSlotKey{line.ClassName, row.WeekNumber, row.TimeSlotRow, row.TimeSlotCol}] = line.Line
+		}
+		written = append(written, rows...)
+		if !classes[line.ClassName] {
+			classes[line.ClassName] = true
+			classNames = append(classNames, line.ClassName)
+		}
+	}
+
+	// 4. 教师和教室冲突及教室容量
+	conflicts, err := checkConflicts(tx, written)
+	if err != nil {
+		return nil, nil, err
+	}
+	if result.Warnings, err = checkCapacity(tx, written); err != nil {
+		return nil, nil, err
+	}
+	// 同一来源与同一班级的同一资源冲突合并为一条错误，列出各周；
+	// 同一来源的多个班级共用教师和教室（FET 中合班上课的活动）不算冲突
+	type conflictKey struct {
+		Line         int
+		Type         string
+		ResourceName string
+		OtherClass   string
+		OtherLine    int
+	}
+	conflictWeeks := map[conflictKey][]string{}
+	var conflictOrder []conflictKey
+	for _, conflict := range conflicts {
+		key := conflictKey{
+			Line:         lineOf[importSlotKey{conflict.ClassName, conflict.WeekNumber, conflict.TimeSlotRow, conflict.TimeSlotCol}],
+			Type:         conflict.Type,
+			ResourceName: conflict.ResourceName,
+			OtherClass:   conflict.OtherClassName,
+			OtherLine:    lineOf[importSlotKey{conflict.OtherClassName, conflict.WeekNumber, conflict.TimeSlotRow, conflict.TimeSlotCol}],
+		}
+		if key.OtherLine == key.Line {
+			continue
+		}
+		result.Conflicts = append(result.Conflicts, conflict)
+		if _, ok := conflictWeeks[key]; !ok {
+			conflictOrder = append(conflictOrder, key)
+		}
+		conflictWeeks[key] = append(conflictWeeks[key], strconv.Itoa(conflict.WeekNumber))
+	}
+	for _, key := range conflictOrder {
+		other := "class " + key.OtherClass
+		if key.OtherLine > 0 {
+			other += fmt.Sprintf(" (%s %d)", label, key.OtherLine)
+		}
+		fail(key.Line, key.Type, "%s %s is double-booked with %s in weeks %s",
+			key.Type, key.ResourceName, other, strings.Join(conflictWeeks[key], ", "))
+	}
+
+	return written, classNames, nil
+}
@@ -0,0 +1,29 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestImportScheduleCSVReportsMalformedLines(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		csv  string
+		line int
+	}{
+		{"bare quote", "class,course,day,period,weeks\nx\"y,数学,1,1,1\nC1,数学,2,1,1\n", 2},
+		{"unterminated quote", "class,course,day,period,weeks\nC1,数学,1,1,1\n\"C1,物理,2,1,1\n", 3},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			setupTestDB(t)
+			result, err := ImportScheduleCSV(Actor{}, strings.NewReader(test.csv), ImportOptions{DryRun: true})
+			if !errors.Is(err, ErrImportRejected) {
+				t.Fatalf("err = %v, want ErrImportRejected", err)
+			}
+			if len(result.Errors) != 1 || result.Errors[0].Line != test.line {
+				t.Errorf("errors = %+v, want one error on line %d", result.Errors, test.line)
+			}
+		})
+	}
+}
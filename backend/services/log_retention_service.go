@@ -0,0 +1,389 @@
+package services
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reschedule-program/database"
+	"reschedule-program/models"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidRetentionPolicy = errors.New("invalid log retention policy")
+	ErrLogArchiveNotFound     = errors.New("log archive not found")
+)
+
+const (
+	logRetentionInterval = time.Hour      // 后台清理间隔
+	logArchiveDir        = "log_archives" // 归档文件目录，相对于服务运行目录
+	logArchiveSuffix     = ".jsonl.gz"
+)
+
+// systemActor 后台任务的操作人
+var systemActor = Actor{Username: "System"}
+
+var (
+	logPruneMutex  sync.Mutex // 后台清理与手动清理不能同时进行
+	nextLogPruneAt *time.Time // 下一次后台清理的时间，由 logPruneMutex 保护
+)
+
+// RetentionPolicyData 修改日志保留策略的请求数据
+type RetentionPolicyData struct {
+	MaxAgeDays int  `json:"maxAgeDays"`
+	MaxRows    int  `json:"maxRows"`
+	Archive    bool `json:"archive"`
+}
+
+// LogArchiveInfo 一个日志归档文件
+type LogArchiveInfo struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// LogRetentionStatus 日志保留策略及当前状态
+type LogRetentionStatus struct {
+	Policy      models.LogRetentionPolicy `json:"policy"`
+	TotalRows   int64                     `json:"totalRows"`
+	OldestAt    *time.Time                `json:"oldestAt"`    // 最早一条日志的时间
+	PendingRows int64                     `json:"pendingRows"` // 按当前策略下一次清理将删除的条数
+	NextRunAt   *time.Time                `json:"nextRunAt"`   // 下一次后台清理的时间
+	Archives    []LogArchiveInfo          `json:"archives"`
+}
+
+// LogPruneResult 一次清理的结果
+type LogPruneResult struct {
+	DryRun  bool   `json:"dryRun"`
+	Pruned  int64  `json:"pruned"`  // 删除（预览时为将删除）的条数
+	Archive string `json:"archive"` // 写入的归档文件名，未归档时为空
+}
+
+// logRange 待清理日志的条数和ID范围
+type logRange struct {
+	Count int64
+	MinID uint
+	MaxID uint
+}
+
+// getRetentionPolicy 读取日志保留策略，不存在时创建不限制的默认策略
+func getRetentionPolicy(db *gorm.DB) (models.LogRetentionPolicy, error) {
+	var policy models.LogRetentionPolicy
+	err := db.FirstOrCreate(&policy, models.LogRetentionPolicy{ID: 1}).Error
+	return policy, err
+}
+
+// logPruneScope 按保留策略确定的清理范围：早于 Before 的日志，以及ID不大于 MaxID 的日志
+type logPruneScope struct {
+	Before *time.Time
+	MaxID  uint
+}
+
+// apply 筛选范围内的日志，包括已软删除的
+func (s logPruneScope) apply(db *gorm.DB) *gorm.DB {
+	db = db.Model(&models.ActivityLog{}).Unscoped()
+	switch {
+	case s.Before != nil && s.MaxID > 0:
+		return db.Where("created_at < ? OR id <= ?", *s.Before, s.MaxID)
+	case s.Before != nil:
+		return db.Where("created_at < ?", *s.Before)
+	default:
+		return db.Where("id <= ?", s.MaxID)
+	}
+}
+
+// prunableLogs 按保留策略确定应清理的日志：早于最长保留天数的，以及最新 MaxRows 条以外的。
+// 没有应清理的范围时返回 nil
+func prunableLogs(policy models.LogRetentionPolicy, now time.Time) (*logPruneScope, error) {
+	scope := &logPruneScope{}
+	if policy.MaxAgeDays > 0 {
+		before := now.AddDate(0, 0, -policy.MaxAgeDays)
+		scope.Before = &before
+	}
+	if policy.MaxRows > 0 {
+		// 最新 MaxRows 条之后的第一条及更早的日志超出条数
+		var ids []uint
+		err := database.DB.Model(&models.ActivityLog{}).Unscoped().
+			Order("id DESC").Offset(policy.MaxRows).Limit(1).Pluck("id", &ids).Error
+		if err != nil {
+			return nil, err
+		}
+		if len(ids) > 0 {
+			scope.MaxID = ids[0]
+		}
+	}
+	if scope.Before == nil && scope.MaxID == 0 {
+		return nil, nil
+	}
+	return scope, nil
+}
+
+// pendingLogRange 统计清理范围内的日志
+func pendingLogRange(scope *logPruneScope) (logRange, error) {
+	var pending logRange
+	if scope == nil {
+		return pending, nil
+	}
+	err := scope.apply(database.DB).
+		Select("COUNT(*) AS count, COALESCE(MIN(id), 0) AS min_id, COALESCE(MAX(id), 0) AS max_id").Scan(&pending).Error
+	return pending, err
+}
+
+// GetLogRetentionStatus 获取日志保留策略、日志总数、待清理条数和归档文件列表
+func GetLogRetentionStatus() (*LogRetentionStatus, error) {
+	policy, err := getRetentionPolicy(database.DB)
+	if err != nil {
+		return nil, err
+	}
+	status := &LogRetentionStatus{Policy: policy, Archives: []LogArchiveInfo{}}
+
+	if err := database.DB.Model(&models.ActivityLog{}).Count(&status.TotalRows).Error; err != nil {
+		return nil, err
+	}
+	var oldest []models.ActivityLog
+	if err := database.DB.Order("id ASC").Limit(1).Find(&oldest).Error; err != nil {
+		return nil, err
+	}
+	if len(oldest) > 0 {
+		status.OldestAt = &oldest[0].CreatedAt
+	}
+	scope, err := prunableLogs(policy, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	pending, err := pendingLogRange(scope)
+	if err != nil {
+		return nil, err
+	}
+	status.PendingRows = pending.Count
+
+	logPruneMutex.Lock()
+	status.NextRunAt = nextLogPruneAt
+	logPruneMutex.Unlock()
+
+	// 归档目录不存在时说明尚未归档过
+	entries, err := os.ReadDir(logArchiveDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), logArchiveSuffix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		status.Archives = append(status.Archives, LogArchiveInfo{Name: entry.Name(), Size: info.Size(), CreatedAt: info.ModTime()})
+	}
+	sort.Slice(status.Archives, func(i, j int) bool { return status.Archives[i].Name > status.Archives[j].Name })
+	return status, nil
+}
+
+// UpdateLogRetentionPolicy 修改日志保留策略，新策略在下一次清理时生效
+func UpdateLogRetentionPolicy(actor Actor, data RetentionPolicyData) (*models.LogRetentionPolicy, error) {
+	if data.MaxAgeDays < 0 || data.MaxRows < 0 {
+		return nil, fmt.Errorf("%w: maxAgeDays and maxRows must not be negative", ErrInvalidRetentionPolicy)
+	}
+
+	var policy models.LogRetentionPolicy
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if policy, err = getRetentionPolicy(tx); err != nil {
+			return err
+		}
+		before := RetentionPolicyData{MaxAgeDays: policy.MaxAgeDays, MaxRows: policy.MaxRows, Archive: policy.Archive}
+		policy.MaxAgeDays, policy.MaxRows, policy.Archive = data.MaxAgeDays, data.MaxRows, data.Archive
+		if err := tx.Save(&policy).Error; err != nil {
+			return err
+		}
+		return RecordActivity(tx, actor, ActivityEvent{
+			Action:     models.ActivityLogRetention,
+			EntityType: models.EntityActivityLog,
+			Before:     before,
+			After:      data,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// writeLogArchive 将ID范围内应清理的日志按ID顺序写入 gzip 压缩的 JSONL 文件，返回文件名。
+// 先写入临时文件，完整写入后才改为正式文件名
+func writeLogArchive(scope *logPruneScope, pending logRange, now time.Time) (string, error) {
+	if err := os.MkdirAll(logArchiveDir, 0755); err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("activity_logs_%s_%d-%d%s", now.Format("20060102T150405"), pending.MinID, pending.MaxID, logArchiveSuffix)
+	path := filepath.Join(logArchiveDir, name)
+	file, err := os.Create(path + ".tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(path + ".tmp")
+	defer file.Close()
+
+	buffered := bufio.NewWriter(file)
+	compressed := gzip.NewWriter(buffered)
+	encoder := json.NewEncoder(compressed)
+	var lastID uint
+	for {
+		var logs []models.ActivityLog
+		err := scope.apply(database.DB).Where("id > ? AND id <= ?", lastID, pending.MaxID).
+			Order("id ASC").Limit(logExportBatchSize).Find(&logs).Error
+		if err != nil {
+			return "", err
+		}
+		for _, entry := range logs {
+			if err := encoder.Encode(entry); err != nil {
+				return "", err
+			}
+		}
+		if len(logs) < logExportBatchSize {
+			break
+		}
+		lastID = logs[len(logs)-1].ID
+	}
+
+	if err := compressed.Close(); err != nil {
+		return "", err
+	}
+	if err := buffered.Flush(); err != nil {
+		return "", err
+	}
+	if err := file.Sync(); err != nil {
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		return "", err
+	}
+	return name, os.Rename(path+".tmp", path)
+}
+
+// PruneLogs 按保留策略清理活动日志：策略要求归档时先写入归档文件，再在一个事务中删除并记录清理日志。
+// 删除失败时移除本次的归档文件，dryRun 为 true 时只统计将删除的条数
+func PruneLogs(actor Actor, dryRun bool) (*LogPruneResult, error) {
+	logPruneMutex.Lock()
+	defer logPruneMutex.Unlock()
+
+	// 1. 统计应清理的日志
+	policy, err := getRetentionPolicy(database.DB)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	scope, err := prunableLogs(policy, now)
+	if err != nil {
+		return nil, err
+	}
+	pending, err := pendingLogRange(scope)
+	if err != nil {
+		return nil, err
+	}
+	result := &LogPruneResult{DryRun: dryRun, Pruned: pending.Count}
+	if dryRun {
+		return result, nil
+	}
+
+	run := func() error {
+		if pending.Count == 0 {
+			return nil
+		}
+
+		// 2. 按需归档
+		var err error
+		if policy.Archive {
+			if result.Archive, err = writeLogArchive(scope, pending, now); err != nil {
+				return err
+			}
+		}
+
+		// 3. 删除已归档的日志并记录清理日志，此后写入的日志ID更大，不会被删除
+		err = database.DB.Transaction(func(tx *gorm.DB) error {
+			deleted := scope.apply(tx).Where("id <= ?", pending.MaxID).Delete(&models.ActivityLog{})
+			if deleted.Error != nil {
+				return deleted.Error
+			}
+			result.Pruned = deleted.RowsAffected
+			return RecordActivity(tx, actor, ActivityEvent{
+				Action:     models.ActivityLogPrune,
+				EntityType: models.EntityActivityLog,
+				After: map[string]interface{}{
+					"pruned": result.Pruned, "archive": result.Archive,
+					"maxAgeDays": policy.MaxAgeDays, "maxRows": policy.MaxRows,
+				},
+			})
+		})
+		if err != nil && result.Archive != "" {
+			os.Remove(filepath.Join(logArchiveDir, result.Archive))
+			result.Archive = ""
+		}
+		return err
+	}
+	err = run()
+
+	// 4. 记录本次清理的结果
+	lastError := ""
+	if err != nil {
+		lastError = err.Error()
+		result.Pruned = 0
+	}
+	database.DB.Model(&models.LogRetentionPolicy{}).Where("id = ?", policy.ID).Updates(map[string]interface{}{
+		"last_run_at": now, "last_pruned": result.Pruned, "last_archive": result.Archive, "last_error": lastError,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// StartLogRetention 启动后台清理任务：启动时清理一次，之后每 logRetentionInterval 清理一次
+func StartLogRetention() {
+	schedule := func() {
+		next := time.Now().Add(logRetentionInterval)
+		logPruneMutex.Lock()
+		nextLogPruneAt = &next
+		logPruneMutex.Unlock()
+	}
+	prune := func() {
+		if result, err := PruneLogs(systemActor, false); err != nil {
+			log.Println("Failed to prune activity logs:", err)
+		} else if result.Pruned > 0 {
+			log.Printf("Pruned %d activity logs", result.Pruned)
+		}
+		schedule()
+	}
+
+	go func() {
+		prune()
+		ticker := time.NewTicker(logRetentionInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			prune()
+		}
+	}()
+}
+
+// LogArchivePath 归档文件的路径，只允许访问归档目录中的归档文件
+func LogArchivePath(name string) (string, error) {
+	if name != filepath.Base(name) || !strings.HasSuffix(name, logArchiveSuffix) {
+		return "", ErrLogArchiveNotFound
+	}
+	path := filepath.Join(logArchiveDir, name)
+	if info, err := os.Stat(path); err != nil || info.IsDir() {
+		return "", ErrLogArchiveNotFound
+	}
+	return path, nil
+}
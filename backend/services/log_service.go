@@ -1,31 +1,161 @@
 package services
 
 import (
+	"errors"
 	"reschedule-program/database"
 	"reschedule-program/models"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrInvalidLogQuery = errors.New("invalid log query")
+
+// 日志查询每页条数
+const (
+	defaultLogPageSize = 50
+	maxLogPageSize     = 500
+	logExportBatchSize = 500
 )
 
-type LogService struct{}
+// LogQuery 活动日志查询条件，为空的条件不筛选
+type LogQuery struct {
+	From      *time.Time // 不早于该时间
+	To        *time.Time // 早于该时间
+	Actor     string     // 操作人用户ID或用户名
+	Actions   []string   // 操作类型，以 .* 结尾时按前缀匹配，如 schedule.*
+	ClassName string     // 涉及的班级
+	Text      string     // 日志消息或操作对象名称包含的文本
+	Before    uint       // 游标：只返回ID小于该值的日志
+	Limit     int        // 每页条数
+}
 
-func NewLogService() *LogService {
-	return &LogService{}
+// LogPage 一页活动日志，NextCursor 为下一页的游标，没有更多日志时为 0
+type LogPage struct {
+	Logs       []models.ActivityLog `json:"logs"`
+	NextCursor uint                 `json:"nextCursor"`
 }
 
-func (s *LogService) AddLog(message string) error {
-	log := models.ActivityLog{
-		Message: message,
+// visibleLogs 按会话筛选可见的日志：管理员可见全部，其他用户只能看到未归档班级的发布日志，且不含客户端IP。
+// 其他课程表日志记录的是未发布的草稿修改，不对非管理员开放
+func visibleLogs(db *gorm.DB, session *models.Session) *gorm.DB {
+	if session != nil && isAdmin(session) {
+		return db
 	}
-	return database.DB.Create(&log).Error
+	visible := database.DB.Model(&models.Class{}).Select("id").Where("archived = ?", false)
+	return db.Where("action = ? AND class_id IN (?)", models.ActivitySchedulePublish, visible)
 }
 
-func (s *LogService) GetAllLogs() ([]models.ActivityLog, error) {
-	var logs []models.ActivityLog
-	err := database.DB.Order("created_at desc").Find(&logs).Error
-	return logs, err
+// filterLogs 按查询条件筛选日志，按ID倒序（最新的在前）
+func filterLogs(session *models.Session, query LogQuery) (*gorm.DB, error) {
+	if query.From != nil && query.To != nil && !query.From.Before(*query.To) {
+		return nil, ErrInvalidLogQuery
+	}
+	db := visibleLogs(database.DB.Model(&models.ActivityLog{}), session).Order("id DESC")
+
+	if query.From != nil {
+		// 数据库按服务器本地时区保存时间，比较前转换到同一时区
+		db = db.Where("created_at >= ?", query.From.In(time.Local))
+	}
+	if query.To != nil {
+		db = db.Where("created_at < ?", query.To.In(time.Local))
+	}
+	if actor := strings.TrimSpace(query.Actor); actor != "" {
+		db = db.Where("actor_id = ? OR actor_name = ?", actor, actor)
+	}
+	if len(query.Actions) > 0 {
+		conditions := database.DB
+		for i, action := range query.Actions {
+			condition, value := "action = ?", action
+			if strings.HasSuffix(action, ".*") {
+				condition, value = "action LIKE ?", strings.TrimSuffix(action, "*")+"%"
+			}
+			if i == 0 {
+				conditions = conditions.Where(condition, value)
+			} else {
+				conditions = conditions.Or(condition, value)
+			}
+		}
+		db = db.Where(conditions)
+	}
+	if query.ClassName != "" {
+		class, err := findClassByName(database.DB, query.ClassName)
+		if err != nil {
+			return nil, err
+		}
+		db = db.Where("class_id = ?", class.ID)
+	}
+	if text := strings.TrimSpace(query.Text); text != "" {
+		pattern := "%" + text + "%"
+		db = db.Where("message LIKE ? OR entity_name LIKE ?", pattern, pattern)
+	}
+	if query.Before > 0 {
+		db = db.Where("id < ?", query.Before)
+	}
+	return db, nil
 }
 
-func (s *LogService) GetRecentLogs(limit int) ([]models.ActivityLog, error) {
+// hideClientIP 非管理员不返回客户端IP
+func hideClientIP(session *models.Session, logs []models.ActivityLog) {
+	if session != nil && isAdmin(session) {
+		return
+	}
+	for i := range logs {
+		logs[i].ClientIP = ""
+	}
+}
+
+// QueryLogs 按条件分页查询会话可见的活动日志，最新的在前
+func QueryLogs(session *models.Session, query LogQuery) (*LogPage, error) {
+	limit := query.Limit
+	if limit <= 0 {
+		limit = defaultLogPageSize
+	}
+	if limit > maxLogPageSize {
+		limit = maxLogPageSize
+	}
+
+	db, err := filterLogs(session, query)
+	if err != nil {
+		return nil, err
+	}
+	// 多取一条判断是否还有下一页
 	var logs []models.ActivityLog
-	err := database.DB.Order("created_at desc").Limit(limit).Find(&logs).Error
-	return logs, err
-} 
\ No newline at end of file
+	if err := db.Limit(limit + 1).Find(&logs).Error; err != nil {
+		return nil, err
+	}
+
+	page := &LogPage{Logs: logs}
+	if len(logs) > limit {
+		page.Logs = logs[:limit]
+		page.NextCursor = page.Logs[limit-1].ID
+	}
+	hideClientIP(session, page.Logs)
+	return page, nil
+}
+
+// ExportLogs 按条件分批读取会话可见的全部活动日志并逐条交给 write，最新的在前，不受分页条数限制
+func ExportLogs(session *models.Session, query LogQuery, write func(models.ActivityLog) error) error {
+	query.Limit = 0
+	for {
+		db, err := filterLogs(session, query)
+		if err != nil {
+			return err
+		}
+		var logs []models.ActivityLog
+		if err := db.Limit(logExportBatchSize).Find(&logs).Error; err != nil {
+			return err
+		}
+		hideClientIP(session, logs)
+		for _, entry := range logs {
+			if err := write(entry); err != nil {
+				return err
+			}
+		}
+		if len(logs) < logExportBatchSize {
+			return nil
+		}
+		query.Before = logs[len(logs)-1].ID
+	}
+}
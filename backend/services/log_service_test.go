@@ -0,0 +1,48 @@
+package services
+
+import (
+	"reschedule-program/models"
+	"testing"
+)
+
+func TestQueryLogsHidesDraftEditsFromNonAdmins(t *testing.T) {
+	setupTestDB(t)
+	if _, err := SaveSchedule(Actor{Username: "Admin"}, ScheduleData{ClassName: "C1", Schedule: [][]*CourseAssignmentData{
+		{lessonData("数学", 1)},
+	}}, false); err != nil {
+		t.Fatalf("SaveSchedule: %v", err)
+	}
+	if _, err := PublishSchedule(Actor{Username: "Admin"}, "C1"); err != nil {
+		t.Fatalf("PublishSchedule: %v", err)
+	}
+	if _, err := MoveSchedule(Actor{Username: "Admin"}, "C1", 1, 0, 0, 1, 1, 0, false); err != nil {
+		t.Fatalf("MoveSchedule: %v", err)
+	}
+
+	for _, test := range []struct {
+		session *models.Session
+		want    []string
+	}{
+		{nil, []string{models.ActivitySchedulePublish}},
+		{&models.Session{Username: "viewer", UserType: "viewer"}, []string{models.ActivitySchedulePublish}},
+		{&models.Session{Username: "Admin", UserType: "admin"}, nil},
+	} {
+		page, err := QueryLogs(test.session, LogQuery{})
+		if err != nil {
+			t.Fatalf("QueryLogs: %v", err)
+		}
+		if test.want == nil {
+			if len(page.Logs) < 3 {
+				t.Errorf("admin sees %d logs, want every entry", len(page.Logs))
+			}
+			continue
+		}
+		var actions []string
+		for _, entry := range page.Logs {
+			actions = append(actions, entry.Action)
+		}
+		if len(actions) != len(test.want) || actions[0] != test.want[0] {
+			t.Errorf("session %+v sees %v, want %v", test.session, actions, test.want)
+		}
+	}
+}
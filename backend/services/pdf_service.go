@@ -0,0 +1,368 @@
+package services
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"fmt"
+	"reschedule-program/models"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/go-pdf/fpdf"
+)
+
+const (
+	pdfFontFamily = "timetable"
+	pdfMargin     = 10.0 // 页边距 mm
+	pdfLabelWidth = 24.0 // 节次列宽度 mm
+	pdfMinFont    = 6.0  // 单元格内容放不下时最小缩小到的字号
+)
+
+var ErrInvalidPDFWeek = errors.New("week is outside the term")
+
+// pdfFont 文泉驿微米黑（Apache 2.0）的子集：ASCII、中文标点、全角字符和 GB2312 汉字，生成 PDF 时只嵌入用到的字形
+//
+//go:embed fonts/timetable.ttf
+var pdfFont []byte
+
+// TimetablePDF 打印用的课程表 PDF，相同数据生成的内容完全相同
+type TimetablePDF struct {
+	Content      []byte
+	Name         string    // 班级、教师或教室的名称
+	LastModified time.Time // 课程表中课程的最后修改时间
+}
+
+// lessonDetails 一节课除课程名以外显示的信息：导出对象以外的班级、教师和教室
+func lessonDetails(scope string, className string, teacher string, room string) []string {
+	var parts []string
+	if scope != models.CalendarScopeClass && scope != ExportScopeTerm {
+		parts = append(parts, className)
+	}
+	if scope != models.CalendarScopeTeacher && teacher != "" {
+		parts = append(parts, teacher)
+	}
+	if scope != models.CalendarScopeRoom && room != "" {
+		parts = append(parts, room)
+	}
+	return parts
+}
+
+// FormatWeekRanges 将周数列表写成区间，如 "1-8,10-16周"；连续的单周或双周写成 "1-15单周"
+func FormatWeekRanges(weeks []int) string {
+	var parts []string
+	for i := 0; i < len(weeks); {
+		j := i
+		for j+1 < len(weeks) && weeks[j+1]-weeks[j] == 1 {
+			j++
+		}
+		if j > i {
+			parts = append(parts, fmt.Sprintf("%d-%d", weeks[i], weeks[j]))
+			i = j + 1
+			continue
+		}
+		for j+1 < len(weeks) && weeks[j+1]-weeks[j] == 2 {
+			j++
+		}
+		if j-i >= 2 {
+			parity := "双"
+			if weeks[i]%2 == 1 {
+				parity = "单"
+			}
+			parts = append(parts, fmt.Sprintf("%d-%d%s", weeks[i], weeks[j], parity))
+			i = j + 1
+			continue
+		}
+		parts = append(parts, strconv.Itoa(weeks[i]))
+		i++
+	}
+	return strings.Join(parts, ",") + "周"
+}
+
+// pdfText 去掉字体无法处理的字符（基本多文种平面以外的字符）
+func pdfText(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r > 0xFFFF {
+			return '\uFFFD'
+		}
+		return r
+	}, value)
+}
+
+// sortCalendarLessons 按位置、班级和课程排序，保证生成的内容与查询顺序无关
+func sortCalendarLessons(lessons []calendarLesson) {
+	sort.Slice(lessons, func(i, j int) bool {
+		a, b := lessons[i], lessons[j]
+		if a.Row != b.Row {
+			return a.Row < b.Row
+		}
+		if a.Col != b.Col {
+			return a.Col < b.Col
+		}
+		if a.ClassName != b.ClassName {
+			return a.ClassName < b.ClassName
+		}
+		if a.CourseName != b.CourseName {
+			return a.CourseName < b.CourseName
+		}
+		return a.Week < b.Week
+	})
+}
+
+// weekCells 单周课程表每个单元格的内容
+func weekCells(scope string, lessons []calendarLesson, week int) [periodCount][7][]string {
+	var cells [periodCount][7][]string
+	for _, lesson := range lessons {
+		if lesson.Week != week || lesson.Row < 0 || lesson.Row >= periodCount || lesson.Col < 0 || lesson.Col > 6 {
+			continue
+		}
+		text := strings.Join(append([]string{lesson.CourseName},
+			lessonDetails(scope, lesson.ClassName, lesson.Teacher, lesson.Room)...), "\n")
+		cells[lesson.Row][lesson.Col] = append(cells[lesson.Row][lesson.Col], text)
+	}
+	return cells
+}
+
+// termCells 整个学期的汇总：同一位置相同课程、班级、教师和教室的课合并为一条，注明上课周次
+func termCells(scope string, lessons []calendarLesson) [periodCount][7][]string {
+	type entryKey struct {
+		Row     int
+		Col     int
+		Course  string
+		Details string
+	}
+	weeks := map[entryKey][]int{}
+	var order []entryKey
+	for _, lesson := range lessons {
+		if lesson.Row < 0 || lesson.Row >= periodCount || lesson.Col < 0 || lesson.Col > 6 {
+			continue
+		}
+		key := entryKey{Row: lesson.Row, Col: lesson.Col, Course: lesson.CourseName,
+			Details: strings.Join(lessonDetails(scope, lesson.ClassName, lesson.Teacher, lesson.Room), "\n")}
+		if _, ok := weeks[key]; !ok {
+			order = append(order, key)
+		}
+		weeks[key] = append(weeks[key], lesson.Week)
+	}
+
+	var cells [periodCount][7][]string
+	for _, key := range order {
+		list := weeks[key]
+		sort.Ints(list)
+		text := key.Course + " (" + FormatWeekRanges(list) + ")"
+		if key.Details != "" {
+			text += "\n" + key.Details
+		}
+		cells[key.Row][key.Col] = append(cells[key.Row][key.Col], text)
+	}
+	return cells
+}
+
+// breakable 可以在其前后断行的字符：中日韩文字和全角标点
+func breakable(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) ||
+		(r >= 0x3000 && r <= 0x303F) || (r >= 0xFF00 && r <= 0xFFEF)
+}
+
+// wrapText 按宽度折行。西文在空格处断开，中文可在任意字符处断开；
+// 不使用 fpdf 的 SplitText，它在中文字符处断行时会丢掉该字符
+func wrapText(pdf *fpdf.Fpdf, text string, width float64) []string {
+	width -= 2 * pdf.GetCellMargin()
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		runes := []rune(paragraph)
+		if len(runes) == 0 {
+			lines = append(lines, "")
+		}
+		for len(runes) > 0 {
+			// 1. 放得下的最多字符数，至少一个
+			n, used := 0, 0.0
+			for n < len(runes) {
+				w := pdf.GetStringWidth(string(runes[n]))
+				if n > 0 && used+w > width {
+					break
+				}
+				used += w
+				n++
+			}
+			// 2. 断在西文单词中间时退回到上一个空格
+			if n < len(runes) && runes[n] != ' ' && !breakable(runes[n]) && !breakable(runes[n-1]) {
+				for k := n - 1; k > 0; k-- {
+					if runes[k] == ' ' {
+						n = k
+						break
+					}
+					if breakable(runes[k]) {
+						n = k + 1
+						break
+					}
+				}
+			}
+			lines = append(lines, strings.TrimRight(string(runes[:n]), " "))
+			runes = runes[n:]
+			for len(runes) > 0 && runes[0] == ' ' {
+				runes = runes[1:]
+			}
+		}
+	}
+	return lines
+}
+
+// pdfCell 在矩形中绘制文本：自动换行，放不下时缩小字号，仍放不下时截断
+func pdfCell(pdf *fpdf.Fpdf, x, y, w, h float64, text string, maxSize float64, align string, middle bool) {
+	pdf.Rect(x, y, w, h, "D")
+	if text == "" {
+		return
+	}
+
+	var lines []string
+	var lineHeight float64
+	for size := maxSize; ; size -= 0.5 {
+		pdf.SetFontSize(size)
+		lineHeight = size * 0.45 // 1.25 倍行距，pt 换算为 mm
+		lines = wrapText(pdf, text, w)
+		if float64(len(lines))*lineHeight <= h-2 || size <= pdfMinFont {
+			break
+		}
+	}
+	if fit := int((h - 2) / lineHeight); len(lines) > fit {
+		lines = lines[:fit]
+		if fit > 0 {
+			lines[fit-1] = strings.TrimRight(lines[fit-1], " ") + "…"
+		}
+	}
+
+	top := y + 1
+	if middle {
+		top = y + (h-float64(len(lines))*lineHeight)/2
+	}
+	for i, line := range lines {
+		pdf.SetXY(x, top+float64(i)*lineHeight)
+		pdf.CellFormat(w, lineHeight, line, "", 0, align, false, 0, "")
+	}
+}
+
+// RenderTimetablePDF 生成班级、教师或教室课程表的打印版 PDF（A4 横向）。
+// week 大于 0 时为该周的课程表，为 0 时为整个学期的汇总，每个单元格注明上课周次
+func RenderTimetablePDF(options ExportOptions, week int) (*TimetablePDF, error) {
+	// 1. 学期和课程
+	term, err := resolveExportTerm(options.TermID)
+	if err != nil {
+		return nil, err
+	}
+	if week < 0 || week > term.WeekCount {
+		return nil, ErrInvalidPDFWeek
+	}
+	periods, err := ParsePeriodTimes(term.PeriodTimes)
+	if err != nil {
+		return nil, err
+	}
+	if options.Scope == models.CalendarScopeClass {
+		if options.TargetID, err = exportClassID(options); err != nil {
+			return nil, err
+		}
+	}
+	name, lessons, err := scopeLessons(options.Scope, options.TargetID, term.ID, options.Draft)
+	if err != nil {
+		return nil, err
+	}
+	sortCalendarLessons(lessons)
+
+	// 文档日期使用数据的最后修改时间，使相同数据生成的文件相同
+	modified := term.UpdatedAt
+	for _, lesson := range lessons {
+		if lesson.UpdatedAt.After(modified) {
+			modified = lesson.UpdatedAt
+		}
+	}
+	if modified.IsZero() {
+		modified = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	modified = modified.UTC().Truncate(time.Second)
+
+	// 2. 标题和表头
+	title := name + " 课程表"
+	subtitle := term.Name
+	headers := make([]string, 7)
+	copy(headers, exportWeekdays)
+	var cells [periodCount][7][]string
+	if week > 0 {
+		title += fmt.Sprintf(" 第%d周", week)
+		cells = weekCells(options.Scope, lessons, week)
+		if term.ID != 0 {
+			days, err := GetWeekCalendar(term, week)
+			if err != nil {
+				return nil, err
+			}
+			subtitle = fmt.Sprintf("%s  %s 至 %s", term.Name, days[0].Date, days[6].Date)
+			for col, day := range days {
+				headers[col] += "\n" + day.Date[5:]
+				if day.Name != "" {
+					headers[col] += "\n" + day.Name
+				}
+				// 调休补课日按指定星期的课表上课
+				if day.Kind == models.CalendarDayWorkday && day.FollowsCol != nil && *day.FollowsCol != col {
+					for row := range cells {
+						cells[row][col] = append(cells[row][col], cells[row][*day.FollowsCol]...)
+					}
+				}
+			}
+		}
+	} else {
+		title += " 全学期"
+		cells = termCells(options.Scope, lessons)
+		if term.ID != 0 {
+			subtitle = fmt.Sprintf("%s  共%d周，自 %s 起", term.Name, term.WeekCount, term.StartDate)
+		}
+	}
+	if options.Draft {
+		subtitle = strings.TrimSpace(subtitle + "  （草稿）")
+	}
+
+	pdf := fpdf.New("L", "mm", "A4", "")
+	pdf.SetCreationDate(modified)
+	pdf.SetModificationDate(modified)
+	pdf.SetCatalogSort(true)
+	pdf.SetTitle(pdfText(title), true)
+	pdf.AddUTF8FontFromBytes(pdfFontFamily, "", pdfFont)
+	pdf.SetFont(pdfFontFamily, "", 16)
+	pdf.SetMargins(pdfMargin, pdfMargin, pdfMargin)
+	pdf.SetAutoPageBreak(false, 0)
+	pdf.AddPage()
+
+	pageWidth, pageHeight := pdf.GetPageSize()
+	pdf.SetXY(pdfMargin, pdfMargin)
+	pdf.CellFormat(0, 9, pdfText(title), "", 1, "C", false, 0, "")
+	pdf.SetFontSize(10)
+	pdf.CellFormat(0, 6, pdfText(subtitle), "", 1, "C", false, 0, "")
+
+	// 3. 5×7 网格
+	top := pdf.GetY() + 2
+	headerHeight := 14.0
+	dayWidth := (pageWidth - 2*pdfMargin - pdfLabelWidth) / 7
+	rowHeight := (pageHeight - pdfMargin - top - headerHeight) / periodCount
+
+	pdfCell(pdf, pdfMargin, top, pdfLabelWidth, headerHeight, "节次", 10, "C", true)
+	for col := 0; col < 7; col++ {
+		x := pdfMargin + pdfLabelWidth + float64(col)*dayWidth
+		pdfCell(pdf, x, top, dayWidth, headerHeight, pdfText(headers[col]), 10, "C", true)
+	}
+	for row := 0; row < periodCount; row++ {
+		y := top + headerHeight + float64(row)*rowHeight
+		label := fmt.Sprintf("第%d节\n%s", row+1, periods[row])
+		pdfCell(pdf, pdfMargin, y, pdfLabelWidth, rowHeight, label, 10, "C", true)
+		for col := 0; col < 7; col++ {
+			x := pdfMargin + pdfLabelWidth + float64(col)*dayWidth
+			pdfCell(pdf, x, y, dayWidth, rowHeight, pdfText(strings.Join(cells[row][col], "\n\n")), 9, "L", false)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return &TimetablePDF{Content: buf.Bytes(), Name: name, LastModified: modified}, nil
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reschedule-program/models"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite testdata/*.golden")
+
+// pdfFixtureTime 测试数据的修改时间，即 PDF 的创建日期
+var pdfFixtureTime = time.Date(2026, 8, 15, 9, 30, 0, 0, time.UTC)
+
+// setupPDFFixture 一个学期、一个班级的已发布课程表：每周的课、单周的课、节假日和调休补课日
+func setupPDFFixture(t *testing.T) {
+	t.Helper()
+	setupTestDB(t)
+
+	stamp := gorm.Model{CreatedAt: pdfFixtureTime, UpdatedAt: pdfFixtureTime}
+	mustCreate(t, &models.Term{
+		Model: stamp, Name: "2026 秋季学期", StartDate: "2026-09-07", WeekCount: 18, Active: true,
+		PeriodTimes: defaultPeriodTimes, TimeZone: "Asia/Shanghai",
+	})
+	followsMonday := 0
+	mustCreate(t, &models.CalendarDay{Model: stamp, TermID: 1, Date: "2026-09-09", Kind: models.CalendarDayHoliday, Name: "中秋节"})
+	mustCreate(t, &models.CalendarDay{Model: stamp, TermID: 1, Date: "2026-09-12", Kind: models.CalendarDayWorkday, Name: "调休", FollowsCol: &followsMonday})
+
+	mustCreate(t, &models.Teacher{Model: stamp, Name: "王老师"})
+	mustCreate(t, &models.Room{Model: stamp, Name: "教学楼101", Capacity: 40})
+	mustCreate(t, &models.Class{Model: stamp, Name: "计算机一班", Size: 30})
+	teacherID, roomID := uint(1), uint(1)
+	mustCreate(t, &models.Course{Model: stamp, Name: "高等数学", DefaultTeacherID: &teacherID})
+	mustCreate(t, &models.Course{Model: stamp, Name: "大学物理实验"})
+
+	for week := 1; week <= 16; week++ {
+		mustCreate(t, &models.PublishedSchedule{
+			TermID: 1, ClassID: 1, CourseID: 1, WeekNumber: week, TimeSlotRow: 0, TimeSlotCol: 0,
+			RoomID: &roomID, PublishedAt: pdfFixtureTime,
+		})
+	}
+	for week := 1; week <= 15; week += 2 {
+		mustCreate(t, &models.PublishedSchedule{
+			TermID: 1, ClassID: 1, CourseID: 2, WeekNumber: week, TimeSlotRow: 2, TimeSlotCol: 2,
+			TeacherID: &teacherID, PublishedAt: pdfFixtureTime,
+		})
+	}
+}
+
+func TestRenderTimetablePDFGolden(t *testing.T) {
+	tests := []struct {
+		name   string
+		week   int
+		golden string
+	}{
+		{"single week", 1, "timetable_week.golden"},
+		{"term summary", 0, "timetable_term.golden"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupPDFFixture(t)
+			golden := filepath.Join("testdata", tt.golden)
+
+			document, err := RenderTimetablePDF(ExportOptions{Scope: models.CalendarScopeClass, ClassName: "计算机一班"}, tt.week)
+			if err != nil {
+				t.Fatalf("RenderTimetablePDF: %v", err)
+			}
+			if !document.LastModified.Equal(pdfFixtureTime) {
+				t.Errorf("LastModified = %v, want %v", document.LastModified, pdfFixtureTime)
+			}
+			if document.Name != "计算机一班" {
+				t.Errorf("Name = %q, want 计算机一班", document.Name)
+			}
+
+			if *updateGolden {
+				if err := os.WriteFile(golden, document.Content, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("read golden file (run with -update to create it): %v", err)
+			}
+			if !bytes.Equal(document.Content, want) {
+				t.Errorf("PDF differs from %s (%d bytes, want %d); run with -update if the change is intended",
+					golden, len(document.Content), len(want))
+			}
+		})
+	}
+}
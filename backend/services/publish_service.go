@@ -0,0 +1,281 @@
+package services
+
+import (
+	"reschedule-program/database"
+	"reschedule-program/models"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 单元格变化类型
+const (
+	CellAdded   = "added"   // 草稿中新增的课程
+	CellRemoved = "removed" // 草稿中删除的课程
+	CellChanged = "changed" // 课程、教师或教室有变化
+)
+
+// CellContent 一个单元格的课程内容
+type CellContent struct {
+	CourseID   uint   `json:"courseId"`
+	CourseName string `json:"courseName"`
+	TeacherID  *uint  `json:"teacherId"`
+	RoomID     *uint  `json:"roomId"`
+}
+
+// CellChange 草稿与已发布版本之间一个单元格的差异
+type CellChange struct {
+	WeekNumber  int          `json:"weekNumber"`
+	TimeSlotRow int          `json:"timeSlotRow"`
+	TimeSlotCol int          `json:"timeSlotCol"`
+	Change      string       `json:"change"` // added / removed / changed
+	Published   *CellContent `json:"published"`
+	Draft       *CellContent `json:"draft"`
+}
+
+// sameUint 比较两个可为空的ID
+func sameUint(a *uint, b *uint) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// diffClassSchedule 比较班级在学期中的草稿和已发布版本，按周、时间段、星期排序
+func diffClassSchedule(tx *gorm.DB, termID uint, classID uint) ([]CellChange, error) {
+	var drafts []models.WeeklySchedule
+	if err := tx.Preload("Course").Where("term_id = ? AND class_id = ?", termID, classID).Find(&drafts).Error; err != nil {
+		return nil, err
+	}
+	var published []models.PublishedSchedule
+	if err := tx.Preload("Course").Where("term_id = ? AND class_id = ?", termID, classID).Find(&published).Error; err != nil {
+		return nil, err
+	}
+
+	draftCells := make(map[slotKey]*CellContent, len(drafts))
+	for _, row := range drafts {
+		draftCells[slotKey{row.WeekNumber, row.TimeSlotRow, row.TimeSlotCol}] = &CellContent{
+			CourseID: row.CourseID, CourseName: row.Course.Name, TeacherID: row.TeacherID, RoomID: row.RoomID,
+		}
+	}
+	publishedCells := make(map[slotKey]*CellContent, len(published))
+	for _, row := range published {
+		publishedCells[slotKey{row.WeekNumber, row.TimeSlotRow, row.TimeSlotCol}] = &CellContent{
+			CourseID: row.CourseID, CourseName: row.Course.Name, TeacherID: row.TeacherID, RoomID: row.RoomID,
+		}
+	}
+
+	changes := []CellChange{}
+	report := func(key slotKey, change string) {
+		changes = append(changes, CellChange{
+			WeekNumber: key.Week, TimeSlotRow: key.Row, TimeSlotCol: key.Col,
+			Change: change, Published: publishedCells[key], Draft: draftCells[key],
+		})
+	}
+	for key, draft := range draftCells {
+		before, ok := publishedCells[key]
+		switch {
+		case !ok:
+			report(key, CellAdded)
+		case before.CourseID != draft.CourseID || !sameUint(before.TeacherID, draft.TeacherID) || !sameUint(before.RoomID, draft.RoomID):
+			report(key, CellChanged)
+		}
+	}
+	for key := range publishedCells {
+		if _, ok := draftCells[key]; !ok {
+			report(key, CellRemoved)
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		a, b := changes[i], changes[j]
+		if a.WeekNumber != b.WeekNumber {
+			return a.WeekNumber < b.WeekNumber
+		}
+		if a.TimeSlotRow != b.TimeSlotRow {
+			return a.TimeSlotRow < b.TimeSlotRow
+		}
+		return a.TimeSlotCol < b.TimeSlotCol
+	})
+	return changes, nil
+}
+
+// GetScheduleDiff 获取班级当前学期草稿相对已发布版本的变化
+func GetScheduleDiff(className string) ([]CellChange, error) {
+	termID, err := currentTermID()
+	if err != nil {
+		return nil, err
+	}
+	class, err := findClassByName(database.DB, className)
+	if err != nil {
+		return nil, err
+	}
+	return diffClassSchedule(database.DB, termID, class.ID)
+}
+
+// PublishSchedule 发布班级当前学期的草稿，替换已发布版本，返回发布的变化
+func PublishSchedule(actor Actor, className string) ([]CellChange, error) {
+	termID, err := currentTermID()
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []CellChange
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		class, err := findClassByName(tx, className)
+		if err != nil {
+			return err
+		}
+		if changes, err = diffClassSchedule(tx, termID, class.ID); err != nil {
+			return err
+		}
+
+		// 1. 删除旧的已发布版本
+		if err := tx.Where("term_id = ? AND class_id = ?", termID, class.ID).Delete(&models.PublishedSchedule{}).Error; err != nil {
+			return err
+		}
+
+		// 2. 复制草稿
+		var drafts []models.WeeklySchedule
+		if err := tx.Where("term_id = ? AND class_id = ?", termID, class.ID).Find(&drafts).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		for _, draft := range drafts {
+			published := models.PublishedSchedule{
+				TermID:      draft.TermID,
+				ClassID:     draft.ClassID,
+				CourseID:    draft.CourseID,
+				WeekNumber:  draft.WeekNumber,
+				TimeSlotRow: draft.TimeSlotRow,
+				TimeSlotCol: draft.TimeSlotCol,
+				TeacherID:   draft.TeacherID,
+				RoomID:      draft.RoomID,
+				PublishedAt: now,
+			}
+			if err := tx.Create(&published).Error; err != nil {
+				return err
+			}
+		}
+
+		return RecordActivity(tx, actor, ActivityEvent{
+			Action: models.ActivitySchedulePublish, EntityType: models.EntityClass, EntityID: class.ID, EntityName: class.Name,
+			ClassID: class.ID, After: map[string]interface{}{"changes": changes},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// DiscardDraft 放弃班级当前学期草稿中未发布的修改，恢复为已发布版本，返回被撤销的变化。
+// 恢复的课程与其他班级的草稿存在冲突时不恢复并返回 ErrScheduleConflict
+func DiscardDraft(actor Actor, className string) (*WriteResult, []CellChange, error) {
+	termID, err := currentTermID()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var changes []CellChange
+	result, err := runScheduleWrite(false, func(tx *gorm.DB) ([]models.WeeklySchedule, error) {
+		class, err := findClassByName(tx, className)
+		if err != nil {
+			return nil, err
+		}
+		if changes, err = diffClassSchedule(tx, termID, class.ID); err != nil {
+			return nil, err
+		}
+
+		// 1. 删除草稿
+		var drafts []models.WeeklySchedule
+		if err := tx.Where("term_id = ? AND class_id = ?", termID, class.ID).Find(&drafts).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Where("term_id = ? AND class_id = ?", termID, class.ID).Delete(&models.WeeklySchedule{}).Error; err != nil {
+			return nil, err
+		}
+
+		// 2. 按已发布版本重建草稿
+		var published []models.PublishedSchedule
+		if err := tx.Where("term_id = ? AND class_id = ?", termID, class.ID).Find(&published).Error; err != nil {
+			return nil, err
+		}
+		var written []models.WeeklySchedule
+		for _, row := range published {
+			draft := models.WeeklySchedule{
+				TermID:      row.TermID,
+				ClassID:     row.ClassID,
+				CourseID:    row.CourseID,
+				WeekNumber:  row.WeekNumber,
+				TimeSlotRow: row.TimeSlotRow,
+				TimeSlotCol: row.TimeSlotCol,
+				TeacherID:   row.TeacherID,
+				RoomID:      row.RoomID,
+			}
+			if err := tx.Create(&draft).Error; err != nil {
+				return nil, err
+			}
+			written = append(written, draft)
+		}
+
+		if len(changes) > 0 {
+			if err := recordScheduleChange(tx, actor, models.ScheduleChangeDiscard, termID, class.ID, drafts, written); err != nil {
+				return nil, err
+			}
+		}
+		return written, nil
+	})
+	if err != nil {
+		return result, nil, err
+	}
+	return result, changes, nil
+}
+
+// GetPublishedScheduleByClass 根据班级名获取当前学期已发布的课程表，返回格式与草稿相同
+func GetPublishedScheduleByClass(className string, weekNumber int) ([]models.WeeklySchedule, error) {
+	termID, err := currentTermID()
+	if err != nil {
+		return nil, err
+	}
+
+	var published []models.PublishedSchedule
+	err = database.DB.Preload("Class").Preload("Course.DefaultTeacher").Preload("Teacher").Preload("Room").
+		Joins("JOIN classes ON classes.id = published_schedules.class_id").
+		Where("classes.name = ? AND published_schedules.week_number = ? AND published_schedules.term_id = ?", className, weekNumber, termID).
+		Find(&published).Error
+	if err != nil {
+		return nil, err
+	}
+
+	schedules := make([]models.WeeklySchedule, 0, len(published))
+	for _, row := range published {
+		schedule := models.WeeklySchedule{
+			TermID:      row.TermID,
+			ClassID:     row.ClassID,
+			CourseID:    row.CourseID,
+			WeekNumber:  row.WeekNumber,
+			TimeSlotRow: row.TimeSlotRow,
+			TimeSlotCol: row.TimeSlotCol,
+			TeacherID:   row.TeacherID,
+			RoomID:      row.RoomID,
+			Class:       row.Class,
+			Course:      row.Course,
+			Teacher:     row.Teacher,
+			Room:        row.Room,
+		}
+		schedule.ID = row.ID
+		schedule.CreatedAt = row.PublishedAt
+		schedule.UpdatedAt = row.PublishedAt
+		schedules = append(schedules, schedule)
+	}
+
+	// 标注节假日，与草稿一致
+	schedules, err = annotateCalendar(schedules, weekNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	return schedules, nil
+}
@@ -0,0 +1,330 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"reschedule-program/database"
+	"reschedule-program/models"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRequestNotFound    = errors.New("reschedule request not found")
+	ErrInvalidRequest     = errors.New("invalid reschedule request")
+	ErrRequestNotPending  = errors.New("reschedule request is no longer pending")
+	ErrNotApprover        = errors.New("only an admin or the class owner can review this request")
+	ErrNotRequester       = errors.New("only the requester can withdraw this request")
+	ErrRequestApplyFailed = errors.New("approved change could not be applied")
+)
+
+// RescheduleRequestData 前端传来的调课申请
+type RescheduleRequestData struct {
+	ClassName   string `json:"className"`
+	Action      string `json:"action"` // move / swap / cancel
+	WeekNumber  int    `json:"weekNumber"`
+	TimeSlotRow int    `json:"timeSlotRow"`
+	TimeSlotCol int    `json:"timeSlotCol"`
+	TargetWeek  int    `json:"targetWeek"`
+	TargetRow   int    `json:"targetRow"`
+	TargetCol   int    `json:"targetCol"`
+	Reason      string `json:"reason"`
+}
+
+// validSlot 检查时间槽是否在课程表范围内
+func validSlot(week int, row int, col int) bool {
+	return week >= 1 && row >= 0 && row < slotRows && col >= 0 && col < slotCols
+}
+
+// isAdmin 判断会话是否为管理员
+func isAdmin(session *models.Session) bool {
+	return session.UserType == "admin"
+}
+
+// canReview 判断会话能否审批班级的调课申请：管理员或班级负责人
+func canReview(session *models.Session, class models.Class) bool {
+	return isAdmin(session) || (session.UserID != "" && session.UserID == class.OwnerID)
+}
+
+// isRequester 判断会话是否为申请人
+func isRequester(session *models.Session, request *models.RescheduleRequest) bool {
+	return session.UserID == request.RequesterID && session.Username == request.RequesterName
+}
+
+// applyReschedule 在事务中执行调课申请对应的操作，返回写入的课程记录
+func applyReschedule(tx *gorm.DB, actor Actor, request *models.RescheduleRequest) ([]models.WeeklySchedule, error) {
+	className := request.Class.Name
+	switch request.Action {
+	case models.RescheduleMove:
+		return moveSchedule(tx, actor, request.TermID, className, request.WeekNumber, request.TimeSlotRow, request.TimeSlotCol,
+			request.TargetWeek, request.TargetRow, request.TargetCol)
+	case models.RescheduleSwap:
+		return swapSchedule(tx, actor, request.TermID, className, request.WeekNumber, request.TimeSlotRow, request.TimeSlotCol,
+			request.TargetWeek, request.TargetRow, request.TargetCol)
+	case models.RescheduleCancel:
+		// 取消的课程必须存在，避免批准一个已被改动的申请时静默成功
+		if _, err := findLesson(tx, request.TermID, request.ClassID, request.WeekNumber, request.TimeSlotRow, request.TimeSlotCol); err != nil {
+			return nil, err
+		}
+		return nil, deleteSchedule(tx, actor, request.TermID, className, request.WeekNumber, request.TimeSlotRow, request.TimeSlotCol)
+	}
+	return nil, ErrInvalidRequest
+}
+
+// CreateRescheduleRequest 提交调课申请，返回申请和按当前课程表预览的冲突
+func CreateRescheduleRequest(actor Actor, session *models.Session, data RescheduleRequestData) (*models.RescheduleRequest, *WriteResult, error) {
+	// 1. 校验申请内容
+	data.Reason = strings.TrimSpace(data.Reason)
+	if data.Reason == "" {
+		return nil, nil, fmt.Errorf("%w: reason is required", ErrInvalidRequest)
+	}
+	if !validSlot(data.WeekNumber, data.TimeSlotRow, data.TimeSlotCol) {
+		return nil, nil, fmt.Errorf("%w: invalid time slot", ErrInvalidRequest)
+	}
+	switch data.Action {
+	case models.RescheduleMove, models.RescheduleSwap:
+		if !validSlot(data.TargetWeek, data.TargetRow, data.TargetCol) {
+			return nil, nil, fmt.Errorf("%w: invalid target time slot", ErrInvalidRequest)
+		}
+	case models.RescheduleCancel:
+		data.TargetWeek, data.TargetRow, data.TargetCol = 0, 0, 0
+	default:
+		return nil, nil, fmt.Errorf("%w: action must be move, swap or cancel", ErrInvalidRequest)
+	}
+
+	termID, err := currentTermID()
+	if err != nil {
+		return nil, nil, err
+	}
+	class, err := findClassByName(database.DB, data.ClassName)
+	if err != nil {
+		return nil, nil, err
+	}
+	if class.Archived {
+		return nil, nil, ErrClassArchived
+	}
+
+	request := models.RescheduleRequest{
+		TermID:        termID,
+		ClassID:       class.ID,
+		Action:        data.Action,
+		WeekNumber:    data.WeekNumber,
+		TimeSlotRow:   data.TimeSlotRow,
+		TimeSlotCol:   data.TimeSlotCol,
+		TargetWeek:    data.TargetWeek,
+		TargetRow:     data.TargetRow,
+		TargetCol:     data.TargetCol,
+		Reason:        data.Reason,
+		Status:        models.RescheduleRequestPending,
+		RequesterID:   session.UserID,
+		RequesterName: session.Username,
+		Class:         class,
+	}
+
+	// 2. 按当前课程表预览，源位置无课或目标位置已被占用时不接受申请
+	preview, err := runScheduleWrite(true, func(tx *gorm.DB) ([]models.WeeklySchedule, error) {
+		return applyReschedule(tx, actor, &request)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Class").Create(&request).Error; err != nil {
+			return err
+		}
+		return RecordActivity(tx, actor, ActivityEvent{
+			Action: models.ActivityRescheduleCreate, EntityType: models.EntityRescheduleRequest, EntityID: request.ID,
+			EntityName: class.Name, ClassID: class.ID, After: request,
+		})
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &request, preview, nil
+}
+
+// GetRescheduleRequests 获取会话可见的调课申请，最新的在前：管理员可见全部，
+// 其他用户可见自己提交的和自己负责班级的申请；status 为空时不按状态筛选
+func GetRescheduleRequests(session *models.Session, status string) ([]models.RescheduleRequest, error) {
+	query := database.DB.Preload("Class").Order("id DESC")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if !isAdmin(session) {
+		owned := database.DB.Model(&models.Class{}).Select("id").Where("owner_id = ? AND owner_id <> ''", session.UserID)
+		query = query.Where("(requester_id = ? AND requester_name = ?) OR class_id IN (?)",
+			session.UserID, session.Username, owned)
+	}
+
+	var requests []models.RescheduleRequest
+	err := query.Find(&requests).Error
+	return requests, err
+}
+
+// getRescheduleRequest 按ID获取调课申请及其班级
+func getRescheduleRequest(db *gorm.DB, id uint) (*models.RescheduleRequest, error) {
+	var request models.RescheduleRequest
+	if err := db.Preload("Class").First(&request, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRequestNotFound
+		}
+		return nil, err
+	}
+	return &request, nil
+}
+
+// GetRescheduleRequest 获取单个调课申请，只有申请人和审批人可见
+func GetRescheduleRequest(session *models.Session, id uint) (*models.RescheduleRequest, error) {
+	request, err := getRescheduleRequest(database.DB, id)
+	if err != nil {
+		return nil, err
+	}
+	if !isRequester(session, request) && !canReview(session, request.Class) {
+		return nil, ErrRequestNotFound
+	}
+	return request, nil
+}
+
+// reviewRescheduleRequest 读取待审批的申请并检查审批权限
+func reviewRescheduleRequest(db *gorm.DB, session *models.Session, id uint) (*models.RescheduleRequest, error) {
+	request, err := getRescheduleRequest(db, id)
+	if err != nil {
+		return nil, err
+	}
+	if !canReview(session, request.Class) {
+		return nil, ErrNotApprover
+	}
+	if request.Status != models.RescheduleRequestPending {
+		return nil, ErrRequestNotPending
+	}
+	return request, nil
+}
+
+// reviewUpdates 审批结果需要更新的字段
+func reviewUpdates(session *models.Session, status string, comment string, outcome string) map[string]interface{} {
+	return map[string]interface{}{
+		"status":         status,
+		"reviewer_id":    session.UserID,
+		"reviewer_name":  session.Username,
+		"review_comment": comment,
+		"reviewed_at":    time.Now(),
+		"outcome":        outcome,
+	}
+}
+
+// recordReview 在审批的事务中记录活动日志，变更前后为申请的状态
+func recordReview(tx *gorm.DB, actor Actor, action string, request *models.RescheduleRequest) error {
+	var reviewed models.RescheduleRequest
+	if err := tx.First(&reviewed, request.ID).Error; err != nil {
+		return err
+	}
+	return RecordActivity(tx, actor, ActivityEvent{
+		Action: action, EntityType: models.EntityRescheduleRequest, EntityID: request.ID,
+		EntityName: request.Class.Name, ClassID: request.ClassID,
+		Before: map[string]interface{}{"status": models.RescheduleRequestPending},
+		After:  map[string]interface{}{"status": reviewed.Status, "reviewComment": reviewed.ReviewComment},
+	})
+}
+
+// ApproveRescheduleRequest 批准调课申请：在一个事务中执行调课并更新申请状态。
+// 写入失败（源位置无课、目标位置已有课程或存在冲突）时课程表不变，申请记为 failed 并返回 ErrRequestApplyFailed
+func ApproveRescheduleRequest(actor Actor, session *models.Session, id uint, comment string) (*models.RescheduleRequest, *WriteResult, error) {
+	comment = strings.TrimSpace(comment)
+	request, err := reviewRescheduleRequest(database.DB, session, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 1. 执行调课并在同一事务中标记为已批准
+	result, err := runScheduleWrite(false, func(tx *gorm.DB) ([]models.WeeklySchedule, error) {
+		written, err := applyReschedule(tx, actor, request)
+		if err != nil {
+			return nil, err
+		}
+		updates := reviewUpdates(session, models.RescheduleRequestApproved, comment, "applied")
+		// 申请可能已被其他审批人处理
+		updated := tx.Model(request).Where("status = ?", models.RescheduleRequestPending).Updates(updates)
+		if updated.Error != nil {
+			return nil, updated.Error
+		}
+		if updated.RowsAffected == 0 {
+			return nil, ErrRequestNotPending
+		}
+		if err := recordReview(tx, actor, models.ActivityRescheduleApprove, request); err != nil {
+			return nil, err
+		}
+		return written, nil
+	})
+	if errors.Is(err, ErrRequestNotPending) {
+		return nil, nil, err
+	}
+
+	// 2. 写入失败时记录失败原因
+	if err != nil {
+		outcome := err.Error()
+		if errors.Is(err, ErrScheduleConflict) {
+			var details []string
+			for _, conflict := range result.Conflicts {
+				details = append(details, conflict.String())
+			}
+			outcome += ": " + strings.Join(details, "; ")
+		}
+		updates := reviewUpdates(session, models.RescheduleRequestFailed, comment, outcome)
+		if updateErr := database.DB.Model(request).Where("status = ?", models.RescheduleRequestPending).Updates(updates).Error; updateErr != nil {
+			return nil, nil, updateErr
+		}
+		request, _ = getRescheduleRequest(database.DB, id)
+		return request, result, fmt.Errorf("%w: %v", ErrRequestApplyFailed, err)
+	}
+
+	request, err = getRescheduleRequest(database.DB, id)
+	return request, result, err
+}
+
+// RejectRescheduleRequest 驳回调课申请
+func RejectRescheduleRequest(actor Actor, session *models.Session, id uint, comment string) (*models.RescheduleRequest, error) {
+	request, err := reviewRescheduleRequest(database.DB, session, id)
+	if err != nil {
+		return nil, err
+	}
+	updates := reviewUpdates(session, models.RescheduleRequestRejected, strings.TrimSpace(comment), "rejected")
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(request).Updates(updates).Error; err != nil {
+			return err
+		}
+		return recordReview(tx, actor, models.ActivityRescheduleReject, request)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return getRescheduleRequest(database.DB, id)
+}
+
+// WithdrawRescheduleRequest 申请人撤回尚未审批的调课申请
+func WithdrawRescheduleRequest(actor Actor, session *models.Session, id uint) (*models.RescheduleRequest, error) {
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		request, err := getRescheduleRequest(tx, id)
+		if err != nil {
+			return err
+		}
+		if !isRequester(session, request) {
+			return ErrNotRequester
+		}
+		if request.Status != models.RescheduleRequestPending {
+			return ErrRequestNotPending
+		}
+		if err := tx.Model(request).Updates(map[string]interface{}{
+			"status": models.RescheduleRequestWithdrawn, "outcome": "withdrawn",
+		}).Error; err != nil {
+			return err
+		}
+		return recordReview(tx, actor, models.ActivityRescheduleWithdraw, request)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return getRescheduleRequest(database.DB, id)
+}
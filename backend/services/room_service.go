@@ -0,0 +1,226 @@
+package services
+
+import (
+	"errors"
+	"reschedule-program/database"
+	"reschedule-program/models"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRoomNotFound = errors.New("room not found")
+	ErrRoomExists   = errors.New("room name already exists")
+	ErrRoomInUse    = errors.New("room is still used by schedules")
+	ErrInvalidRoom  = errors.New("room name is required and capacity must not be negative")
+)
+
+// RoomData 前端传来的教室数据
+type RoomData struct {
+	Name     string `json:"name"`
+	Building string `json:"building"`
+	Capacity int    `json:"capacity"`
+	Features string `json:"features"`
+}
+
+// normalizeFeatures 规范化设施列表：去掉空白和空项
+func normalizeFeatures(features string) string {
+	var items []string
+	for _, item := range strings.Split(features, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return strings.Join(items, ",")
+}
+
+// validateRoomData 校验并规范化教室数据
+func validateRoomData(data *RoomData) error {
+	data.Name = strings.TrimSpace(data.Name)
+	if data.Name == "" || data.Capacity < 0 {
+		return ErrInvalidRoom
+	}
+	data.Features = normalizeFeatures(data.Features)
+	return nil
+}
+
+// roomNameTaken 检查教室名是否已被其他教室使用
+func roomNameTaken(name string, excludeID uint) (bool, error) {
+	var count int64
+	err := database.DB.Model(&models.Room{}).Unscoped().Where("name = ? AND id <> ?", name, excludeID).Count(&count).Error
+	return count > 0, err
+}
+
+// ensureRoom 检查教室是否存在，roomID 为空时视为不指定教室
+func ensureRoom(db *gorm.DB, roomID *uint) error {
+	if roomID == nil {
+		return nil
+	}
+	var count int64
+	if err := db.Model(&models.Room{}).Where("id = ?", *roomID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrRoomNotFound
+	}
+	return nil
+}
+
+// GetAllRooms 获取所有教室
+func GetAllRooms() ([]models.Room, error) {
+	var rooms []models.Room
+	err := database.DB.Order("building, name").Find(&rooms).Error
+	return rooms, err
+}
+
+// GetRoom 根据ID获取教室
+func GetRoom(id uint) (*models.Room, error) {
+	var room models.Room
+	if err := database.DB.First(&room, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRoomNotFound
+		}
+		return nil, err
+	}
+	return &room, nil
+}
+
+// CreateRoom 添加教室
+func CreateRoom(actor Actor, data RoomData) (*models.Room, error) {
+	if err := validateRoomData(&data); err != nil {
+		return nil, err
+	}
+
+	taken, err := roomNameTaken(data.Name, 0)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, ErrRoomExists
+	}
+
+	room := models.Room{
+		Name:     data.Name,
+		Building: data.Building,
+		Capacity: data.Capacity,
+		Features: data.Features,
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&room).Error; err != nil {
+			return err
+		}
+		return RecordActivity(tx, actor, ActivityEvent{
+			Action: models.ActivityRoomCreate, EntityType: models.EntityRoom, EntityID: room.ID, EntityName: room.Name,
+			After: room,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &room, nil
+}
+
+// UpdateRoom 更新教室信息
+func UpdateRoom(actor Actor, id uint, data RoomData) (*models.Room, error) {
+	if err := validateRoomData(&data); err != nil {
+		return nil, err
+	}
+
+	room, err := GetRoom(id)
+	if err != nil {
+		return nil, err
+	}
+
+	taken, err := roomNameTaken(data.Name, id)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, ErrRoomExists
+	}
+
+	before := *room
+	room.Name = data.Name
+	room.Building = data.Building
+	room.Capacity = data.Capacity
+	room.Features = data.Features
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(room).Error; err != nil {
+			return err
+		}
+		return RecordActivity(tx, actor, ActivityEvent{
+			Action: models.ActivityRoomUpdate, EntityType: models.EntityRoom, EntityID: room.ID, EntityName: room.Name,
+			Before: before, After: room,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return room, nil
+}
+
+// DeleteRoom 删除教室，仍被课程记录使用时拒绝删除
+func DeleteRoom(actor Actor, id uint) (*models.Room, error) {
+	var room models.Room
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&room, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRoomNotFound
+			}
+			return err
+		}
+
+		var count, published int64
+		if err := tx.Model(&models.WeeklySchedule{}).Where("room_id = ?", id).Count(&count).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.PublishedSchedule{}).Where("room_id = ?", id).Count(&published).Error; err != nil {
+			return err
+		}
+		if count > 0 || published > 0 {
+			return ErrRoomInUse
+		}
+
+		// 硬删除，释放教室名的唯一索引
+		if err := tx.Unscoped().Delete(&room).Error; err != nil {
+			return err
+		}
+		return RecordActivity(tx, actor, ActivityEvent{
+			Action: models.ActivityRoomDelete, EntityType: models.EntityRoom, EntityID: room.ID, EntityName: room.Name,
+			Before: room,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &room, nil
+}
+
+// GetScheduleByRoom 获取教室在当前学期某一周的占用情况
+func GetScheduleByRoom(roomID uint, weekNumber int) ([]models.WeeklySchedule, error) {
+	if _, err := GetRoom(roomID); err != nil {
+		return nil, err
+	}
+
+	termID, err := currentTermID()
+	if err != nil {
+		return nil, err
+	}
+
+	var schedules []models.WeeklySchedule
+	err = database.DB.Preload("Class").Preload("Course.DefaultTeacher").Preload("Teacher").Preload("Room").
+		Scopes(roomScheduleScope(roomID)).
+		Where("weekly_schedules.term_id = ? AND weekly_schedules.week_number = ?", termID, weekNumber).
+		Order("weekly_schedules.time_slot_col, weekly_schedules.time_slot_row").
+		Find(&schedules).Error
+	if err != nil {
+		return nil, err
+	}
+
+	schedules, err = annotateCalendar(schedules, weekNumber)
+	if err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
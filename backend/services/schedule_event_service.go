@@ -0,0 +1,239 @@
+package services
+
+import (
+	"encoding/json"
+	"log"
+	"reschedule-program/database"
+	"reschedule-program/models"
+	"sync"
+	"time"
+)
+
+// 课程表事件类型
+const (
+	ScheduleEventCellCreated = "cell.created" // 在一个时间槽新增课程
+	ScheduleEventCellDeleted = "cell.deleted" // 删除一个时间槽的课程
+	ScheduleEventCellMoved   = "cell.moved"   // 移动或交换课程
+	ScheduleEventCellUpdated = "cell.updated" // 修改一个时间槽课程的教师、教室或课程
+	ScheduleEventClassSaved  = "class.saved"  // 一次写入多个时间槽，如保存课程表、导入、撤销、恢复历史版本
+	ScheduleEventReady       = "ready"        // 订阅开始，ID 为当前最新的变更
+	ScheduleEventReset       = "reset"        // 断开期间的变更过多或变更历史已被替换，需要重新加载课程表
+)
+
+const (
+	scheduleEventBuffer    = 64  // 每个订阅缓存的事件数，消费过慢时断开，客户端重连后从数据库补发
+	maxScheduleEventReplay = 500 // 重连时最多补发的事件数，超过时发送 reset
+)
+
+// ScheduleEvent 课程表变更事件，ID 为变更历史的ID，Before/After 为涉及位置变更前后的课程
+type ScheduleEvent struct {
+	ID        uint             `json:"id"`
+	Type      string           `json:"type"`
+	Action    string           `json:"action,omitempty"` // 变更类型，见 models.ScheduleChange
+	TermID    uint             `json:"termId"`
+	ClassID   uint             `json:"classId"`
+	ClassName string           `json:"className"`
+	CreatedAt time.Time        `json:"createdAt"`
+	Before    []LessonSnapshot `json:"before,omitempty"`
+	After     []LessonSnapshot `json:"after,omitempty"`
+}
+
+// ScheduleSubscription 一个班级的事件订阅，Events 被关闭时订阅已断开
+type ScheduleSubscription struct {
+	ClassID uint
+	Events  chan ScheduleEvent
+	closed  bool
+}
+
+// scheduleEventHub 将提交后的变更历史分发给订阅者。变更历史只追加，且 SQLite 的写事务依次提交，
+// 按ID读取上次之后的记录即可得到新提交的变更
+type scheduleEventHub struct {
+	mu          sync.Mutex
+	lastID      uint
+	subscribers map[*ScheduleSubscription]bool
+}
+
+var scheduleEvents = &scheduleEventHub{subscribers: map[*ScheduleSubscription]bool{}}
+
+// scheduleEventType 由变更类型和涉及的时间槽得到事件类型
+func scheduleEventType(action string, before []LessonSnapshot, after []LessonSnapshot) string {
+	if action == models.ScheduleChangeMove || action == models.ScheduleChangeSwap {
+		return ScheduleEventCellMoved
+	}
+	slots := map[[2]int]bool{}
+	for _, lesson := range append(append([]LessonSnapshot{}, before...), after...) {
+		slots[[2]int{lesson.TimeSlotRow, lesson.TimeSlotCol}] = true
+	}
+	if len(slots) == 1 {
+		switch action {
+		case models.ScheduleChangeInsert:
+			return ScheduleEventCellCreated
+		case models.ScheduleChangeDelete:
+			return ScheduleEventCellDeleted
+		case models.ScheduleChangeUpdate:
+			return ScheduleEventCellUpdated
+		}
+	}
+	return ScheduleEventClassSaved
+}
+
+// scheduleEventsFrom 将变更历史转换为事件
+func scheduleEventsFrom(changes []models.ScheduleChange) ([]ScheduleEvent, error) {
+	names := map[uint]string{}
+	events := make([]ScheduleEvent, 0, len(changes))
+	for _, change := range changes {
+		if _, ok := names[change.ClassID]; !ok {
+			var class models.Class
+			if err := database.DB.Unscoped().Select("name").Limit(1).Find(&class, change.ClassID).Error; err != nil {
+				return nil, err
+			}
+			names[change.ClassID] = class.Name
+		}
+
+		event := ScheduleEvent{
+			ID:        change.ID,
+			Action:    change.Action,
+			TermID:    change.TermID,
+			ClassID:   change.ClassID,
+			ClassName: names[change.ClassID],
+			CreatedAt: change.CreatedAt,
+		}
+		if err := json.Unmarshal([]byte(change.Before), &event.Before); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(change.After), &event.After); err != nil {
+			return nil, err
+		}
+		event.Type = scheduleEventType(change.Action, event.Before, event.After)
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// latestScheduleChangeID 最新的变更历史ID
+func latestScheduleChangeID() (uint, error) {
+	var id uint
+	err := database.DB.Model(&models.ScheduleChange{}).Select("COALESCE(MAX(id), 0)").Scan(&id).Error
+	return id, err
+}
+
+// StartScheduleEvents 服务启动时记录当前最新的变更，此后提交的变更才作为事件发布
+func StartScheduleEvents() {
+	if err := resetScheduleEvents(); err != nil {
+		log.Println("Failed to start schedule events:", err)
+	}
+}
+
+// resetScheduleEvents 将已发布位置设为当前最新的变更，不发布之前的变更（如恢复备份后）
+func resetScheduleEvents() error {
+	id, err := latestScheduleChangeID()
+	if err != nil {
+		return err
+	}
+	scheduleEvents.mu.Lock()
+	defer scheduleEvents.mu.Unlock()
+	scheduleEvents.lastID = id
+	return nil
+}
+
+// publishScheduleEvents 在写事务提交后调用，将上次发布之后提交的变更发送给订阅了对应班级的订阅者。
+// 订阅者的缓存已满时断开该订阅，客户端按最后收到的事件ID重连即可补齐
+func publishScheduleEvents() {
+	hub := scheduleEvents
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	var changes []models.ScheduleChange
+	if err := database.DB.Where("id > ?", hub.lastID).Order("id").Find(&changes).Error; err != nil {
+		log.Println("Failed to load schedule changes for events:", err)
+		return
+	}
+	if len(changes) == 0 {
+		return
+	}
+	hub.lastID = changes[len(changes)-1].ID
+	if len(hub.subscribers) == 0 {
+		return
+	}
+
+	events, err := scheduleEventsFrom(changes)
+	if err != nil {
+		log.Println("Failed to build schedule events:", err)
+		return
+	}
+	for _, event := range events {
+		for subscription := range hub.subscribers {
+			if subscription.ClassID != event.ClassID {
+				continue
+			}
+			select {
+			case subscription.Events <- event:
+			default:
+				hub.remove(subscription)
+			}
+		}
+	}
+}
+
+// remove 移除并关闭订阅，调用时须持有锁
+func (hub *scheduleEventHub) remove(subscription *ScheduleSubscription) {
+	if subscription.closed {
+		return
+	}
+	subscription.closed = true
+	delete(hub.subscribers, subscription)
+	close(subscription.Events)
+}
+
+// SubscribeScheduleEvents 订阅班级的课程表变更事件。lastEventID 不为 0 时先返回该ID之后的变更用于补发，
+// 否则返回一个 ready 事件，其ID可作为之后重连的起点；补发过多时返回一个 reset 事件
+func SubscribeScheduleEvents(className string, lastEventID uint) (*ScheduleSubscription, []ScheduleEvent, error) {
+	class, err := findClassByName(database.DB, className)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 1. 先登记订阅，再补发登记时已发布的变更，两者之间没有遗漏也没有重复
+	subscription := &ScheduleSubscription{ClassID: class.ID, Events: make(chan ScheduleEvent, scheduleEventBuffer)}
+	hub := scheduleEvents
+	hub.mu.Lock()
+	hub.subscribers[subscription] = true
+	upTo := hub.lastID
+	hub.mu.Unlock()
+
+	marker := func(eventType string) []ScheduleEvent {
+		return []ScheduleEvent{{ID: upTo, Type: eventType, ClassID: class.ID, ClassName: class.Name, CreatedAt: time.Now()}}
+	}
+	if lastEventID == 0 || lastEventID == upTo {
+		return subscription, marker(ScheduleEventReady), nil
+	}
+	if lastEventID > upTo {
+		// 变更历史已被替换（如恢复备份），旧的事件ID没有意义
+		return subscription, marker(ScheduleEventReset), nil
+	}
+
+	// 2. 补发断开期间的变更
+	var changes []models.ScheduleChange
+	err = database.DB.Where("class_id = ? AND id > ? AND id <= ?", class.ID, lastEventID, upTo).
+		Order("id").Limit(maxScheduleEventReplay + 1).Find(&changes).Error
+	if err != nil {
+		subscription.Close()
+		return nil, nil, err
+	}
+	if len(changes) > maxScheduleEventReplay {
+		return subscription, marker(ScheduleEventReset), nil
+	}
+	events, err := scheduleEventsFrom(changes)
+	if err != nil {
+		subscription.Close()
+		return nil, nil, err
+	}
+	return subscription, events, nil
+}
+
+// Close 取消订阅
+func (subscription *ScheduleSubscription) Close() {
+	scheduleEvents.mu.Lock()
+	defer scheduleEvents.mu.Unlock()
+	scheduleEvents.remove(subscription)
+}
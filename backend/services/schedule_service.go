@@ -1,14 +1,31 @@
 package services
 
 import (
+	"errors"
+	"fmt"
 	"reschedule-program/database"
 	"reschedule-program/models"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrClassNotFound  = errors.New("class not found")
+	ErrUnknownCourse  = errors.New("unknown course")
+	ErrLessonNotFound = errors.New("no lesson in the given time slot")
+	ErrSlotOccupied   = errors.New("target time slot is occupied")
 )
 
 // ScheduleData 前端传来的课程表数据
 type ScheduleData struct {
 	ClassName string                    `json:"className"`
+	TermID    uint                      `json:"termId"` // 为 0 时保存到当前学期
 	Schedule  [][]*CourseAssignmentData `json:"schedule"`
+
+	// RejectUnknownCourses 为 true 时课程名必须已在课程目录中，否则整个保存失败
+	RejectUnknownCourses bool `json:"rejectUnknownCourses"`
 }
 
 // CourseAssignmentData 课程分配数据
@@ -18,19 +35,121 @@ type CourseAssignmentData struct {
 	StartWeek     int    `json:"startWeek"`
 	EndWeek       int    `json:"endWeek"`
 	SelectedWeeks []int  `json:"selectedWeeks"`
+	TeacherID     *uint  `json:"teacherId"` // 单独指定任课教师，为空时使用课程默认教师
+	RoomID        *uint  `json:"roomId"`    // 上课教室
 }
 
-// SaveSchedule 保存课程表数据
-func SaveSchedule(data ScheduleData) error {
-	// 1. 创建或获取班级
+// currentTermID 返回当前学期ID，没有设置学期时返回 0
+func currentTermID() (uint, error) {
+	term, err := GetActiveTerm()
+	if errors.Is(err, ErrNoActiveTerm) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return term.ID, nil
+}
+
+// findOrCreateClass 按名称获取班级，不存在时创建；已归档的班级不允许写入
+func findOrCreateClass(db *gorm.DB, name string) (models.Class, error) {
 	var class models.Class
-	result := database.DB.Where("name = ?", data.ClassName).First(&class)
-	if result.Error != nil {
+	// 按规范化后的班级名查找，与创建时一致
+	name, err := normalizeClassName(name)
+	if err != nil {
+		return class, err
+	}
+	if err := db.Where("name = ?", name).First(&class).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return class, err
+		}
 		// 班级不存在，创建新班级
-		class = models.Class{Name: data.ClassName}
-		if err := database.DB.Create(&class).Error; err != nil {
-			return err
+		class = models.Class{Name: name}
+		if err := db.Create(&class).Error; err != nil {
+			return class, err
+		}
+	}
+	if class.Archived {
+		return class, ErrClassArchived
+	}
+	return class, nil
+}
+
+// findCourse 按课程代码或名称（不区分大小写）查找课程目录中的课程
+func findCourse(db *gorm.DB, name string) (models.Course, error) {
+	var course models.Course
+	name = strings.TrimSpace(name)
+	err := db.Where("code = ? OR LOWER(name) = LOWER(?)", name, name).Order("id").First(&course).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return course, fmt.Errorf("%w: %s", ErrUnknownCourse, name)
+	}
+	return course, err
+}
+
+// findOrCreateCourse 按名称获取课程，不存在时创建
+func findOrCreateCourse(db *gorm.DB, name string) (models.Course, error) {
+	course, err := findCourse(db, name)
+	if errors.Is(err, ErrUnknownCourse) {
+		// 课程不存在，创建新课程
+		course = models.Course{Name: strings.TrimSpace(name)}
+		err = db.Create(&course).Error
+	}
+	return course, err
+}
+
+// findClassByName 按名称获取班级
+func findClassByName(db *gorm.DB, name string) (models.Class, error) {
+	var class models.Class
+	if err := db.Where("name = ?", name).First(&class).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return class, ErrClassNotFound
 		}
+		return class, err
+	}
+	return class, nil
+}
+
+// findLesson 获取班级在指定时间槽的课程记录
+func findLesson(db *gorm.DB, termID uint, classID uint, weekNumber int, timeSlotRow int, timeSlotCol int) (models.WeeklySchedule, error) {
+	var lesson models.WeeklySchedule
+	err := db.Where("term_id = ? AND class_id = ? AND week_number = ? AND time_slot_row = ? AND time_slot_col = ?",
+		termID, classID, weekNumber, timeSlotRow, timeSlotCol).First(&lesson).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return lesson, ErrLessonNotFound
+	}
+	return lesson, err
+}
+
+// SaveSchedule 保存课程表数据，存在教师或教室冲突时不写入并返回冲突列表；dryRun 为 true 时只检查冲突
+func SaveSchedule(actor Actor, data ScheduleData, dryRun bool) (*WriteResult, error) {
+	termID := data.TermID
+	if termID == 0 {
+		var err error
+		if termID, err = currentTermID(); err != nil {
+			return nil, err
+		}
+	}
+
+	return runScheduleWrite(dryRun, func(tx *gorm.DB) ([]models.WeeklySchedule, error) {
+		written, err := saveSchedule(tx, termID, data)
+		if err != nil {
+			return nil, err
+		}
+		if len(written) > 0 {
+			err = recordScheduleChange(tx, actor, models.ScheduleChangeInsert, termID, written[0].ClassID, nil, written)
+		}
+		return written, err
+	})
+}
+
+// saveSchedule 在事务中写入课程表数据，返回写入的课程记录
+func saveSchedule(tx *gorm.DB, termID uint, data ScheduleData) ([]models.WeeklySchedule, error) {
+	var written []models.WeeklySchedule
+
+	// 1. 创建或获取班级
+	class, err := findOrCreateClass(tx, data.ClassName)
+	if err != nil {
+		return nil, err
 	}
 
 	// 2. 处理课程表数据
@@ -41,15 +160,21 @@ func SaveSchedule(data ScheduleData) error {
 				continue
 			}
 
-			// 3. 创建或获取课程
+			// 3. 获取课程，课程目录中没有时按设置创建或拒绝
 			var course models.Course
-			result := database.DB.Where("name = ?", courseData.Name).First(&course)
-			if result.Error != nil {
-				// 课程不存在，创建新课程
-				course = models.Course{Name: courseData.Name}
-				if err := database.DB.Create(&course).Error; err != nil {
-					return err
-				}
+			if data.RejectUnknownCourses {
+				course, err = findCourse(tx, courseData.Name)
+			} else {
+				course, err = findOrCreateCourse(tx, courseData.Name)
+			}
+			if err != nil {
+				return nil, err
+			}
+			if err := ensureTeacher(tx, courseData.TeacherID); err != nil {
+				return nil, err
+			}
+			if err := ensureRoom(tx, courseData.RoomID); err != nil {
+				return nil, err
 			}
 
 			// 4. 生成周记录
@@ -67,101 +192,297 @@ func SaveSchedule(data ScheduleData) error {
 			// 5. 为每一周创建记录
 			for _, week := range weeks {
 				weeklySchedule := models.WeeklySchedule{
+					TermID:      termID,
 					ClassID:     class.ID,
 					CourseID:    course.ID,
 					WeekNumber:  week,
 					TimeSlotRow: row,
 					TimeSlotCol: col,
+					TeacherID:   courseData.TeacherID,
+					RoomID:      courseData.RoomID,
 				}
 
-				if err := database.DB.Create(&weeklySchedule).Error; err != nil {
-					return err
+				if err := tx.Create(&weeklySchedule).Error; err != nil {
+					return nil, err
 				}
+				written = append(written, weeklySchedule)
 			}
 		}
 	}
 
-	return nil
+	return written, nil
 }
 
-// GetScheduleByClass 根据班级名获取课程表
+// GetScheduleByClass 根据班级名获取当前学期的课程表
 func GetScheduleByClass(className string, weekNumber int) ([]models.WeeklySchedule, error) {
 	var schedules []models.WeeklySchedule
 
-	err := database.DB.Preload("Class").Preload("Course").
+	termID, err := currentTermID()
+	if err != nil {
+		return nil, err
+	}
+
+	err = database.DB.Preload("Class").Preload("Course.DefaultTeacher").Preload("Teacher").Preload("Room").
 		Joins("JOIN classes ON classes.id = weekly_schedules.class_id").
-		Where("classes.name = ? AND weekly_schedules.week_number = ?", className, weekNumber).
+		Where("classes.name = ? AND weekly_schedules.week_number = ? AND weekly_schedules.term_id = ?", className, weekNumber, termID).
 		Find(&schedules).Error
+	if err != nil {
+		return nil, err
+	}
 
-	return schedules, err
+	// 标注节假日，节假日的课程仍然返回，由前端提示需要调课
+	schedules, err = annotateCalendar(schedules, weekNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	return schedules, nil
 }
 
-// GetAllClasses 获取所有班级
+// GetAllClasses 获取所有未归档的班级
 func GetAllClasses() ([]models.Class, error) {
 	var classes []models.Class
-	err := database.DB.Find(&classes).Error
+	err := database.DB.Where("archived = ?", false).Find(&classes).Error
 	return classes, err
 }
 
 // DeleteSchedule 删除指定时间槽的课程
-func DeleteSchedule(className string, weekNumber int, timeSlotRow int, timeSlotCol int) error {
+func DeleteSchedule(actor Actor, className string, weekNumber int, timeSlotRow int, timeSlotCol int) error {
+	termID, err := currentTermID()
+	if err != nil {
+		return err
+	}
+	// 用户直接发起的删除、移动和交换记入其撤销日志，审批、恢复等间接操作不记入
+	actor.journal = true
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		return deleteSchedule(tx, actor, termID, className, weekNumber, timeSlotRow, timeSlotCol)
+	})
+	if err == nil {
+		publishScheduleEvents()
+	}
+	return err
+}
+
+// deleteSchedule 在事务中删除指定学期班级时间槽的课程记录
+func deleteSchedule(tx *gorm.DB, actor Actor, termID uint, className string, weekNumber int, timeSlotRow int, timeSlotCol int) error {
 	// 1. 获取班级ID
 	var class models.Class
-	if err := database.DB.Where("name = ?", className).First(&class).Error; err != nil {
+	if err := tx.Where("name = ?", className).First(&class).Error; err != nil {
 		return err
 	}
 
 	// 2. 删除指定时间槽的课程记录
-	result := database.DB.Where("class_id = ? AND week_number = ? AND time_slot_row = ? AND time_slot_col = ?",
-		class.ID, weekNumber, timeSlotRow, timeSlotCol).Delete(&models.WeeklySchedule{})
+	var lessons []models.WeeklySchedule
+	if err := tx.Where("term_id = ? AND class_id = ? AND week_number = ? AND time_slot_row = ? AND time_slot_col = ?",
+		termID, class.ID, weekNumber, timeSlotRow, timeSlotCol).Find(&lessons).Error; err != nil {
+		return err
+	}
+	if len(lessons) == 0 {
+		return nil
+	}
+	if err := tx.Delete(&lessons).Error; err != nil {
+		return err
+	}
+
+	return recordScheduleChange(tx, actor, models.ScheduleChangeDelete, termID, class.ID, lessons, nil)
+}
+
+// SetScheduleTeacher 为指定时间槽的课程单独指定任课教师，teacherID 为空时恢复使用课程默认教师
+func SetScheduleTeacher(actor Actor, className string, weekNumber int, timeSlotRow int, timeSlotCol int, teacherID *uint, dryRun bool) (*WriteResult, error) {
+	return assignLessonResource(actor, className, weekNumber, timeSlotRow, timeSlotCol, "teacher_id", teacherID, ensureTeacher, dryRun)
+}
+
+// SetScheduleRoom 为指定时间槽的课程安排教室，roomID 为空时取消教室安排
+func SetScheduleRoom(actor Actor, className string, weekNumber int, timeSlotRow int, timeSlotCol int, roomID *uint, dryRun bool) (*WriteResult, error) {
+	return assignLessonResource(actor, className, weekNumber, timeSlotRow, timeSlotCol, "room_id", roomID, ensureRoom, dryRun)
+}
+
+// assignLessonResource 更新指定时间槽课程的教师或教室字段，并检查冲突
+func assignLessonResource(actor Actor, className string, weekNumber int, timeSlotRow int, timeSlotCol int, column string, resourceID *uint,
+	ensure func(*gorm.DB, *uint) error, dryRun bool) (*WriteResult, error) {
+	termID, err := currentTermID()
+	if err != nil {
+		return nil, err
+	}
+
+	return runScheduleWrite(dryRun, func(tx *gorm.DB) ([]models.WeeklySchedule, error) {
+		// 1. 获取班级ID
+		class, err := findClassByName(tx, className)
+		if err != nil {
+			return nil, err
+		}
 
-	if result.Error != nil {
-		return result.Error
+		if err := ensure(tx, resourceID); err != nil {
+			return nil, err
+		}
+
+		// 2. 更新指定时间槽的课程记录
+		lesson, err := findLesson(tx, termID, class.ID, weekNumber, timeSlotRow, timeSlotCol)
+		if err != nil {
+			return nil, err
+		}
+		before := lesson
+		if err := tx.Model(&lesson).Update(column, resourceID).Error; err != nil {
+			return nil, err
+		}
+		if column == "teacher_id" {
+			lesson.TeacherID = resourceID
+		} else {
+			lesson.RoomID = resourceID
+		}
+
+		if err := recordScheduleChange(tx, actor, models.ScheduleChangeUpdate, termID, class.ID,
+			[]models.WeeklySchedule{before}, []models.WeeklySchedule{lesson}); err != nil {
+			return nil, err
+		}
+		return []models.WeeklySchedule{lesson}, nil
+	})
+}
+
+// MoveSchedule 移动课程从源位置到目标位置（支持跨周），dryRun 为 true 时只检查冲突
+func MoveSchedule(actor Actor, className string, sourceWeek int, sourceRow int, sourceCol int, targetWeek int, targetRow int, targetCol int, dryRun bool) (*WriteResult, error) {
+	termID, err := currentTermID()
+	if err != nil {
+		return nil, err
 	}
+	actor.journal = true // 记入撤销日志
 
-	return nil
+	return runScheduleWrite(dryRun, func(tx *gorm.DB) ([]models.WeeklySchedule, error) {
+		return moveSchedule(tx, actor, termID, className, sourceWeek, sourceRow, sourceCol, targetWeek, targetRow, targetCol)
+	})
 }
 
-// MoveSchedule 移动课程从源位置到目标位置（支持跨周）
-func MoveSchedule(className string, sourceWeek int, sourceRow int, sourceCol int, targetWeek int, targetRow int, targetCol int) error {
+// moveSchedule 在事务中移动课程，返回写入的课程记录
+func moveSchedule(tx *gorm.DB, actor Actor, termID uint, className string, sourceWeek int, sourceRow int, sourceCol int, targetWeek int, targetRow int, targetCol int) ([]models.WeeklySchedule, error) {
 	// 1. 获取班级ID
-	var class models.Class
-	if err := database.DB.Where("name = ?", className).First(&class).Error; err != nil {
-		return err
+	class, err := findClassByName(tx, className)
+	if err != nil {
+		return nil, err
 	}
 
 	// 2. 检查源位置是否有课程
-	var sourceSchedule models.WeeklySchedule
-	if err := database.DB.Where("class_id = ? AND week_number = ? AND time_slot_row = ? AND time_slot_col = ?",
-		class.ID, sourceWeek, sourceRow, sourceCol).First(&sourceSchedule).Error; err != nil {
-		return err
+	sourceSchedule, err := findLesson(tx, termID, class.ID, sourceWeek, sourceRow, sourceCol)
+	if err != nil {
+		return nil, err
 	}
 
 	// 3. 检查目标位置是否为空
-	var targetSchedule models.WeeklySchedule
-	if err := database.DB.Where("class_id = ? AND week_number = ? AND time_slot_row = ? AND time_slot_col = ?",
-		class.ID, targetWeek, targetRow, targetCol).First(&targetSchedule).Error; err == nil {
+	_, err = findLesson(tx, termID, class.ID, targetWeek, targetRow, targetCol)
+	if err == nil {
 		// 目标位置已有课程，返回错误
-		return err
+		return nil, ErrSlotOccupied
+	}
+	if !errors.Is(err, ErrLessonNotFound) {
+		return nil, err
 	}
 
 	// 4. 创建新的目标记录
-	targetSchedule = models.WeeklySchedule{
+	targetSchedule := models.WeeklySchedule{
+		TermID:      sourceSchedule.TermID,
 		ClassID:     sourceSchedule.ClassID,
 		CourseID:    sourceSchedule.CourseID,
 		WeekNumber:  targetWeek,
 		TimeSlotRow: targetRow,
 		TimeSlotCol: targetCol,
+		TeacherID:   sourceSchedule.TeacherID,
+		RoomID:      sourceSchedule.RoomID,
 	}
 
-	if err := database.DB.Create(&targetSchedule).Error; err != nil {
-		return err
+	if err := tx.Create(&targetSchedule).Error; err != nil {
+		return nil, err
 	}
 
 	// 5. 删除源记录
-	if err := database.DB.Delete(&sourceSchedule).Error; err != nil {
+	if err := tx.Delete(&sourceSchedule).Error; err != nil {
+		return nil, err
+	}
+
+	// 6. 已发布的课程一并移动，订阅在下一次拉取时反映移动
+	if err := movePublishedLesson(tx, termID, class.ID, sourceSchedule.CourseID,
+		slotKey{sourceWeek, sourceRow, sourceCol}, slotKey{targetWeek, targetRow, targetCol}); err != nil {
+		return nil, err
+	}
+
+	if err := recordScheduleChange(tx, actor, models.ScheduleChangeMove, termID, class.ID,
+		[]models.WeeklySchedule{sourceSchedule}, []models.WeeklySchedule{targetSchedule}); err != nil {
+		return nil, err
+	}
+	return []models.WeeklySchedule{targetSchedule}, nil
+}
+
+// movePublishedLesson 已发布的课程表在源位置有同一门课且目标位置为空时，将这节课移到目标位置；
+// 课程尚未发布或已发布版本的目标位置有课时不处理，发布时再同步
+func movePublishedLesson(tx *gorm.DB, termID uint, classID uint, courseID uint, source slotKey, target slotKey) error {
+	var published models.PublishedSchedule
+	err := tx.Where("term_id = ? AND class_id = ? AND course_id = ? AND week_number = ? AND time_slot_row = ? AND time_slot_col = ?",
+		termID, classID, courseID, source.Week, source.Row, source.Col).Limit(1).Find(&published).Error
+	if err != nil || published.ID == 0 {
+		return err
+	}
+
+	var occupied int64
+	err = tx.Model(&models.PublishedSchedule{}).
+		Where("term_id = ? AND class_id = ? AND week_number = ? AND time_slot_row = ? AND time_slot_col = ?",
+			termID, classID, target.Week, target.Row, target.Col).Count(&occupied).Error
+	if err != nil || occupied > 0 {
 		return err
 	}
 
-	return nil
+	return tx.Model(&published).Updates(map[string]interface{}{
+		"week_number": target.Week, "time_slot_row": target.Row, "time_slot_col": target.Col, "published_at": time.Now(),
+	}).Error
+}
+
+// SwapSchedule 交换班级两个时间槽的课程（支持跨周），dryRun 为 true 时只检查冲突
+func SwapSchedule(actor Actor, className string, firstWeek int, firstRow int, firstCol int, secondWeek int, secondRow int, secondCol int, dryRun bool) (*WriteResult, error) {
+	termID, err := currentTermID()
+	if err != nil {
+		return nil, err
+	}
+	actor.journal = true // 记入撤销日志
+
+	return runScheduleWrite(dryRun, func(tx *gorm.DB) ([]models.WeeklySchedule, error) {
+		return swapSchedule(tx, actor, termID, className, firstWeek, firstRow, firstCol, secondWeek, secondRow, secondCol)
+	})
+}
+
+// swapSchedule 在事务中交换两个时间槽的课程，返回写入的课程记录
+func swapSchedule(tx *gorm.DB, actor Actor, termID uint, className string, firstWeek int, firstRow int, firstCol int, secondWeek int, secondRow int, secondCol int) ([]models.WeeklySchedule, error) {
+	// 1. 获取班级ID
+	class, err := findClassByName(tx, className)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. 两个位置都必须有课程
+	first, err := findLesson(tx, termID, class.ID, firstWeek, firstRow, firstCol)
+	if err != nil {
+		return nil, err
+	}
+	second, err := findLesson(tx, termID, class.ID, secondWeek, secondRow, secondCol)
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. 交换两条记录的位置
+	before := []models.WeeklySchedule{first, second}
+	if err := tx.Model(&first).Updates(map[string]interface{}{
+		"week_number": secondWeek, "time_slot_row": secondRow, "time_slot_col": secondCol,
+	}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Model(&second).Updates(map[string]interface{}{
+		"week_number": firstWeek, "time_slot_row": firstRow, "time_slot_col": firstCol,
+	}).Error; err != nil {
+		return nil, err
+	}
+	first.WeekNumber, first.TimeSlotRow, first.TimeSlotCol = secondWeek, secondRow, secondCol
+	second.WeekNumber, second.TimeSlotRow, second.TimeSlotCol = firstWeek, firstRow, firstCol
+
+	if err := recordScheduleChange(tx, actor, models.ScheduleChangeSwap, termID, class.ID,
+		before, []models.WeeklySchedule{first, second}); err != nil {
+		return nil, err
+	}
+	return []models.WeeklySchedule{first, second}, nil
 }
@@ -0,0 +1,34 @@
+package services
+
+import (
+	"reschedule-program/database"
+	"reschedule-program/models"
+	"testing"
+)
+
+// lessonData 第 week 周的一节课
+func lessonData(name string, week int) *CourseAssignmentData {
+	return &CourseAssignmentData{Name: name, WeekType: "continuous", StartWeek: week, EndWeek: week}
+}
+
+func TestSaveScheduleMatchesClassNameWithSurroundingSpaces(t *testing.T) {
+	setupTestDB(t)
+
+	for week, className := range []string{"C1", "  C1 "} {
+		data := ScheduleData{ClassName: className, Schedule: [][]*CourseAssignmentData{{lessonData("数学", week+1)}}}
+		if _, err := SaveSchedule(Actor{}, data, false); err != nil {
+			t.Fatalf("SaveSchedule(%q): %v", className, err)
+		}
+	}
+
+	var classes []models.Class
+	if err := database.DB.Find(&classes).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(classes) != 1 || classes[0].Name != "C1" {
+		t.Fatalf("classes = %+v, want only C1", classes)
+	}
+	if count := countRows(t, &models.WeeklySchedule{}, "class_id = ?", classes[0].ID); count != 2 {
+		t.Errorf("C1 has %d lessons, want 2", count)
+	}
+}
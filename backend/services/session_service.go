@@ -0,0 +1,55 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"reschedule-program/database"
+	"reschedule-program/models"
+	"time"
+)
+
+// sessionTTL 会话有效期
+const sessionTTL = 7 * 24 * time.Hour
+
+var ErrSessionInvalid = errors.New("session is invalid or expired")
+
+type SessionService struct{}
+
+func NewSessionService() *SessionService {
+	return &SessionService{}
+}
+
+// CreateSession 为登录用户创建会话并返回令牌
+func (s *SessionService) CreateSession(userID, username, userType string) (*models.Session, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+
+	session := models.Session{
+		Token:     hex.EncodeToString(buf),
+		UserID:    userID,
+		Username:  username,
+		UserType:  userType,
+		ExpiresAt: time.Now().Add(sessionTTL),
+	}
+	if err := database.DB.Create(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// GetSession 根据令牌获取未过期的会话
+func (s *SessionService) GetSession(token string) (*models.Session, error) {
+	var session models.Session
+	if err := database.DB.Where("token = ? AND expires_at > ?", token, time.Now()).First(&session).Error; err != nil {
+		return nil, ErrSessionInvalid
+	}
+	return &session, nil
+}
+
+// DeleteSession 注销会话
+func (s *SessionService) DeleteSession(token string) error {
+	return database.DB.Where("token = ?", token).Delete(&models.Session{}).Error
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"errors"
+	"reschedule-program/database"
+	"reschedule-program/models"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTeacherNotFound = errors.New("teacher not found")
+	ErrTeacherInUse    = errors.New("teacher is still assigned to courses or schedules")
+	ErrInvalidTeacher  = errors.New("teacher name is required")
+)
+
+// TeacherData 前端传来的教师数据
+type TeacherData struct {
+	Name   string `json:"name"`
+	Email  string `json:"email"`
+	Phone  string `json:"phone"`
+	UserID string `json:"userID"`
+}
+
+// ensureTeacher 检查教师是否存在，teacherID 为空时视为不指定教师
+func ensureTeacher(db *gorm.DB, teacherID *uint) error {
+	if teacherID == nil {
+		return nil
+	}
+	var count int64
+	if err := db.Model(&models.Teacher{}).Where("id = ?", *teacherID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrTeacherNotFound
+	}
+	return nil
+}
+
+// GetAllTeachers 获取所有教师
+func GetAllTeachers() ([]models.Teacher, error) {
+	var teachers []models.Teacher
+	err := database.DB.Order("name").Find(&teachers).Error
+	return teachers, err
+}
+
+// GetTeacher 根据ID获取教师
+func GetTeacher(id uint) (*models.Teacher, error) {
+	var teacher models.Teacher
+	if err := database.DB.First(&teacher, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTeacherNotFound
+		}
+		return nil, err
+	}
+	return &teacher, nil
+}
+
+// CreateTeacher 添加教师
+func CreateTeacher(actor Actor, data TeacherData) (*models.Teacher, error) {
+	data.Name = strings.TrimSpace(data.Name)
+	if data.Name == "" {
+		return nil, ErrInvalidTeacher
+	}
+
+	teacher := models.Teacher{
+		Name:   data.Name,
+		Email:  data.Email,
+		Phone:  data.Phone,
+		UserID: data.UserID,
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&teacher).Error; err != nil {
+			return err
+		}
+		return RecordActivity(tx, actor, ActivityEvent{
+			Action: models.ActivityTeacherCreate, EntityType: models.EntityTeacher, EntityID: teacher.ID, EntityName: teacher.Name,
+			After: teacher,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &teacher, nil
+}
+
+// UpdateTeacher 更新教师信息
+func UpdateTeacher(actor Actor, id uint, data TeacherData) (*models.Teacher, error) {
+	data.Name = strings.TrimSpace(data.Name)
+	if data.Name == "" {
+		return nil, ErrInvalidTeacher
+	}
+
+	teacher, err := GetTeacher(id)
+	if err != nil {
+		return nil, err
+	}
+
+	before := *teacher
+	teacher.Name = data.Name
+	teacher.Email = data.Email
+	teacher.Phone = data.Phone
+	teacher.UserID = data.UserID
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(teacher).Error; err != nil {
+			return err
+		}
+		return RecordActivity(tx, actor, ActivityEvent{
+			Action: models.ActivityTeacherUpdate, EntityType: models.EntityTeacher, EntityID: teacher.ID, EntityName: teacher.Name,
+			Before: before, After: teacher,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return teacher, nil
+}
+
+// DeleteTeacher 删除教师，仍是课程默认教师或被课程记录单独指定时拒绝删除
+func DeleteTeacher(actor Actor, id uint) (*models.Teacher, error) {
+	var teacher models.Teacher
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&teacher, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrTeacherNotFound
+			}
+			return err
+		}
+
+		var courses, schedules, published int64
+		if err := tx.Model(&models.Course{}).Where("default_teacher_id = ?", id).Count(&courses).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.WeeklySchedule{}).Where("teacher_id = ?", id).Count(&schedules).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.PublishedSchedule{}).Where("teacher_id = ?", id).Count(&published).Error; err != nil {
+			return err
+		}
+		if courses > 0 || schedules > 0 || published > 0 {
+			return ErrTeacherInUse
+		}
+
+		if err := tx.Delete(&teacher).Error; err != nil {
+			return err
+		}
+		return RecordActivity(tx, actor, ActivityEvent{
+			Action: models.ActivityTeacherDelete, EntityType: models.EntityTeacher, EntityID: teacher.ID, EntityName: teacher.Name,
+			Before: teacher,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &teacher, nil
+}
+
+// teacherScheduleScope 筛选实际由指定教师任课的课程记录（单独指定或课程默认教师），需要 JOIN courses
+func teacherScheduleScope(teacherID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Joins("JOIN courses ON courses.id = weekly_schedules.course_id").
+			Where("weekly_schedules.teacher_id = ? OR (weekly_schedules.teacher_id IS NULL AND courses.default_teacher_id = ?)",
+				teacherID, teacherID)
+	}
+}
+
+// GetScheduleByTeacher 获取教师在当前学期某一周所有班级的课程
+func GetScheduleByTeacher(teacherID uint, weekNumber int) ([]models.WeeklySchedule, error) {
+	if _, err := GetTeacher(teacherID); err != nil {
+		return nil, err
+	}
+
+	termID, err := currentTermID()
+	if err != nil {
+		return nil, err
+	}
+
+	var schedules []models.WeeklySchedule
+	err = database.DB.Preload("Class").Preload("Course").Preload("Teacher").
+		Scopes(teacherScheduleScope(teacherID)).
+		Where("weekly_schedules.term_id = ? AND weekly_schedules.week_number = ?", termID, weekNumber).
+		Order("weekly_schedules.time_slot_col, weekly_schedules.time_slot_row").
+		Find(&schedules).Error
+	if err != nil {
+		return nil, err
+	}
+
+	schedules, err = annotateCalendar(schedules, weekNumber)
+	if err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
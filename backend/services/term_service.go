@@ -0,0 +1,615 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"reschedule-program/database"
+	"reschedule-program/models"
+	"strings"
+	"time"
+	_ "time/tzdata" // 不依赖系统时区数据库
+
+	"gorm.io/gorm"
+)
+
+// dateLayout 校历日期格式
+const dateLayout = "2006-01-02"
+
+var (
+	ErrTermNotFound        = errors.New("term not found")
+	ErrNoActiveTerm        = errors.New("no active term")
+	ErrInvalidDate         = errors.New("invalid date, expected YYYY-MM-DD")
+	ErrStartNotMonday      = errors.New("term start date must be a Monday")
+	ErrDateOutsideTerm     = errors.New("date is outside the term")
+	ErrInvalidCalendarDay  = errors.New("kind must be holiday or workday, followsCol must be 0-6")
+	ErrTermInUse           = errors.New("term still has schedules")
+	ErrInvalidPeriodTimes  = errors.New("periodTimes must list 5 ascending HH:MM-HH:MM ranges")
+	ErrInvalidTimeZone     = errors.New("unknown time zone")
+	ErrCalendarDayNotFound = errors.New("calendar day not found")
+)
+
+// 学期默认的上课时间和时区
+const (
+	defaultPeriodTimes = "08:00-09:40,10:00-11:40,14:00-15:40,16:00-17:40,19:00-20:40"
+	defaultTimeZone    = "Asia/Shanghai"
+	periodCount        = 5 // 每天的时间段数，对应行号 0-4
+)
+
+// TermData 前端传来的学期数据
+type TermData struct {
+	Name        string `json:"name"`
+	StartDate   string `json:"startDate"`
+	WeekCount   int    `json:"weekCount"`
+	PeriodTimes string `json:"periodTimes"` // 为空时使用默认上课时间
+	TimeZone    string `json:"timeZone"`    // 为空时使用默认时区
+}
+
+// PeriodTime 一个时间段的上课时间，以当天零点起的分钟数表示
+type PeriodTime struct {
+	Start int
+	End   int
+}
+
+// String 以 HH:MM-HH:MM 格式表示时间段
+func (p PeriodTime) String() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", p.Start/60, p.Start%60, p.End/60, p.End%60)
+}
+
+// CalendarDayData 前端传来的校历日期数据
+type CalendarDayData struct {
+	Date       string `json:"date"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	FollowsCol *int   `json:"followsCol"`
+}
+
+// DayInfo 某一周中一天的校历信息
+type DayInfo struct {
+	Col        int    `json:"col"`
+	Date       string `json:"date"`
+	Kind       string `json:"kind,omitempty"` // 空表示普通日期
+	Name       string `json:"name,omitempty"`
+	FollowsCol *int   `json:"followsCol,omitempty"`
+	Teaching   bool   `json:"teaching"`
+}
+
+// DisplacedLesson 因节假日无法上课的课程
+type DisplacedLesson struct {
+	ScheduleID  uint   `json:"scheduleId"`
+	ClassName   string `json:"className"`
+	CourseName  string `json:"courseName"`
+	WeekNumber  int    `json:"weekNumber"`
+	TimeSlotRow int    `json:"timeSlotRow"`
+	TimeSlotCol int    `json:"timeSlotCol"`
+}
+
+// HolidayDisplacement 单个节假日及其占用的课程
+type HolidayDisplacement struct {
+	Date        string            `json:"date"`
+	Name        string            `json:"name"`
+	WeekNumber  int               `json:"weekNumber"`
+	TimeSlotCol int               `json:"timeSlotCol"`
+	Lessons     []DisplacedLesson `json:"lessons"`
+}
+
+// parseDate 解析 YYYY-MM-DD 格式的日期
+func parseDate(value string) (time.Time, error) {
+	date, err := time.Parse(dateLayout, value)
+	if err != nil {
+		return time.Time{}, ErrInvalidDate
+	}
+	return date, nil
+}
+
+// TermDate 计算学期中第 weekNumber 周第 col 天的日期
+func TermDate(term *models.Term, weekNumber int, col int) (time.Time, error) {
+	start, err := parseDate(term.StartDate)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return start.AddDate(0, 0, (weekNumber-1)*7+col), nil
+}
+
+// TermSlotOfDate 计算日期在学期中的周数和列号
+func TermSlotOfDate(term *models.Term, value string) (int, int, error) {
+	start, err := parseDate(term.StartDate)
+	if err != nil {
+		return 0, 0, err
+	}
+	date, err := parseDate(value)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	days := int(date.Sub(start).Hours() / 24)
+	if days < 0 || days >= term.WeekCount*7 {
+		return 0, 0, ErrDateOutsideTerm
+	}
+	return days/7 + 1, days % 7, nil
+}
+
+// parseClock 解析 HH:MM 格式的时间
+func parseClock(value string) (int, error) {
+	clock, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, err
+	}
+	return clock.Hour()*60 + clock.Minute(), nil
+}
+
+// ParsePeriodTimes 解析学期的上课时间，各时间段须按顺序且不重叠
+func ParsePeriodTimes(value string) ([]PeriodTime, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != periodCount {
+		return nil, ErrInvalidPeriodTimes
+	}
+
+	periods := make([]PeriodTime, 0, periodCount)
+	for _, part := range parts {
+		bounds := strings.Split(part, "-")
+		if len(bounds) != 2 {
+			return nil, ErrInvalidPeriodTimes
+		}
+		start, err := parseClock(bounds[0])
+		if err != nil {
+			return nil, ErrInvalidPeriodTimes
+		}
+		end, err := parseClock(bounds[1])
+		if err != nil || end <= start {
+			return nil, ErrInvalidPeriodTimes
+		}
+		if len(periods) > 0 && start < periods[len(periods)-1].End {
+			return nil, ErrInvalidPeriodTimes
+		}
+		periods = append(periods, PeriodTime{Start: start, End: end})
+	}
+	return periods, nil
+}
+
+// TermLocation 学期上课时间所在的时区
+func TermLocation(term *models.Term) (*time.Location, error) {
+	location, err := time.LoadLocation(term.TimeZone)
+	if err != nil || term.TimeZone == "" {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidTimeZone, term.TimeZone)
+	}
+	return location, nil
+}
+
+// validateTermData 校验学期数据并补全默认值
+func validateTermData(data *TermData) error {
+	start, err := parseDate(data.StartDate)
+	if err != nil {
+		return err
+	}
+	if start.Weekday() != time.Monday {
+		return ErrStartNotMonday
+	}
+	if data.WeekCount <= 0 {
+		data.WeekCount = 20
+	}
+	if data.PeriodTimes == "" {
+		data.PeriodTimes = defaultPeriodTimes
+	}
+	if _, err := ParsePeriodTimes(data.PeriodTimes); err != nil {
+		return err
+	}
+	if data.TimeZone == "" {
+		data.TimeZone = defaultTimeZone
+	}
+	if _, err := TermLocation(&models.Term{TimeZone: data.TimeZone}); err != nil {
+		return err
+	}
+	return nil
+}
+
+// CreateTerm 创建学期，第一个学期自动设为当前学期并接管尚未设置学期的课程记录及其变更历史
+func CreateTerm(actor Actor, data TermData) (*models.Term, error) {
+	if err := validateTermData(&data); err != nil {
+		return nil, err
+	}
+
+	var term models.Term
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.Term{}).Count(&count).Error; err != nil {
+			return err
+		}
+
+		term = models.Term{
+			Name:      data.Name,
+			StartDate: data.StartDate,
+			WeekCount: data.WeekCount,
+			Active:    count == 0,
+
+			PeriodTimes: data.PeriodTimes,
+			TimeZone:    data.TimeZone,
+		}
+		if err := tx.Create(&term).Error; err != nil {
+			return err
+		}
+		if err := RecordActivity(tx, actor, ActivityEvent{
+			Action: models.ActivityTermCreate, EntityType: models.EntityTerm, EntityID: term.ID, EntityName: term.Name,
+			After: term,
+		}); err != nil {
+			return err
+		}
+
+		if count > 0 {
+			return nil
+		}
+		// 课程记录、已发布课程、变更历史、调课申请和排课任务一起接管，历史和撤销仍能对应到课程
+		for _, model := range []interface{}{
+			&models.WeeklySchedule{}, &models.PublishedSchedule{}, &models.ScheduleChange{},
+			&models.RescheduleRequest{}, &models.TimetableJob{},
+		} {
+			if err := tx.Unscoped().Model(model).Where("term_id = ?", 0).Update("term_id", term.ID).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &term, nil
+}
+
+// ActiveWeekCount 返回当前学期的总周数，未设置学期时为 20
+func ActiveWeekCount() (int, error) {
+	termID, err := currentTermID()
+	if err != nil {
+		return 0, err
+	}
+	return termWeekCount(termID)
+}
+
+// termWeekCount 返回学期总周数，未设置学期时为 20
+func termWeekCount(termID uint) (int, error) {
+	if termID == 0 {
+		return 20, nil
+	}
+	term, err := GetTerm(termID)
+	if err != nil {
+		return 0, err
+	}
+	return term.WeekCount, nil
+}
+
+// UpdateTerm 更新学期名称、开学日期、周数、上课时间和时区
+func UpdateTerm(actor Actor, id uint, data TermData) (*models.Term, error) {
+	if err := validateTermData(&data); err != nil {
+		return nil, err
+	}
+
+	term, err := GetTerm(id)
+	if err != nil {
+		return nil, err
+	}
+
+	before := *term
+	term.Name = data.Name
+	term.StartDate = data.StartDate
+	term.WeekCount = data.WeekCount
+	term.PeriodTimes = data.PeriodTimes
+	term.TimeZone = data.TimeZone
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(term).Error; err != nil {
+			return err
+		}
+		return RecordActivity(tx, actor, ActivityEvent{
+			Action: models.ActivityTermUpdate, EntityType: models.EntityTerm, EntityID: term.ID, EntityName: term.Name,
+			Before: before, After: term,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return term, nil
+}
+
+// GetAllTerms 获取所有学期
+func GetAllTerms() ([]models.Term, error) {
+	var terms []models.Term
+	err := database.DB.Order("start_date").Find(&terms).Error
+	return terms, err
+}
+
+// GetTerm 根据ID获取学期
+func GetTerm(id uint) (*models.Term, error) {
+	var term models.Term
+	if err := database.DB.First(&term, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTermNotFound
+		}
+		return nil, err
+	}
+	return &term, nil
+}
+
+// GetActiveTerm 获取当前学期
+func GetActiveTerm() (*models.Term, error) {
+	var term models.Term
+	if err := database.DB.Where("active = ?", true).First(&term).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNoActiveTerm
+		}
+		return nil, err
+	}
+	return &term, nil
+}
+
+// ActivateTerm 将指定学期设为当前学期
+func ActivateTerm(actor Actor, id uint) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var term models.Term
+		if err := tx.First(&term, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrTermNotFound
+			}
+			return err
+		}
+		var previous models.Term
+		if err := tx.Where("active = ?", true).Limit(1).Find(&previous).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Term{}).Where("active = ?", true).Update("active", false).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&term).Update("active", true).Error; err != nil {
+			return err
+		}
+		return RecordActivity(tx, actor, ActivityEvent{
+			Action: models.ActivityTermActivate, EntityType: models.EntityTerm, EntityID: term.ID, EntityName: term.Name,
+			Before: map[string]interface{}{"activeTermId": previous.ID, "activeTerm": previous.Name},
+			After:  map[string]interface{}{"activeTermId": term.ID, "activeTerm": term.Name},
+		})
+	})
+}
+
+// DeleteTerm 删除学期及其校历，学期中仍有课程时拒绝删除
+func DeleteTerm(actor Actor, id uint) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var term models.Term
+		if err := tx.First(&term, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrTermNotFound
+			}
+			return err
+		}
+		var count, published int64
+		if err := tx.Model(&models.WeeklySchedule{}).Where("term_id = ?", id).Count(&count).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.PublishedSchedule{}).Where("term_id = ?", id).Count(&published).Error; err != nil {
+			return err
+		}
+		if count > 0 || published > 0 {
+			return ErrTermInUse
+		}
+		// 学期名称和校历日期有唯一索引，直接删除记录，之后可以再次使用相同的名称和日期
+		if err := tx.Unscoped().Where("term_id = ?", id).Delete(&models.CalendarDay{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Delete(&term).Error; err != nil {
+			return err
+		}
+		return RecordActivity(tx, actor, ActivityEvent{
+			Action: models.ActivityTermDelete, EntityType: models.EntityTerm, EntityID: term.ID, EntityName: term.Name,
+			Before: term,
+		})
+	})
+}
+
+// AddCalendarDay 向学期校历添加节假日或调休补课日，同一天再次添加时覆盖原记录
+func AddCalendarDay(actor Actor, termID uint, data CalendarDayData) (*models.CalendarDay, error) {
+	term, err := GetTerm(termID)
+	if err != nil {
+		return nil, err
+	}
+
+	if data.Kind != models.CalendarDayHoliday && data.Kind != models.CalendarDayWorkday {
+		return nil, ErrInvalidCalendarDay
+	}
+	if data.Kind == models.CalendarDayHoliday {
+		data.FollowsCol = nil
+	}
+	if data.FollowsCol != nil && (*data.FollowsCol < 0 || *data.FollowsCol > 6) {
+		return nil, ErrInvalidCalendarDay
+	}
+	if _, _, err := TermSlotOfDate(term, data.Date); err != nil {
+		return nil, err
+	}
+
+	var day models.CalendarDay
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("term_id = ? AND date = ?", termID, data.Date).Limit(1).Find(&day).Error; err != nil {
+			return err
+		}
+		// 覆盖的原记录作为变更前的数据
+		var before interface{}
+		if day.ID > 0 {
+			before = day
+		}
+
+		day.TermID = termID
+		day.Date = data.Date
+		day.Kind = data.Kind
+		day.Name = data.Name
+		day.FollowsCol = data.FollowsCol
+		if err := tx.Save(&day).Error; err != nil {
+			return err
+		}
+		return RecordActivity(tx, actor, ActivityEvent{
+			Action: models.ActivityCalendarDayAdd, EntityType: models.EntityCalendarDay, EntityID: day.ID, EntityName: day.Date,
+			Before: before, After: day,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &day, nil
+}
+
+// GetCalendarDays 获取学期校历中的所有特殊日期
+func GetCalendarDays(termID uint) ([]models.CalendarDay, error) {
+	var days []models.CalendarDay
+	err := database.DB.Where("term_id = ?", termID).Order("date").Find(&days).Error
+	return days, err
+}
+
+// DeleteCalendarDay 删除学期校历中的特殊日期，直接删除记录，之后可以再次添加同一天
+func DeleteCalendarDay(actor Actor, termID uint, dayID uint) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var day models.CalendarDay
+		if err := tx.Where("term_id = ? AND id = ?", termID, dayID).First(&day).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrCalendarDayNotFound
+			}
+			return err
+		}
+		if err := tx.Unscoped().Delete(&day).Error; err != nil {
+			return err
+		}
+		return RecordActivity(tx, actor, ActivityEvent{
+			Action: models.ActivityCalendarDayDelete, EntityType: models.EntityCalendarDay, EntityID: day.ID, EntityName: day.Date,
+			Before: day,
+		})
+	})
+}
+
+// GetWeekCalendar 获取学期第 weekNumber 周七天的校历信息
+func GetWeekCalendar(term *models.Term, weekNumber int) ([]DayInfo, error) {
+	first, err := TermDate(term, weekNumber, 0)
+	if err != nil {
+		return nil, err
+	}
+	last := first.AddDate(0, 0, 6)
+
+	var special []models.CalendarDay
+	if err := database.DB.Where("term_id = ? AND date BETWEEN ? AND ?",
+		term.ID, first.Format(dateLayout), last.Format(dateLayout)).Find(&special).Error; err != nil {
+		return nil, err
+	}
+	byDate := make(map[string]models.CalendarDay, len(special))
+	for _, day := range special {
+		byDate[day.Date] = day
+	}
+
+	days := make([]DayInfo, 7)
+	for col := 0; col < 7; col++ {
+		date := first.AddDate(0, 0, col).Format(dateLayout)
+		info := DayInfo{Col: col, Date: date, Teaching: true}
+		if day, ok := byDate[date]; ok {
+			info.Kind = day.Kind
+			info.Name = day.Name
+			info.FollowsCol = day.FollowsCol
+			info.Teaching = day.Kind != models.CalendarDayHoliday
+		}
+		days[col] = info
+	}
+	return days, nil
+}
+
+// GetActiveWeekCalendar 获取当前学期第 weekNumber 周的校历信息，没有当前学期时返回 nil
+func GetActiveWeekCalendar(weekNumber int) ([]DayInfo, error) {
+	term, err := GetActiveTerm()
+	if errors.Is(err, ErrNoActiveTerm) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return GetWeekCalendar(term, weekNumber)
+}
+
+// annotateCalendar 为课程记录标注上课日期和节假日信息，并为调休补课日加入按其上课星期复制的课程。
+// 复制的课程ID与原课程相同，TimeSlotCol 为补课日的列号，MakeUpFor 为原课程的列号
+func annotateCalendar(schedules []models.WeeklySchedule, weekNumber int) ([]models.WeeklySchedule, error) {
+	days, err := GetActiveWeekCalendar(weekNumber)
+	if err != nil || days == nil {
+		return schedules, err
+	}
+
+	count := len(schedules)
+	for i := 0; i < count; i++ {
+		col := schedules[i].TimeSlotCol
+		if col < 0 || col >= len(days) {
+			continue
+		}
+		schedules[i].Date = days[col].Date
+		if !days[col].Teaching {
+			schedules[i].NonTeaching = true
+			schedules[i].Holiday = days[col].Name
+		}
+	}
+
+	for _, day := range days {
+		if day.Kind != models.CalendarDayWorkday || day.FollowsCol == nil || *day.FollowsCol == day.Col {
+			continue
+		}
+		for i := 0; i < count; i++ {
+			if schedules[i].TimeSlotCol != *day.FollowsCol {
+				continue
+			}
+			followsCol := *day.FollowsCol
+			makeUp := schedules[i]
+			makeUp.TimeSlotCol = day.Col
+			makeUp.Date = day.Date
+			makeUp.NonTeaching = false
+			makeUp.Holiday = ""
+			makeUp.MakeUpFor = &followsCol
+			schedules = append(schedules, makeUp)
+		}
+	}
+	return schedules, nil
+}
+
+// GetDisplacementReport 列出学期中每个节假日占用的所有课程
+func GetDisplacementReport(termID uint) ([]HolidayDisplacement, error) {
+	term, err := GetTerm(termID)
+	if err != nil {
+		return nil, err
+	}
+
+	var holidays []models.CalendarDay
+	if err := database.DB.Where("term_id = ? AND kind = ?", termID, models.CalendarDayHoliday).
+		Order("date").Find(&holidays).Error; err != nil {
+		return nil, err
+	}
+
+	report := make([]HolidayDisplacement, 0, len(holidays))
+	for _, holiday := range holidays {
+		week, col, err := TermSlotOfDate(term, holiday.Date)
+		if err != nil {
+			// 学期日期调整后落在学期外的节假日不再占用课程
+			continue
+		}
+
+		var schedules []models.WeeklySchedule
+		if err := database.DB.Preload("Class").Preload("Course").
+			Where("term_id = ? AND week_number = ? AND time_slot_col = ?", termID, week, col).
+			Order("class_id, time_slot_row").Find(&schedules).Error; err != nil {
+			return nil, err
+		}
+
+		entry := HolidayDisplacement{
+			Date:        holiday.Date,
+			Name:        holiday.Name,
+			WeekNumber:  week,
+			TimeSlotCol: col,
+			Lessons:     make([]DisplacedLesson, 0, len(schedules)),
+		}
+		for _, schedule := range schedules {
+			entry.Lessons = append(entry.Lessons, DisplacedLesson{
+				ScheduleID:  schedule.ID,
+				ClassName:   schedule.Class.Name,
+				CourseName:  schedule.Course.Name,
+				WeekNumber:  schedule.WeekNumber,
+				TimeSlotRow: schedule.TimeSlotRow,
+				TimeSlotCol: schedule.TimeSlotCol,
+			})
+		}
+		report = append(report, entry)
+	}
+	return report, nil
+}
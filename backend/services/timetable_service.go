@@ -0,0 +1,733 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"reschedule-program/database"
+	"reschedule-program/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTimetableJobNotFound = errors.New("timetable job not found")
+	ErrTimetableJobNotReady = errors.New("timetable job has no proposal to apply")
+	ErrTimetableJobRunning  = errors.New("timetable job is still running")
+	ErrInvalidTimetable     = errors.New("invalid timetable input")
+)
+
+// 排课参数默认值和上限
+const (
+	defaultTimetableAttempts = 20
+	maxTimetableAttempts     = 200
+	defaultMaxPerDay         = 2
+)
+
+// TimetableRequirement 班级某门课程每周需要安排的课时
+type TimetableRequirement struct {
+	CourseName string `json:"courseName"`
+	Hours      int    `json:"hours"`     // 每周课时，为 0 时使用课程目录中的 weeklyHours
+	TeacherID  *uint  `json:"teacherId"` // 为空时使用课程默认教师
+	RoomID     *uint  `json:"roomId"`    // 为空时不占用教室
+}
+
+// TimetableClassInput 一个班级的排课需求
+type TimetableClassInput struct {
+	ClassName string                 `json:"className"`
+	Courses   []TimetableRequirement `json:"courses"`
+}
+
+// TimetableBlock 不可排课的时间段，班级、教师、教室都为空时对所有班级生效；
+// TimeSlotRow 为空表示整天，TimeSlotCol 为空表示每天的该时间段
+type TimetableBlock struct {
+	ClassName   string `json:"className"`
+	TeacherID   *uint  `json:"teacherId"`
+	RoomID      *uint  `json:"roomId"`
+	TimeSlotRow *int   `json:"timeSlotRow"`
+	TimeSlotCol *int   `json:"timeSlotCol"`
+}
+
+// TimetableInput 自动排课输入
+type TimetableInput struct {
+	Classes   []TimetableClassInput `json:"classes"`
+	StartWeek int                   `json:"startWeek"` // 为 0 时从第1周开始
+	EndWeek   int                   `json:"endWeek"`   // 为 0 时到学期最后一周
+	Days      []int                 `json:"days"`      // 可排课的星期 0-6，为空时为周一到周五
+	Blocked   []TimetableBlock      `json:"blocked"`
+	MaxPerDay int                   `json:"maxPerDay"` // 同一课程每天最多课时（软约束），为 0 时为 2
+	Attempts  int                   `json:"attempts"`  // 随机重启次数，为 0 时为 20
+	Seed      *int64                `json:"seed"`      // 随机种子，为空时按当前时间生成
+}
+
+// UnplacedLesson 无法安排的课时
+type UnplacedLesson struct {
+	ClassName  string `json:"className"`
+	CourseName string `json:"courseName"`
+	Hours      int    `json:"hours"`
+}
+
+// TimetableJobInfo 排课任务及无法安排的课时
+type TimetableJobInfo struct {
+	models.TimetableJob
+	Unplaced []UnplacedLesson `json:"unplaced"`
+}
+
+// solverGroup 一个班级一门课程的排课需求
+type solverGroup struct {
+	classID    uint
+	courseID   uint
+	className  string
+	courseName string
+	teacherID  *uint // 实际任课教师，用于冲突判断
+	override   *uint // 单独指定的教师，写入课程记录
+	roomID     *uint
+	hours      int
+}
+
+// slotGrid 一周 5×7 个时间槽的占用情况
+type slotGrid [slotRows * slotCols]bool
+
+// solverState 求解过程中班级、教师、教室的占用情况
+type solverState struct {
+	classes  map[uint]*slotGrid
+	teachers map[uint]*slotGrid
+	rooms    map[uint]*slotGrid
+	global   slotGrid
+}
+
+func newSolverState() *solverState {
+	return &solverState{
+		classes:  make(map[uint]*slotGrid),
+		teachers: make(map[uint]*slotGrid),
+		rooms:    make(map[uint]*slotGrid),
+	}
+}
+
+// grid 返回资源的占用表，不存在时创建
+func grid(grids map[uint]*slotGrid, id uint) *slotGrid {
+	g, ok := grids[id]
+	if !ok {
+		g = &slotGrid{}
+		grids[id] = g
+	}
+	return g
+}
+
+// clone 复制占用情况，每次重启从初始状态开始
+func (s *solverState) clone() *solverState {
+	copied := newSolverState()
+	copied.global = s.global
+	for id, g := range s.classes {
+		v := *g
+		copied.classes[id] = &v
+	}
+	for id, g := range s.teachers {
+		v := *g
+		copied.teachers[id] = &v
+	}
+	for id, g := range s.rooms {
+		v := *g
+		copied.rooms[id] = &v
+	}
+	return copied
+}
+
+// free 判断课程组能否安排在时间槽
+func (s *solverState) free(group *solverGroup, slot int) bool {
+	if s.global[slot] || grid(s.classes, group.classID)[slot] {
+		return false
+	}
+	if group.teacherID != nil && grid(s.teachers, *group.teacherID)[slot] {
+		return false
+	}
+	if group.roomID != nil && grid(s.rooms, *group.roomID)[slot] {
+		return false
+	}
+	return true
+}
+
+// occupy 占用时间槽
+func (s *solverState) occupy(group *solverGroup, slot int) {
+	grid(s.classes, group.classID)[slot] = true
+	if group.teacherID != nil {
+		grid(s.teachers, *group.teacherID)[slot] = true
+	}
+	if group.roomID != nil {
+		grid(s.rooms, *group.roomID)[slot] = true
+	}
+}
+
+// solverPlacement 求解得到的一节课
+type solverPlacement struct {
+	group int
+	slot  int
+}
+
+// solverResult 一次求解的结果
+type solverResult struct {
+	placements []solverPlacement
+	unplaced   []int // 每个课程组未安排的课时
+	penalty    int
+}
+
+// unplacedTotal 未安排的课时总数
+func (r *solverResult) unplacedTotal() int {
+	total := 0
+	for _, hours := range r.unplaced {
+		total += hours
+	}
+	return total
+}
+
+// better 比较两次求解结果：未安排课时少的优先，其次是罚分低的
+func (r *solverResult) better(other *solverResult) bool {
+	if other == nil {
+		return true
+	}
+	if r.unplacedTotal() != other.unplacedTotal() {
+		return r.unplacedTotal() < other.unplacedTotal()
+	}
+	return r.penalty < other.penalty
+}
+
+// solveOnce 贪心求解一次：每次选择可用时间槽最少的课程组，放在罚分最低的时间槽，
+// 罚分相同的时间槽随机选择。罚分鼓励同一课程分散到不同的天，并惩罚超过每天上限的安排
+func solveOnce(groups []solverGroup, initial *solverState, slots []int, maxPerDay int, rng *rand.Rand) *solverResult {
+	state := initial.clone()
+	result := &solverResult{unplaced: make([]int, len(groups))}
+	remaining := make([]int, len(groups))
+	perDay := make([][slotCols]int, len(groups))
+	for i := range groups {
+		remaining[i] = groups[i].hours
+	}
+	order := rng.Perm(len(groups))
+
+	for {
+		// 1. 选择可用时间槽最少的课程组
+		pick, pickFree := -1, 0
+		for _, i := range order {
+			if remaining[i] == 0 {
+				continue
+			}
+			count := 0
+			for _, slot := range slots {
+				if state.free(&groups[i], slot) {
+					count++
+				}
+			}
+			if pick == -1 || count < pickFree {
+				pick, pickFree = i, count
+			}
+		}
+		if pick == -1 {
+			break
+		}
+		group := &groups[pick]
+		if pickFree == 0 {
+			result.unplaced[pick] = remaining[pick]
+			remaining[pick] = 0
+			continue
+		}
+
+		// 2. 选择罚分最低的时间槽
+		best, candidates := -1, []int{}
+		for _, slot := range slots {
+			if !state.free(group, slot) {
+				continue
+			}
+			sameDay := perDay[pick][slot%slotCols]
+			penalty := sameDay * 10
+			if sameDay >= maxPerDay {
+				penalty += 100
+			}
+			if best == -1 || penalty < best {
+				best, candidates = penalty, []int{slot}
+			} else if penalty == best {
+				candidates = append(candidates, slot)
+			}
+		}
+		slot := candidates[rng.Intn(len(candidates))]
+
+		// 3. 占用时间槽
+		state.occupy(group, slot)
+		perDay[pick][slot%slotCols]++
+		remaining[pick]--
+		result.penalty += best
+		result.placements = append(result.placements, solverPlacement{group: pick, slot: slot})
+	}
+	return result
+}
+
+// timetableProblem 校验后的排课问题
+type timetableProblem struct {
+	termID    uint
+	startWeek int
+	endWeek   int
+	groups    []solverGroup
+	state     *solverState
+	slots     []int
+	maxPerDay int
+	attempts  int
+	seed      int64
+}
+
+// buildTimetableProblem 校验排课输入，读取课程目录和当前学期已有课程的占用情况
+func buildTimetableProblem(input TimetableInput) (*timetableProblem, error) {
+	termID, err := currentTermID()
+	if err != nil {
+		return nil, err
+	}
+	problem := &timetableProblem{termID: termID, state: newSolverState()}
+
+	// 1. 周数范围和参数
+	maxWeek, err := termWeekCount(termID)
+	if err != nil {
+		return nil, err
+	}
+	problem.startWeek, problem.endWeek = input.StartWeek, input.EndWeek
+	if problem.startWeek == 0 {
+		problem.startWeek = 1
+	}
+	if problem.endWeek == 0 {
+		problem.endWeek = maxWeek
+	}
+	if problem.startWeek < 1 || problem.endWeek > maxWeek || problem.startWeek > problem.endWeek {
+		return nil, fmt.Errorf("%w: week range must be within 1-%d", ErrInvalidTimetable, maxWeek)
+	}
+
+	problem.maxPerDay = input.MaxPerDay
+	if problem.maxPerDay <= 0 {
+		problem.maxPerDay = defaultMaxPerDay
+	}
+	problem.attempts = input.Attempts
+	if problem.attempts <= 0 {
+		problem.attempts = defaultTimetableAttempts
+	}
+	if problem.attempts > maxTimetableAttempts {
+		problem.attempts = maxTimetableAttempts
+	}
+	if input.Seed != nil {
+		problem.seed = *input.Seed
+	} else {
+		problem.seed = time.Now().UnixNano()
+	}
+
+	days := input.Days
+	if len(days) == 0 {
+		days = []int{0, 1, 2, 3, 4}
+	}
+	for _, col := range days {
+		if col < 0 || col >= slotCols {
+			return nil, fmt.Errorf("%w: day %d out of range", ErrInvalidTimetable, col)
+		}
+		for row := 0; row < slotRows; row++ {
+			problem.slots = append(problem.slots, row*slotCols+col)
+		}
+	}
+
+	// 2. 班级和课程需求
+	if len(input.Classes) == 0 {
+		return nil, fmt.Errorf("%w: no classes given", ErrInvalidTimetable)
+	}
+	classIDs := make(map[string]uint)
+	for _, classInput := range input.Classes {
+		class, err := findClassByName(database.DB, classInput.ClassName)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", err, classInput.ClassName)
+		}
+		if class.Archived {
+			return nil, fmt.Errorf("%w: %s", ErrClassArchived, class.Name)
+		}
+		if _, ok := classIDs[class.Name]; ok {
+			return nil, fmt.Errorf("%w: class %s listed twice", ErrInvalidTimetable, class.Name)
+		}
+		classIDs[class.Name] = class.ID
+
+		for _, requirement := range classInput.Courses {
+			course, err := findCourse(database.DB, requirement.CourseName)
+			if err != nil {
+				return nil, err
+			}
+			if err := ensureTeacher(database.DB, requirement.TeacherID); err != nil {
+				return nil, err
+			}
+			if err := ensureRoom(database.DB, requirement.RoomID); err != nil {
+				return nil, err
+			}
+
+			hours := requirement.Hours
+			if hours == 0 {
+				hours = course.WeeklyHours
+			}
+			if hours <= 0 || hours > len(problem.slots) {
+				return nil, fmt.Errorf("%w: %s %s needs 1-%d hours per week", ErrInvalidTimetable,
+					class.Name, course.Name, len(problem.slots))
+			}
+
+			teacherID := requirement.TeacherID
+			if teacherID == nil {
+				teacherID = course.DefaultTeacherID
+			}
+			problem.groups = append(problem.groups, solverGroup{
+				classID:    class.ID,
+				courseID:   course.ID,
+				className:  class.Name,
+				courseName: course.Name,
+				teacherID:  teacherID,
+				override:   requirement.TeacherID,
+				roomID:     requirement.RoomID,
+				hours:      hours,
+			})
+		}
+	}
+
+	if len(problem.groups) == 0 {
+		return nil, fmt.Errorf("%w: no courses given", ErrInvalidTimetable)
+	}
+
+	// 3. 周数范围内已有的课程视为占用，任意一周占用即不可安排
+	var existing []models.WeeklySchedule
+	if err := database.DB.Preload("Course").
+		Where("term_id = ? AND week_number BETWEEN ? AND ?", termID, problem.startWeek, problem.endWeek).
+		Find(&existing).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range existing {
+		slot := row.TimeSlotRow*slotCols + row.TimeSlotCol
+		grid(problem.state.classes, row.ClassID)[slot] = true
+		if teacherID := row.EffectiveTeacherID(); teacherID != nil {
+			grid(problem.state.teachers, *teacherID)[slot] = true
+		}
+		if row.RoomID != nil {
+			grid(problem.state.rooms, *row.RoomID)[slot] = true
+		}
+	}
+
+	// 4. 不可排课的时间段
+	for _, block := range input.Blocked {
+		if (block.TimeSlotRow != nil && (*block.TimeSlotRow < 0 || *block.TimeSlotRow >= slotRows)) ||
+			(block.TimeSlotCol != nil && (*block.TimeSlotCol < 0 || *block.TimeSlotCol >= slotCols)) {
+			return nil, fmt.Errorf("%w: blocked time slot out of range", ErrInvalidTimetable)
+		}
+
+		var targets []*slotGrid
+		if block.ClassName != "" {
+			class, err := findClassByName(database.DB, block.ClassName)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s", err, block.ClassName)
+			}
+			targets = append(targets, grid(problem.state.classes, class.ID))
+		}
+		if block.TeacherID != nil {
+			if err := ensureTeacher(database.DB, block.TeacherID); err != nil {
+				return nil, err
+			}
+			targets = append(targets, grid(problem.state.teachers, *block.TeacherID))
+		}
+		if block.RoomID != nil {
+			if err := ensureRoom(database.DB, block.RoomID); err != nil {
+				return nil, err
+			}
+			targets = append(targets, grid(problem.state.rooms, *block.RoomID))
+		}
+		if len(targets) == 0 {
+			targets = append(targets, &problem.state.global)
+		}
+
+		for row := 0; row < slotRows; row++ {
+			for col := 0; col < slotCols; col++ {
+				if (block.TimeSlotRow != nil && *block.TimeSlotRow != row) ||
+					(block.TimeSlotCol != nil && *block.TimeSlotCol != col) {
+					continue
+				}
+				for _, target := range targets {
+					target[row*slotCols+col] = true
+				}
+			}
+		}
+	}
+
+	return problem, nil
+}
+
+// solve 按种子多次随机重启求解，保留最好的结果，种子相同时结果相同。
+// 每次重启后以百分比调用 progress（不含 100）
+func (p *timetableProblem) solve(progress func(int)) *solverResult {
+	rng := rand.New(rand.NewSource(p.seed))
+	var best *solverResult
+	for attempt := 0; attempt < p.attempts; attempt++ {
+		result := solveOnce(p.groups, p.state, p.slots, p.maxPerDay, rng)
+		if result.better(best) {
+			best = result
+		}
+		if percent := (attempt + 1) * 100 / p.attempts; percent < 100 {
+			progress(percent)
+		}
+		if best.unplacedTotal() == 0 && best.penalty == 0 {
+			break
+		}
+	}
+	return best
+}
+
+// StartTimetableJob 校验排课输入并创建后台排课任务，立即返回任务
+func StartTimetableJob(actor Actor, input TimetableInput) (*models.TimetableJob, error) {
+	problem, err := buildTimetableProblem(input)
+	if err != nil {
+		return nil, err
+	}
+
+	// 记录实际使用的种子，便于重现
+	input.Seed = &problem.seed
+	encoded, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+
+	job := models.TimetableJob{
+		TermID:    problem.termID,
+		Status:    models.TimetableJobPending,
+		Seed:      problem.seed,
+		StartWeek: problem.startWeek,
+		EndWeek:   problem.endWeek,
+		Input:     string(encoded),
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&job).Error; err != nil {
+			return err
+		}
+		return RecordActivity(tx, actor, ActivityEvent{
+			Action: models.ActivityTimetableStart, EntityType: models.EntityTimetableJob, EntityID: job.ID,
+			After: map[string]interface{}{
+				"classes": len(input.Classes), "seed": job.Seed, "startWeek": job.StartWeek, "endWeek": job.EndWeek,
+			},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	go runTimetableJob(job.ID, problem)
+	return &job, nil
+}
+
+// runTimetableJob 在后台求解并保存草案，按重启次数更新进度
+func runTimetableJob(jobID uint, problem *timetableProblem) {
+	fail := func(err error) {
+		log.Printf("timetable job %d failed: %v", jobID, err)
+		database.DB.Model(&models.TimetableJob{}).Where("id = ?", jobID).
+			Updates(map[string]interface{}{"status": models.TimetableJobFailed, "message": err.Error()})
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			fail(fmt.Errorf("solver panic: %v", r))
+		}
+	}()
+
+	if err := database.DB.Model(&models.TimetableJob{}).Where("id = ?", jobID).
+		Update("status", models.TimetableJobRunning).Error; err != nil {
+		fail(err)
+		return
+	}
+
+	// 1. 多次随机重启，保留最好的结果
+	best := problem.solve(func(progress int) {
+		database.DB.Model(&models.TimetableJob{}).Where("id = ?", jobID).Update("progress", progress)
+	})
+
+	// 2. 保存草案
+	unplaced := []UnplacedLesson{}
+	for i, hours := range best.unplaced {
+		if hours > 0 {
+			unplaced = append(unplaced, UnplacedLesson{
+				ClassName:  problem.groups[i].className,
+				CourseName: problem.groups[i].courseName,
+				Hours:      hours,
+			})
+		}
+	}
+	encoded, err := json.Marshal(unplaced)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		for _, placement := range best.placements {
+			group := problem.groups[placement.group]
+			lesson := models.TimetableLesson{
+				JobID:       jobID,
+				ClassID:     group.classID,
+				CourseID:    group.courseID,
+				TeacherID:   group.override,
+				RoomID:      group.roomID,
+				TimeSlotRow: placement.slot / slotCols,
+				TimeSlotCol: placement.slot % slotCols,
+			}
+			if err := tx.Create(&lesson).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&models.TimetableJob{}).Where("id = ?", jobID).Updates(map[string]interface{}{
+			"status":   models.TimetableJobSucceeded,
+			"progress": 100,
+			"placed":   len(best.placements),
+			"unplaced": string(encoded),
+			"penalty":  best.penalty,
+		}).Error
+	})
+	if err != nil {
+		fail(err)
+	}
+}
+
+// FailInterruptedTimetableJobs 将服务重启前未完成的排课任务标记为失败
+func FailInterruptedTimetableJobs() error {
+	return database.DB.Model(&models.TimetableJob{}).
+		Where("status IN ?", []string{models.TimetableJobPending, models.TimetableJobRunning}).
+		Updates(map[string]interface{}{"status": models.TimetableJobFailed, "message": "interrupted by server restart"}).Error
+}
+
+// timetableJobInfo 解析任务中无法安排的课时
+func timetableJobInfo(job models.TimetableJob) TimetableJobInfo {
+	info := TimetableJobInfo{TimetableJob: job, Unplaced: []UnplacedLesson{}}
+	if job.Unplaced != "" {
+		json.Unmarshal([]byte(job.Unplaced), &info.Unplaced)
+	}
+	return info
+}
+
+// getTimetableJob 按ID获取排课任务
+func getTimetableJob(db *gorm.DB, id uint) (models.TimetableJob, error) {
+	var job models.TimetableJob
+	if err := db.First(&job, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return job, ErrTimetableJobNotFound
+		}
+		return job, err
+	}
+	return job, nil
+}
+
+// GetTimetableJobs 获取所有排课任务，最新的在前
+func GetTimetableJobs() ([]TimetableJobInfo, error) {
+	var jobs []models.TimetableJob
+	if err := database.DB.Order("id DESC").Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	infos := make([]TimetableJobInfo, 0, len(jobs))
+	for _, job := range jobs {
+		infos = append(infos, timetableJobInfo(job))
+	}
+	return infos, nil
+}
+
+// GetTimetableJob 获取排课任务的状态和进度
+func GetTimetableJob(id uint) (*TimetableJobInfo, error) {
+	job, err := getTimetableJob(database.DB, id)
+	if err != nil {
+		return nil, err
+	}
+	info := timetableJobInfo(job)
+	return &info, nil
+}
+
+// GetTimetableProposal 获取排课任务生成的草案
+func GetTimetableProposal(id uint) ([]models.TimetableLesson, error) {
+	if _, err := getTimetableJob(database.DB, id); err != nil {
+		return nil, err
+	}
+	var lessons []models.TimetableLesson
+	err := database.DB.Preload("Class").Preload("Course.DefaultTeacher").Preload("Teacher").Preload("Room").
+		Where("job_id = ?", id).
+		Order("class_id, time_slot_col, time_slot_row").
+		Find(&lessons).Error
+	return lessons, err
+}
+
+// ApplyTimetableJob 将草案按周写入任务所属学期的课程表，目标位置已有课程或存在冲突时整体回滚；
+// dryRun 为 true 时只检查冲突
+func ApplyTimetableJob(actor Actor, id uint, dryRun bool) (*WriteResult, error) {
+	return runScheduleWrite(dryRun, func(tx *gorm.DB) ([]models.WeeklySchedule, error) {
+		job, err := getTimetableJob(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		if job.Status != models.TimetableJobSucceeded {
+			return nil, ErrTimetableJobNotReady
+		}
+
+		var lessons []models.TimetableLesson
+		if err := tx.Where("job_id = ?", id).Find(&lessons).Error; err != nil {
+			return nil, err
+		}
+
+		var written []models.WeeklySchedule
+		for _, lesson := range lessons {
+			for week := job.StartWeek; week <= job.EndWeek; week++ {
+				// 排课后课程表可能已被修改，目标位置有课时不覆盖
+				if _, err := findLesson(tx, job.TermID, lesson.ClassID, week, lesson.TimeSlotRow, lesson.TimeSlotCol); err == nil {
+					return nil, fmt.Errorf("%w: week %d slot (%d,%d)", ErrSlotOccupied, week, lesson.TimeSlotRow, lesson.TimeSlotCol)
+				} else if !errors.Is(err, ErrLessonNotFound) {
+					return nil, err
+				}
+
+				row := models.WeeklySchedule{
+					TermID:      job.TermID,
+					ClassID:     lesson.ClassID,
+					CourseID:    lesson.CourseID,
+					WeekNumber:  week,
+					TimeSlotRow: lesson.TimeSlotRow,
+					TimeSlotCol: lesson.TimeSlotCol,
+					TeacherID:   lesson.TeacherID,
+					RoomID:      lesson.RoomID,
+				}
+				if err := tx.Create(&row).Error; err != nil {
+					return nil, err
+				}
+				written = append(written, row)
+			}
+		}
+
+		if err := tx.Model(&job).Update("status", models.TimetableJobApplied).Error; err != nil {
+			return nil, err
+		}
+		if err := recordInsertsByClass(tx, actor, written); err != nil {
+			return nil, err
+		}
+		if err := RecordActivity(tx, actor, ActivityEvent{
+			Action: models.ActivityTimetableApply, EntityType: models.EntityTimetableJob, EntityID: job.ID,
+			After: map[string]interface{}{"lessons": len(written), "startWeek": job.StartWeek, "endWeek": job.EndWeek},
+		}); err != nil {
+			return nil, err
+		}
+		return written, nil
+	})
+}
+
+// DeleteTimetableJob 删除排课任务及其草案，正在运行的任务不能删除
+func DeleteTimetableJob(actor Actor, id uint) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		job, err := getTimetableJob(tx, id)
+		if err != nil {
+			return err
+		}
+		if job.Status == models.TimetableJobPending || job.Status == models.TimetableJobRunning {
+			return ErrTimetableJobRunning
+		}
+		if err := tx.Unscoped().Where("job_id = ?", id).Delete(&models.TimetableLesson{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Delete(&job).Error; err != nil {
+			return err
+		}
+		return RecordActivity(tx, actor, ActivityEvent{
+			Action: models.ActivityTimetableDelete, EntityType: models.EntityTimetableJob, EntityID: job.ID,
+			Before: map[string]interface{}{"status": job.Status, "startWeek": job.StartWeek, "endWeek": job.EndWeek},
+		})
+	})
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+// testTimetableProblem 两个班级共用一位教师和一间教室的小型排课问题，
+// 周一到周五可排课，周五最后一节全校不可排课，部分时间槽已被占用
+func testTimetableProblem(seed int64) *timetableProblem {
+	teacherMath, teacherEnglish := uint(1), uint(2)
+	lab := uint(1)
+
+	problem := &timetableProblem{
+		termID:    1,
+		startWeek: 1,
+		endWeek:   16,
+		state:     newSolverState(),
+		maxPerDay: 1,
+		attempts:  10,
+		seed:      seed,
+		groups: []solverGroup{
+			{classID: 1, courseID: 1, className: "C1", courseName: "Math", teacherID: &teacherMath, hours: 4},
+			{classID: 1, courseID: 2, className: "C1", courseName: "English", teacherID: &teacherEnglish, roomID: &lab, hours: 3},
+			{classID: 1, courseID: 3, className: "C1", courseName: "PE", hours: 2},
+			{classID: 2, courseID: 1, className: "C2", courseName: "Math", teacherID: &teacherMath, hours: 4},
+			{classID: 2, courseID: 2, className: "C2", courseName: "English", teacherID: &teacherEnglish, hours: 3},
+			{classID: 2, courseID: 4, className: "C2", courseName: "Lab", roomID: &lab, hours: 2},
+		},
+	}
+	for col := 0; col < 5; col++ {
+		for row := 0; row < slotRows; row++ {
+			problem.slots = append(problem.slots, row*slotCols+col)
+		}
+	}
+	problem.state.global[4*slotCols+4] = true
+	grid(problem.state.classes, 1)[0] = true
+	grid(problem.state.teachers, teacherMath)[1] = true
+	return problem
+}
+
+func TestSolveIsDeterministicForSeed(t *testing.T) {
+	first := testTimetableProblem(42).solve(func(int) {})
+	second := testTimetableProblem(42).solve(func(int) {})
+
+	if !reflect.DeepEqual(first, second) {
+		t.Fatalf("same seed gave different results:\n%+v\n%+v", first, second)
+	}
+	if len(first.placements) == 0 {
+		t.Fatal("no lessons placed")
+	}
+}
+
+func TestSolveRespectsHardConstraints(t *testing.T) {
+	problem := testTimetableProblem(42)
+	result := problem.solve(func(int) {})
+
+	if total := result.unplacedTotal(); total != 0 {
+		t.Fatalf("unplaced hours = %d, want 0", total)
+	}
+
+	allowed := make(map[int]bool, len(problem.slots))
+	for _, slot := range problem.slots {
+		allowed[slot] = true
+	}
+
+	// 按顺序重放安排：每节课的时间槽必须可排课，且班级、教师、教室都未被占用
+	state := problem.state.clone()
+	placed := make([]int, len(problem.groups))
+	for _, placement := range result.placements {
+		group := &problem.groups[placement.group]
+		row, col := placement.slot/slotCols, placement.slot%slotCols
+		if !allowed[placement.slot] {
+			t.Errorf("%s %s placed on unavailable slot (%d,%d)", group.className, group.courseName, row, col)
+		}
+		if !state.free(group, placement.slot) {
+			t.Errorf("%s %s double-booked at slot (%d,%d)", group.className, group.courseName, row, col)
+		}
+		state.occupy(group, placement.slot)
+		placed[placement.group]++
+	}
+
+	for i, group := range problem.groups {
+		if placed[i]+result.unplaced[i] != group.hours {
+			t.Errorf("%s %s: placed %d + unplaced %d, want %d hours",
+				group.className, group.courseName, placed[i], result.unplaced[i], group.hours)
+		}
+	}
+}
+
+func TestSolveReportsProgress(t *testing.T) {
+	problem := testTimetableProblem(7)
+	problem.attempts = 4
+	// 罚分不可能为 0 时会用完全部重启次数
+	problem.groups[2].hours = 10
+
+	var reported []int
+	problem.solve(func(percent int) { reported = append(reported, percent) })
+
+	want := []int{25, 50, 75}
+	if !reflect.DeepEqual(reported, want) {
+		t.Fatalf("progress = %v, want %v", reported, want)
+	}
+}
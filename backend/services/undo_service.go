@@ -0,0 +1,240 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"reschedule-program/database"
+	"reschedule-program/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNothingToUndo = errors.New("nothing to undo")
+	ErrNothingToRedo = errors.New("nothing to redo")
+	ErrCellsChanged  = errors.New("the affected cells have been changed since")
+)
+
+// undoJournalSize 每个用户保留的撤销日志条数
+const undoJournalSize = 50
+
+// UndoResult 撤销或重做的结果
+type UndoResult struct {
+	*WriteResult
+	ClassName string             `json:"className"`
+	Change    ScheduleChangeInfo `json:"change"` // 被撤销或重做的操作
+}
+
+// JournalEntry 撤销日志条目及其对应的变更
+type JournalEntry struct {
+	models.UndoEntry
+	Change ScheduleChangeInfo `json:"change"`
+}
+
+// actorJournal 操作人的撤销日志查询
+func actorJournal(db *gorm.DB, actor Actor) *gorm.DB {
+	return db.Model(&models.UndoEntry{}).Where("actor_id = ? AND actor_name = ?", actor.UserID, actor.Username)
+}
+
+// journalChange 将变更记入操作人的撤销日志：清空可重做的条目，并只保留最近的 undoJournalSize 条。
+// 未登录的操作不记入
+func journalChange(tx *gorm.DB, actor Actor, changeID uint) error {
+	if actor.Username == "" {
+		return nil
+	}
+
+	// 1. 新操作之后不能再重做之前撤销的操作
+	if err := actorJournal(tx, actor).Where("state = ?", models.UndoEntryUndone).Delete(&models.UndoEntry{}).Error; err != nil {
+		return err
+	}
+
+	// 2. 追加日志
+	entry := models.UndoEntry{
+		ActorID:   actor.UserID,
+		ActorName: actor.Username,
+		ChangeID:  changeID,
+		State:     models.UndoEntryDone,
+	}
+	if err := tx.Omit("Change").Create(&entry).Error; err != nil {
+		return err
+	}
+
+	// 3. 删除超出条数的旧日志
+	var oldest []models.UndoEntry
+	if err := actorJournal(tx, actor).Order("id DESC").Offset(undoJournalSize - 1).Limit(1).Find(&oldest).Error; err != nil {
+		return err
+	}
+	if len(oldest) == 0 {
+		return nil
+	}
+	return actorJournal(tx, actor).Where("id < ?", oldest[0].ID).Delete(&models.UndoEntry{}).Error
+}
+
+// GetUndoJournal 获取操作人的撤销日志，最新的在前
+func GetUndoJournal(actor Actor) ([]JournalEntry, error) {
+	var entries []models.UndoEntry
+	if err := actorJournal(database.DB, actor).Preload("Change").Order("id DESC").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	journal := make([]JournalEntry, 0, len(entries))
+	for _, entry := range entries {
+		info, err := scheduleChangeInfo(entry.Change)
+		if err != nil {
+			return nil, err
+		}
+		journal = append(journal, JournalEntry{UndoEntry: entry, Change: info})
+	}
+	return journal, nil
+}
+
+// replaceCells 将变更涉及的位置从 from 改为 to：这些位置的当前课程必须与 from 完全一致，
+// 否则说明已被其他操作改动，返回 ErrCellsChanged。返回被移除和写入的课程记录
+func replaceCells(tx *gorm.DB, termID uint, classID uint, from []LessonSnapshot, to []LessonSnapshot) ([]models.WeeklySchedule, []models.WeeklySchedule, error) {
+	expected := make(map[slotKey]LessonSnapshot, len(from))
+	for _, snapshot := range from {
+		expected[snapshot.key()] = snapshot
+	}
+	affected := make(map[slotKey]bool, len(from)+len(to))
+	for _, snapshot := range from {
+		affected[snapshot.key()] = true
+	}
+	for _, snapshot := range to {
+		affected[snapshot.key()] = true
+	}
+
+	// 1. 检查涉及位置的当前课程
+	var rows []models.WeeklySchedule
+	if err := tx.Where("term_id = ? AND class_id = ?", termID, classID).Find(&rows).Error; err != nil {
+		return nil, nil, err
+	}
+	var removed []models.WeeklySchedule
+	for _, row := range rows {
+		key := slotKey{row.WeekNumber, row.TimeSlotRow, row.TimeSlotCol}
+		if !affected[key] {
+			continue
+		}
+		current := LessonSnapshot{CourseID: row.CourseID, TeacherID: row.TeacherID, RoomID: row.RoomID}
+		if wanted, ok := expected[key]; !ok || !wanted.sameContent(current) {
+			return nil, nil, fmt.Errorf("%w: week %d, slot %d-%d", ErrCellsChanged, key.Week, key.Row, key.Col)
+		}
+		removed = append(removed, row)
+	}
+	if len(removed) != len(expected) {
+		return nil, nil, ErrCellsChanged
+	}
+
+	// 2. 移除当前课程
+	for i := range removed {
+		if err := tx.Delete(&removed[i]).Error; err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// 3. 写入目标课程
+	var written []models.WeeklySchedule
+	for _, snapshot := range to {
+		// 课程可能已被删除或合并
+		if err := restoreCourse(tx, snapshot); err != nil {
+			return nil, nil, err
+		}
+		row := models.WeeklySchedule{
+			TermID:      termID,
+			ClassID:     classID,
+			CourseID:    snapshot.CourseID,
+			WeekNumber:  snapshot.WeekNumber,
+			TimeSlotRow: snapshot.TimeSlotRow,
+			TimeSlotCol: snapshot.TimeSlotCol,
+			TeacherID:   snapshot.TeacherID,
+			RoomID:      snapshot.RoomID,
+		}
+		if err := tx.Create(&row).Error; err != nil {
+			return nil, nil, err
+		}
+		written = append(written, row)
+	}
+	return removed, written, nil
+}
+
+// replayJournal 撤销或重做操作人撤销日志中的一条操作：
+// 撤销取最近一条已执行的操作并恢复为变更前，重做取最早一条已撤销的操作并恢复为变更后
+func replayJournal(actor Actor, undo bool, dryRun bool) (*UndoResult, error) {
+	state, next, action, empty := models.UndoEntryDone, models.UndoEntryUndone, models.ScheduleChangeUndo, ErrNothingToUndo
+	order := "id DESC"
+	if !undo {
+		state, next, action, empty = models.UndoEntryUndone, models.UndoEntryDone, models.ScheduleChangeRedo, ErrNothingToRedo
+		order = "id ASC"
+	}
+
+	replay := &UndoResult{}
+	result, err := runScheduleWrite(dryRun, func(tx *gorm.DB) ([]models.WeeklySchedule, error) {
+		// 1. 取出要撤销或重做的操作
+		var entry models.UndoEntry
+		if err := actorJournal(tx, actor).Preload("Change").Where("state = ?", state).Order(order).First(&entry).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, empty
+			}
+			return nil, err
+		}
+		info, err := scheduleChangeInfo(entry.Change)
+		if err != nil {
+			return nil, err
+		}
+		replay.Change = info
+
+		var class models.Class
+		if err := tx.First(&class, info.ClassID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrClassNotFound
+			}
+			return nil, err
+		}
+		if class.Archived {
+			return nil, ErrClassArchived
+		}
+		replay.ClassName = class.Name
+
+		// 2. 涉及的位置未被改动时替换课程
+		from, to := info.After, info.Before
+		if !undo {
+			from, to = info.Before, info.After
+		}
+		removed, written, err := replaceCells(tx, info.TermID, info.ClassID, from, to)
+		if err != nil {
+			return nil, err
+		}
+		// 移动课程时已发布的课程一并移动过，撤销和重做时同样移回或再次移动
+		if info.Action == models.ScheduleChangeMove && len(from) == 1 && len(to) == 1 {
+			if err := movePublishedLesson(tx, info.TermID, info.ClassID, from[0].CourseID, from[0].key(), to[0].key()); err != nil {
+				return nil, err
+			}
+		}
+
+		// 3. 记入历史并更新日志状态，撤销和重做本身不记入撤销日志
+		actor.journal = false
+		if err := recordScheduleChange(tx, actor, action, info.TermID, info.ClassID, removed, written); err != nil {
+			return nil, err
+		}
+		updated := tx.Model(&entry).Where("state = ?", state).Update("state", next)
+		if updated.Error != nil {
+			return nil, updated.Error
+		}
+		if updated.RowsAffected == 0 {
+			return nil, empty
+		}
+		return written, nil
+	})
+	replay.WriteResult = result
+	return replay, err
+}
+
+// UndoSchedule 撤销操作人最近一次删除、移动或交换课程的操作；
+// 涉及的位置已被他人改动时拒绝撤销并返回 ErrCellsChanged，dryRun 为 true 时只预览
+func UndoSchedule(actor Actor, dryRun bool) (*UndoResult, error) {
+	return replayJournal(actor, true, dryRun)
+}
+
+// RedoSchedule 重做操作人最近撤销的操作，规则与撤销相同
+func RedoSchedule(actor Actor, dryRun bool) (*UndoResult, error) {
+	return replayJournal(actor, false, dryRun)
+}
@@ -3,6 +3,8 @@ package services
 import (
 	"reschedule-program/database"
 	"reschedule-program/models"
+
+	"gorm.io/gorm"
 )
 
 type UserService struct{}
@@ -11,8 +13,17 @@ func NewUserService() *UserService {
 	return &UserService{}
 }
 
-func (s *UserService) CreateUser(user *models.User) error {
-	return database.DB.Create(user).Error
+// CreateUser 创建用户并记录活动日志；自助注册时操作人为新用户本人
+func (s *UserService) CreateUser(actor Actor, user *models.User) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		return RecordActivity(tx, actor, ActivityEvent{
+			Action: models.ActivityUserCreate, EntityType: models.EntityUser, EntityID: user.UserID, EntityName: user.Username,
+			After: UserActivityData(*user),
+		})
+	})
 }
 
 func (s *UserService) GetUserByUsername(username string) (*models.User, error) {
@@ -0,0 +1,614 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"reschedule-program/database"
+	"reschedule-program/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrWebhookNotFound         = errors.New("webhook subscription not found")
+	ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+	ErrInvalidWebhookURL       = errors.New("webhook URL must be an absolute http or https URL")
+	ErrInvalidWebhookEvents    = errors.New("webhook events must be a non-empty list of known event types")
+)
+
+// WebhookEventPing 手动测试订阅时发送的事件
+const WebhookEventPing = "ping"
+
+const (
+	webhookPollInterval  = 2 * time.Second  // 检查待投递队列的间隔
+	webhookTimeout       = 10 * time.Second // 单次投递的超时
+	webhookMaxAttempts   = 10               // 最多尝试次数，之后记为失败
+	webhookRetryBase     = 30 * time.Second // 第一次重试的等待时间，之后每次加倍
+	webhookRetryMax      = 6 * time.Hour    // 重试等待时间的上限
+	webhookBatchSize     = 20               // 每次从队列取出的投递数
+	webhookResponseLimit = 1024             // 投递日志保存的响应内容长度
+	webhookDeliveryLimit = 50               // 投递日志每页默认条数
+)
+
+// webhookClient 发送 Webhook 的 HTTP 客户端
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+// webhookWake 唤醒投递任务，立即处理新加入队列的投递
+var webhookWake = make(chan struct{}, 1)
+
+// WebhookEventTypes 可订阅的事件类型：课程表变更和用户变更，即对应的活动日志操作类型
+func WebhookEventTypes() []string {
+	return []string{
+		scheduleActivity(models.ScheduleChangeInsert),
+		scheduleActivity(models.ScheduleChangeDelete),
+		scheduleActivity(models.ScheduleChangeMove),
+		scheduleActivity(models.ScheduleChangeSwap),
+		scheduleActivity(models.ScheduleChangeUpdate),
+		scheduleActivity(models.ScheduleChangeDiscard),
+		scheduleActivity(models.ScheduleChangeRevert),
+		scheduleActivity(models.ScheduleChangeUndo),
+		scheduleActivity(models.ScheduleChangeRedo),
+		models.ActivitySchedulePublish,
+		models.ActivityUserCreate,
+		models.ActivityUserUpdate,
+		models.ActivityUserPassword,
+		models.ActivityUserDelete,
+	}
+}
+
+// webhookEventType 判断活动日志是否产生 Webhook 事件
+func webhookEventType(action string) bool {
+	return strings.HasPrefix(action, "schedule.") || strings.HasPrefix(action, "user.")
+}
+
+// webhookEventMatches 判断订阅的事件类型是否包含该事件：* 为全部，以 .* 结尾时按前缀匹配
+func webhookEventMatches(patterns []string, event string) bool {
+	for _, pattern := range patterns {
+		if pattern == "*" || pattern == event ||
+			(strings.HasSuffix(pattern, ".*") && strings.HasPrefix(event, strings.TrimSuffix(pattern, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookData 创建或修改订阅的数据
+type WebhookData struct {
+	URL          string   `json:"url"`
+	Secret       string   `json:"secret"` // 为空时创建订阅自动生成，修改时保留原密钥
+	RotateSecret bool     `json:"rotateSecret"`
+	Events       []string `json:"events"`
+	Active       *bool    `json:"active"` // 默认启用
+	Description  string   `json:"description"`
+}
+
+// WebhookInfo 订阅及解析后的事件类型，密钥只在创建和更换时返回
+type WebhookInfo struct {
+	models.WebhookSubscription
+	Events []string `json:"events"`
+	Secret string   `json:"secret,omitempty"`
+}
+
+// WebhookDeliveryInfo 投递日志及发送的内容
+type WebhookDeliveryInfo struct {
+	models.WebhookDelivery
+	Payload models.JSONText `json:"payload"`
+}
+
+// WebhookActor 事件的操作人
+type WebhookActor struct {
+	UserID   string `json:"userId"`
+	Username string `json:"username"`
+}
+
+// WebhookEntity 事件的操作对象
+type WebhookEntity struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// WebhookPayload 发送的 JSON，before/after 与活动日志相同：课程表事件为变更前后的课程，用户事件为用户信息
+type WebhookPayload struct {
+	ID         uint            `json:"id"`
+	Event      string          `json:"event"`
+	OccurredAt time.Time       `json:"occurredAt"`
+	Actor      WebhookActor    `json:"actor"`
+	Entity     WebhookEntity   `json:"entity"`
+	ClassID    *uint           `json:"classId,omitempty"`
+	Message    string          `json:"message"`
+	Before     models.JSONText `json:"before"`
+	After      models.JSONText `json:"after"`
+}
+
+// newWebhookSecret 生成签名密钥
+func newWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// SignWebhook 计算签名：以密钥对 "时间戳.请求体" 做 HMAC-SHA256，结果为 sha256=<十六进制>
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// validateWebhookData 检查 URL 和事件类型，事件类型去重
+func validateWebhookData(data *WebhookData) error {
+	data.URL = strings.TrimSpace(data.URL)
+	parsed, err := url.Parse(data.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return ErrInvalidWebhookURL
+	}
+
+	known := map[string]bool{"*": true, "schedule.*": true, "user.*": true}
+	for _, event := range WebhookEventTypes() {
+		known[event] = true
+	}
+	var events []string
+	seen := map[string]bool{}
+	for _, event := range data.Events {
+		event = strings.TrimSpace(event)
+		if !known[event] {
+			return fmt.Errorf("%w: %q", ErrInvalidWebhookEvents, event)
+		}
+		if !seen[event] {
+			seen[event] = true
+			events = append(events, event)
+		}
+	}
+	if len(events) == 0 {
+		return ErrInvalidWebhookEvents
+	}
+	data.Events = events
+	return nil
+}
+
+// webhookInfo 转换为返回的订阅信息
+func webhookInfo(subscription models.WebhookSubscription) WebhookInfo {
+	return WebhookInfo{WebhookSubscription: subscription, Events: strings.Split(subscription.Events, ",")}
+}
+
+// getWebhook 获取订阅
+func getWebhook(db *gorm.DB, id uint) (*models.WebhookSubscription, error) {
+	var subscription models.WebhookSubscription
+	if err := db.First(&subscription, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWebhookNotFound
+		}
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// GetWebhooks 获取全部订阅
+func GetWebhooks() ([]WebhookInfo, error) {
+	var subscriptions []models.WebhookSubscription
+	if err := database.DB.Order("id").Find(&subscriptions).Error; err != nil {
+		return nil, err
+	}
+	infos := make([]WebhookInfo, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		infos = append(infos, webhookInfo(subscription))
+	}
+	return infos, nil
+}
+
+// GetWebhook 获取订阅
+func GetWebhook(id uint) (*WebhookInfo, error) {
+	subscription, err := getWebhook(database.DB, id)
+	if err != nil {
+		return nil, err
+	}
+	info := webhookInfo(*subscription)
+	return &info, nil
+}
+
+// CreateWebhook 创建订阅，未指定密钥时自动生成
+func CreateWebhook(actor Actor, data WebhookData) (*WebhookInfo, error) {
+	if err := validateWebhookData(&data); err != nil {
+		return nil, err
+	}
+	secret := strings.TrimSpace(data.Secret)
+	if secret == "" {
+		var err error
+		if secret, err = newWebhookSecret(); err != nil {
+			return nil, err
+		}
+	}
+
+	subscription := models.WebhookSubscription{
+		URL:         data.URL,
+		Secret:      secret,
+		Events:      strings.Join(data.Events, ","),
+		Active:      data.Active == nil || *data.Active,
+		Description: strings.TrimSpace(data.Description),
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&subscription).Error; err != nil {
+			return err
+		}
+		return RecordActivity(tx, actor, ActivityEvent{
+			Action: models.ActivityWebhookCreate, EntityType: models.EntityWebhook, EntityID: subscription.ID,
+			EntityName: subscription.URL, After: webhookInfo(subscription),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	info := webhookInfo(subscription)
+	info.Secret = secret
+	return &info, nil
+}
+
+// UpdateWebhook 修改订阅；指定 secret 或 rotateSecret 时更换密钥并在结果中返回
+func UpdateWebhook(actor Actor, id uint, data WebhookData) (*WebhookInfo, error) {
+	if err := validateWebhookData(&data); err != nil {
+		return nil, err
+	}
+
+	var info WebhookInfo
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		subscription, err := getWebhook(tx, id)
+		if err != nil {
+			return err
+		}
+		before := webhookInfo(*subscription)
+
+		secret := strings.TrimSpace(data.Secret)
+		if secret == "" && data.RotateSecret {
+			if secret, err = newWebhookSecret(); err != nil {
+				return err
+			}
+		}
+		if secret != "" {
+			subscription.Secret = secret
+		}
+		subscription.URL = data.URL
+		subscription.Events = strings.Join(data.Events, ",")
+		if data.Active != nil {
+			subscription.Active = *data.Active
+		}
+		subscription.Description = strings.TrimSpace(data.Description)
+		if err := tx.Save(subscription).Error; err != nil {
+			return err
+		}
+
+		info = webhookInfo(*subscription)
+		if err := RecordActivity(tx, actor, ActivityEvent{
+			Action: models.ActivityWebhookUpdate, EntityType: models.EntityWebhook, EntityID: subscription.ID,
+			EntityName: subscription.URL, Before: before, After: info,
+		}); err != nil {
+			return err
+		}
+		info.Secret = secret
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// DeleteWebhook 删除订阅及其投递日志，尚未投递的事件不再发送
+func DeleteWebhook(actor Actor, id uint) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		subscription, err := getWebhook(tx, id)
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("subscription_id = ?", id).Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(subscription).Error; err != nil {
+			return err
+		}
+		return RecordActivity(tx, actor, ActivityEvent{
+			Action: models.ActivityWebhookDelete, EntityType: models.EntityWebhook, EntityID: subscription.ID,
+			EntityName: subscription.URL, Before: webhookInfo(*subscription),
+		})
+	})
+}
+
+// PingWebhook 向订阅发送一个 ping 事件，用于检查接收方和签名
+func PingWebhook(actor Actor, id uint) (*models.WebhookDelivery, error) {
+	subscription, err := getWebhook(database.DB, id)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(WebhookPayload{
+		Event:      WebhookEventPing,
+		OccurredAt: time.Now().UTC(),
+		Actor:      WebhookActor{UserID: actor.UserID, Username: actor.Username},
+		Entity:     WebhookEntity{Type: models.EntityWebhook, ID: strconv.FormatUint(uint64(subscription.ID), 10), Name: subscription.URL},
+		Message:    "Webhook test",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	delivery := models.WebhookDelivery{
+		SubscriptionID: subscription.ID,
+		Event:          WebhookEventPing,
+		Payload:        string(payload),
+		Status:         models.WebhookDeliveryPending,
+		NextAttemptAt:  time.Now(),
+	}
+	if err := database.DB.Create(&delivery).Error; err != nil {
+		return nil, err
+	}
+	wakeWebhooks()
+	return &delivery, nil
+}
+
+// enqueueWebhooks 在写入活动日志的事务中为匹配的启用订阅加入待投递队列，事务回滚时不会发送
+func enqueueWebhooks(tx *gorm.DB, entry *models.ActivityLog) error {
+	if !webhookEventType(entry.Action) {
+		return nil
+	}
+	var subscriptions []models.WebhookSubscription
+	if err := tx.Where("active = ?", true).Order("id").Find(&subscriptions).Error; err != nil {
+		return err
+	}
+
+	var payload []byte
+	for _, subscription := range subscriptions {
+		if !webhookEventMatches(strings.Split(subscription.Events, ","), entry.Action) {
+			continue
+		}
+		if payload == nil {
+			var err error
+			payload, err = json.Marshal(WebhookPayload{
+				ID:         entry.ID,
+				Event:      entry.Action,
+				OccurredAt: entry.CreatedAt.UTC(),
+				Actor:      WebhookActor{UserID: entry.ActorID, Username: entry.ActorName},
+				Entity:     WebhookEntity{Type: entry.EntityType, ID: entry.EntityID, Name: entry.EntityName},
+				ClassID:    entry.ClassID,
+				Message:    entry.Message,
+				Before:     entry.Before,
+				After:      entry.After,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if err := tx.Create(&models.WebhookDelivery{
+			SubscriptionID: subscription.ID,
+			EventID:        entry.ID,
+			Event:          entry.Action,
+			Payload:        string(payload),
+			Status:         models.WebhookDeliveryPending,
+			NextAttemptAt:  entry.CreatedAt,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WebhookDeliveryQuery 投递日志查询条件
+type WebhookDeliveryQuery struct {
+	SubscriptionID uint
+	Status         string
+	Before         uint // 只返回ID小于该值的日志，用于翻页
+	Limit          int
+}
+
+// WebhookDeliveryPage 一页投递日志，NextCursor 为下一页的游标，没有更多日志时为 0
+type WebhookDeliveryPage struct {
+	Deliveries []models.WebhookDelivery `json:"deliveries"`
+	NextCursor uint                     `json:"nextCursor"`
+}
+
+// GetWebhookDeliveries 查询订阅的投递日志，最新的在前
+func GetWebhookDeliveries(query WebhookDeliveryQuery) (*WebhookDeliveryPage, error) {
+	if _, err := getWebhook(database.DB, query.SubscriptionID); err != nil {
+		return nil, err
+	}
+	limit := query.Limit
+	if limit <= 0 || limit > 500 {
+		limit = webhookDeliveryLimit
+	}
+
+	db := database.DB.Where("subscription_id = ?", query.SubscriptionID)
+	if query.Status != "" {
+		db = db.Where("status = ?", query.Status)
+	}
+	if query.Before > 0 {
+		db = db.Where("id < ?", query.Before)
+	}
+	page := &WebhookDeliveryPage{Deliveries: []models.WebhookDelivery{}}
+	if err := db.Order("id DESC").Limit(limit + 1).Find(&page.Deliveries).Error; err != nil {
+		return nil, err
+	}
+	if len(page.Deliveries) > limit {
+		page.Deliveries = page.Deliveries[:limit]
+		page.NextCursor = page.Deliveries[limit-1].ID
+	}
+	return page, nil
+}
+
+// GetWebhookDelivery 获取一次投递及发送的内容
+func GetWebhookDelivery(id uint) (*WebhookDeliveryInfo, error) {
+	var delivery models.WebhookDelivery
+	if err := database.DB.First(&delivery, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWebhookDeliveryNotFound
+		}
+		return nil, err
+	}
+	return &WebhookDeliveryInfo{WebhookDelivery: delivery, Payload: models.JSONText(delivery.Payload)}, nil
+}
+
+// RedeliverWebhook 以相同内容重新投递，作为一次新的投递记录，原投递日志保留
+func RedeliverWebhook(id uint) (*models.WebhookDelivery, error) {
+	original, err := GetWebhookDelivery(id)
+	if err != nil {
+		return nil, err
+	}
+	originalID := original.ID
+	delivery := models.WebhookDelivery{
+		SubscriptionID: original.SubscriptionID,
+		EventID:        original.EventID,
+		Event:          original.Event,
+		Payload:        original.WebhookDelivery.Payload,
+		Status:         models.WebhookDeliveryPending,
+		NextAttemptAt:  time.Now(),
+		RedeliveryOf:   &originalID,
+	}
+	if err := database.DB.Create(&delivery).Error; err != nil {
+		return nil, err
+	}
+	wakeWebhooks()
+	return &delivery, nil
+}
+
+// wakeWebhooks 唤醒投递任务
+func wakeWebhooks() {
+	select {
+	case webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+// webhookRetryDelay 第 attempts 次尝试失败后的等待时间：30 秒起每次加倍，最长 6 小时
+func webhookRetryDelay(attempts int) time.Duration {
+	delay := webhookRetryBase
+	for i := 1; i < attempts && delay < webhookRetryMax; i++ {
+		delay *= 2
+	}
+	if delay > webhookRetryMax {
+		delay = webhookRetryMax
+	}
+	return delay
+}
+
+// StartWebhookDelivery 启动后台投递任务：每隔几秒及有新投递时发送到期的投递。
+// 投递至少发送一次，服务在发送过程中停止时重启后会再次发送
+func StartWebhookDelivery() {
+	go func() {
+		ticker := time.NewTicker(webhookPollInterval)
+		defer ticker.Stop()
+		for {
+			if err := deliverDueWebhooks(); err != nil {
+				log.Println("Failed to deliver webhooks:", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-webhookWake:
+			}
+		}
+	}()
+}
+
+// deliverDueWebhooks 按顺序发送到期的投递，直到队列中没有到期的投递
+func deliverDueWebhooks() error {
+	for {
+		var deliveries []models.WebhookDelivery
+		err := database.DB.Where("status = ? AND next_attempt_at <= ?", models.WebhookDeliveryPending, time.Now()).
+			Order("next_attempt_at, id").Limit(webhookBatchSize).Find(&deliveries).Error
+		if err != nil {
+			return err
+		}
+		if len(deliveries) == 0 {
+			return nil
+		}
+		for i := range deliveries {
+			if err := deliverWebhook(&deliveries[i]); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// deliverWebhook 发送一次投递并记录结果：2xx 为成功，否则按指数退避安排重试，次数用完时记为失败
+func deliverWebhook(delivery *models.WebhookDelivery) error {
+	now := time.Now()
+	updates := map[string]interface{}{
+		"attempts":        delivery.Attempts + 1,
+		"last_attempt_at": now,
+		"response_status": 0,
+		"response_body":   "",
+		"last_error":      "",
+	}
+
+	subscription, err := getWebhook(database.DB, delivery.SubscriptionID)
+	switch {
+	case errors.Is(err, ErrWebhookNotFound):
+		return database.DB.Delete(delivery).Error
+	case err != nil:
+		return err
+	case !subscription.Active:
+		updates["status"] = models.WebhookDeliveryFailed
+		updates["last_error"] = "subscription is inactive"
+		return database.DB.Model(delivery).Updates(updates).Error
+	}
+
+	// 1. 发送
+	status, body, sendErr := sendWebhook(subscription, delivery)
+	updates["response_status"] = status
+	updates["response_body"] = body
+
+	// 2. 记录结果
+	switch {
+	case sendErr == nil && status >= 200 && status < 300:
+		updates["status"] = models.WebhookDeliveryDelivered
+		updates["delivered_at"] = now
+	default:
+		if sendErr != nil {
+			updates["last_error"] = sendErr.Error()
+		} else {
+			updates["last_error"] = fmt.Sprintf("receiver returned HTTP %d", status)
+		}
+		if delivery.Attempts+1 >= webhookMaxAttempts {
+			updates["status"] = models.WebhookDeliveryFailed
+		} else {
+			updates["next_attempt_at"] = now.Add(webhookRetryDelay(delivery.Attempts + 1))
+		}
+	}
+	return database.DB.Model(delivery).Updates(updates).Error
+}
+
+// sendWebhook 以 POST 发送签名的 JSON，返回响应状态码和响应内容的开头
+func sendWebhook(subscription *models.WebhookSubscription, delivery *models.WebhookDelivery) (int, string, error) {
+	body := []byte(delivery.Payload)
+	timestamp := time.Now().Unix()
+	request, err := http.NewRequest(http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "reschedule-program-webhook/1")
+	request.Header.Set("X-Webhook-Event", delivery.Event)
+	request.Header.Set("X-Webhook-Delivery", strconv.FormatUint(uint64(delivery.ID), 10))
+	request.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	request.Header.Set("X-Webhook-Signature", SignWebhook(subscription.Secret, timestamp, body))
+
+	response, err := webhookClient.Do(request)
+	if err != nil {
+		return 0, "", err
+	}
+	defer response.Body.Close()
+	content, _ := io.ReadAll(io.LimitReader(response.Body, webhookResponseLimit))
+	io.Copy(io.Discard, io.LimitReader(response.Body, 1<<20))
+	return response.StatusCode, strings.ToValidUTF8(string(content), ""), nil
+}
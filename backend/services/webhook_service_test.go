@@ -0,0 +1,251 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reschedule-program/database"
+	"reschedule-program/models"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// receivedWebhook 接收方收到的一次请求
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+}
+
+// webhookReceiver 以固定状态码响应的测试接收方，记录收到的请求
+type webhookReceiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []receivedWebhook
+}
+
+func newWebhookReceiver(t *testing.T, status int) *webhookReceiver {
+	t.Helper()
+	receiver := &webhookReceiver{}
+	receiver.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		receiver.mu.Lock()
+		receiver.requests = append(receiver.requests, receivedWebhook{header: r.Header.Clone(), body: body})
+		receiver.mu.Unlock()
+		w.WriteHeader(status)
+		io.WriteString(w, http.StatusText(status))
+	}))
+	t.Cleanup(receiver.Close)
+	return receiver
+}
+
+// received 返回目前收到的请求
+func (r *webhookReceiver) received() []receivedWebhook {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]receivedWebhook(nil), r.requests...)
+}
+
+// createTestWebhook 创建指向接收方的订阅，返回订阅及其密钥
+func createTestWebhook(t *testing.T, url string, events ...string) *WebhookInfo {
+	t.Helper()
+	webhook, err := CreateWebhook(Actor{}, WebhookData{URL: url, Events: events})
+	if err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+	return webhook
+}
+
+// loadDelivery 重新读取投递记录
+func loadDelivery(t *testing.T, id uint) models.WebhookDelivery {
+	t.Helper()
+	var delivery models.WebhookDelivery
+	if err := database.DB.First(&delivery, id).Error; err != nil {
+		t.Fatalf("load delivery %d: %v", id, err)
+	}
+	return delivery
+}
+
+// makeDeliveryDue 将投递的下次尝试时间提前，模拟等待时间已过
+func makeDeliveryDue(t *testing.T, id uint) {
+	t.Helper()
+	err := database.DB.Model(&models.WebhookDelivery{}).Where("id = ?", id).
+		Update("next_attempt_at", time.Now().Add(-time.Second)).Error
+	if err != nil {
+		t.Fatalf("make delivery %d due: %v", id, err)
+	}
+}
+
+func TestDeliverWebhookSignsPayload(t *testing.T) {
+	setupTestDB(t)
+	receiver := newWebhookReceiver(t, http.StatusOK)
+	webhook := createTestWebhook(t, receiver.URL, "user.*")
+
+	// 记录活动日志时加入队列
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		return RecordActivity(tx, Actor{UserID: "0000000000", Username: "Admin"}, ActivityEvent{
+			Action: models.ActivityUserCreate, EntityType: models.EntityUser, EntityID: "1234567890",
+			EntityName: "bob", After: map[string]string{"username": "bob"},
+		})
+	})
+	if err != nil {
+		t.Fatalf("RecordActivity: %v", err)
+	}
+	if err := deliverDueWebhooks(); err != nil {
+		t.Fatalf("deliverDueWebhooks: %v", err)
+	}
+
+	requests := receiver.received()
+	if len(requests) != 1 {
+		t.Fatalf("receiver got %d requests, want 1", len(requests))
+	}
+	request := requests[0]
+	timestamp, err := strconv.ParseInt(request.header.Get("X-Webhook-Timestamp"), 10, 64)
+	if err != nil {
+		t.Fatalf("X-Webhook-Timestamp: %v", err)
+	}
+	if got, want := request.header.Get("X-Webhook-Signature"), SignWebhook(webhook.Secret, timestamp, request.body); got != want {
+		t.Errorf("X-Webhook-Signature = %q, want %q", got, want)
+	}
+	if got := request.header.Get("X-Webhook-Event"); got != models.ActivityUserCreate {
+		t.Errorf("X-Webhook-Event = %q, want %q", got, models.ActivityUserCreate)
+	}
+
+	var payload struct {
+		ID     uint          `json:"id"`
+		Event  string        `json:"event"`
+		Actor  WebhookActor  `json:"actor"`
+		Entity WebhookEntity `json:"entity"`
+	}
+	if err := json.Unmarshal(request.body, &payload); err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+	if payload.Event != models.ActivityUserCreate || payload.Entity.ID != "1234567890" || payload.Actor.Username != "Admin" {
+		t.Errorf("payload = %+v", payload)
+	}
+
+	deliveryID, _ := strconv.ParseUint(request.header.Get("X-Webhook-Delivery"), 10, 32)
+	delivery := loadDelivery(t, uint(deliveryID))
+	if delivery.Status != models.WebhookDeliveryDelivered || delivery.Attempts != 1 || delivery.DeliveredAt == nil {
+		t.Errorf("delivery = status %s, attempts %d, deliveredAt %v; want delivered after 1 attempt",
+			delivery.Status, delivery.Attempts, delivery.DeliveredAt)
+	}
+	if delivery.EventID != payload.ID {
+		t.Errorf("delivery event ID = %d, payload id = %d", delivery.EventID, payload.ID)
+	}
+}
+
+func TestDeliverWebhookSchedulesRetry(t *testing.T) {
+	setupTestDB(t)
+	receiver := newWebhookReceiver(t, http.StatusInternalServerError)
+	webhook := createTestWebhook(t, receiver.URL, "*")
+	queued, err := PingWebhook(Actor{}, webhook.ID)
+	if err != nil {
+		t.Fatalf("PingWebhook: %v", err)
+	}
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		makeDeliveryDue(t, queued.ID)
+		if err := deliverDueWebhooks(); err != nil {
+			t.Fatalf("deliverDueWebhooks: %v", err)
+		}
+
+		delivery := loadDelivery(t, queued.ID)
+		if delivery.Status != models.WebhookDeliveryPending || delivery.Attempts != attempt {
+			t.Fatalf("after attempt %d: status %s, attempts %d", attempt, delivery.Status, delivery.Attempts)
+		}
+		if delivery.ResponseStatus != http.StatusInternalServerError || delivery.LastError == "" {
+			t.Errorf("after attempt %d: response status %d, last error %q", attempt, delivery.ResponseStatus, delivery.LastError)
+		}
+		if delivery.LastAttemptAt == nil {
+			t.Fatalf("after attempt %d: last attempt time not set", attempt)
+		}
+		if got, want := delivery.NextAttemptAt.Sub(*delivery.LastAttemptAt), webhookRetryDelay(attempt); got != want {
+			t.Errorf("after attempt %d: retry in %v, want %v", attempt, got, want)
+		}
+	}
+
+	// 未到重试时间时不再发送
+	if err := deliverDueWebhooks(); err != nil {
+		t.Fatalf("deliverDueWebhooks: %v", err)
+	}
+	if got := len(receiver.received()); got != 3 {
+		t.Errorf("receiver got %d requests, want 3", got)
+	}
+}
+
+func TestDeliverWebhookFailsAfterMaxAttempts(t *testing.T) {
+	setupTestDB(t)
+	receiver := newWebhookReceiver(t, http.StatusServiceUnavailable)
+	webhook := createTestWebhook(t, receiver.URL, "*")
+	queued, err := PingWebhook(Actor{}, webhook.ID)
+	if err != nil {
+		t.Fatalf("PingWebhook: %v", err)
+	}
+
+	for attempt := 1; attempt <= webhookMaxAttempts+1; attempt++ {
+		makeDeliveryDue(t, queued.ID)
+		if err := deliverDueWebhooks(); err != nil {
+			t.Fatalf("deliverDueWebhooks: %v", err)
+		}
+	}
+
+	delivery := loadDelivery(t, queued.ID)
+	if delivery.Status != models.WebhookDeliveryFailed || delivery.Attempts != webhookMaxAttempts {
+		t.Errorf("delivery = status %s, attempts %d; want failed after %d attempts",
+			delivery.Status, delivery.Attempts, webhookMaxAttempts)
+	}
+	if got := len(receiver.received()); got != webhookMaxAttempts {
+		t.Errorf("receiver got %d requests, want %d", got, webhookMaxAttempts)
+	}
+}
+
+func TestRedeliverWebhook(t *testing.T) {
+	setupTestDB(t)
+	receiver := newWebhookReceiver(t, http.StatusNoContent)
+	webhook := createTestWebhook(t, receiver.URL, "*")
+	original, err := PingWebhook(Actor{}, webhook.ID)
+	if err != nil {
+		t.Fatalf("PingWebhook: %v", err)
+	}
+	if err := deliverDueWebhooks(); err != nil {
+		t.Fatalf("deliverDueWebhooks: %v", err)
+	}
+
+	redelivery, err := RedeliverWebhook(original.ID)
+	if err != nil {
+		t.Fatalf("RedeliverWebhook: %v", err)
+	}
+	if redelivery.ID == original.ID || redelivery.Status != models.WebhookDeliveryPending ||
+		redelivery.RedeliveryOf == nil || *redelivery.RedeliveryOf != original.ID {
+		t.Fatalf("redelivery = %+v, want a new pending delivery of %d", redelivery, original.ID)
+	}
+	if err := deliverDueWebhooks(); err != nil {
+		t.Fatalf("deliverDueWebhooks: %v", err)
+	}
+
+	requests := receiver.received()
+	if len(requests) != 2 {
+		t.Fatalf("receiver got %d requests, want 2", len(requests))
+	}
+	if string(requests[0].body) != string(requests[1].body) {
+		t.Errorf("redelivered payload differs:\n%s\n%s", requests[0].body, requests[1].body)
+	}
+	if got := requests[1].header.Get("X-Webhook-Delivery"); got != strconv.FormatUint(uint64(redelivery.ID), 10) {
+		t.Errorf("X-Webhook-Delivery = %q, want %d", got, redelivery.ID)
+	}
+	for _, id := range []uint{original.ID, redelivery.ID} {
+		if status := loadDelivery(t, id).Status; status != models.WebhookDeliveryDelivered {
+			t.Errorf("delivery %d status = %s, want delivered", id, status)
+		}
+	}
+
+	if _, err := RedeliverWebhook(999); !errors.Is(err, ErrWebhookDeliveryNotFound) {
+		t.Errorf("RedeliverWebhook(999) err = %v, want ErrWebhookDeliveryNotFound", err)
+	}
+}